@@ -9,12 +9,33 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
 	"github.com/uber-go/zap"
 )
 
+//HookIDHeader is the response header holding the ID of an enqueued hook
+const HookIDHeader = "X-Santiago-Hook-Id"
+
+//DuplicateHeader is the response header set when a hook was not enqueued again due to its idempotency key
+const DuplicateHeader = "X-Santiago-Duplicate"
+
+//IdempotencyKeyHeader is the request header holding the idempotency key of a hook
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+//TenantHeader is the request header holding the tenant that owns the hook
+const TenantHeader = "X-Santiago-Tenant"
+
+func setPublishResultHeaders(result *PublishResult, c echo.Context) {
+	c.Response().Header().Set(HookIDHeader, result.ID)
+	if result.Duplicate {
+		c.Response().Header().Set(DuplicateHeader, "true")
+	}
+}
+
 // AddHookHandler sends new hooks
 func AddHookHandler(app *App) func(c echo.Context) error {
 	return func(c echo.Context) error {
@@ -33,9 +54,36 @@ func AddHookHandler(app *App) func(c echo.Context) error {
 			return FailWith(http.StatusBadRequest, "Both 'method' and 'url' must be provided as querystring parameters", c)
 		}
 
+		err := app.CheckEgress(url)
+		if err != nil {
+			l.Warn("Request validation failed.", zap.Error(err))
+			return FailWith(http.StatusBadRequest, err.Error(), c)
+		}
+
+		tenant, err := GetRequestTenant(c, "")
+		if err != nil {
+			l.Warn("Request validation failed.", zap.Error(err))
+			return FailWith(http.StatusForbidden, err.Error(), c)
+		}
+		if tenant != "" && !queue.ValidTenant(tenant) {
+			l.Warn("Request validation failed.")
+			return FailWith(http.StatusBadRequest, fmt.Sprintf("The '%s' header must have at most %d letters, digits, dots, dashes or underscores", TenantHeader, queue.MaxTenantLength), c)
+		}
+
+		idempotencyKey := c.Request().Header().Get(IdempotencyKeyHeader)
+		if len(idempotencyKey) > MaxIdempotencyKeyLength {
+			l.Warn("Request validation failed.")
+			return FailWith(http.StatusBadRequest, fmt.Sprintf("The '%s' header must have at most %d characters", IdempotencyKeyHeader, MaxIdempotencyKeyLength), c)
+		}
+
+		priority := strings.ToLower(c.QueryParam("priority"))
+		if priority != "" && !queue.ValidPriority(priority) {
+			l.Warn("Request validation failed.")
+			return FailWith(http.StatusBadRequest, "The 'priority' querystring parameter must be one of high, normal or low", c)
+		}
+
 		log.D(l, "Sending hook to queue...")
 		var payload string
-		var err error
 		err = WithSegment("payload", c, func() error {
 			payload, err = GetRequestBody(c)
 			return err
@@ -46,15 +94,197 @@ func AddHookHandler(app *App) func(c echo.Context) error {
 			return FailWith(http.StatusBadRequest, msg, c)
 		}
 
+		hook := &Hook{
+			Method:         method,
+			URL:            url,
+			Headers:        GetForwardedHeaders(c),
+			IdempotencyKey: idempotencyKey,
+			Tenant:         tenant,
+			Priority:       priority,
+		}
+		data := hook.ToMessage()
+		data["payload"] = payload
+
+		var result *PublishResult
 		err = WithSegment("publish-hook", c, func() error {
-			return app.PublishHook(method, url, payload)
+			result, err = app.PublishMessage(data)
+			return err
 		})
 		if err != nil {
 			l.Error("Hook failed to be published.", zap.Error(err))
 			return FailWith(500, fmt.Sprintf("Hook failed to be published (%s).", err.Error()), c)
 		}
+		if result.QuotaError != nil {
+			return FailWithQuota(result.QuotaError, c)
+		}
 
-		log.D(l, "Hook sent to queue successfully...")
+		log.D(l, "Hook sent to queue successfully...", func(cm log.CM) {
+			cm.Write(zap.String("hookID", result.ID), zap.Bool("duplicate", result.Duplicate))
+		})
+		setPublishResultHeaders(result, c)
 		return c.String(http.StatusOK, "OK")
 	}
 }
+
+// AddHookV2Handler sends new hooks described by a JSON document in the request body
+func AddHookV2Handler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		l := app.Logger.With(
+			zap.String("source", "addHookV2Handler"),
+			zap.String("queue", app.Queue),
+		)
+
+		var hook Hook
+		err := WithSegment("payload", c, func() error {
+			return GetRequestJSON(&hook, c)
+		})
+		if err != nil {
+			l.Warn("Failed to parse hook in request body.", zap.Error(err))
+			return FailWith(http.StatusBadRequest, fmt.Sprintf("Failed to parse hook in request body (%s).", err.Error()), c)
+		}
+
+		l = l.With(
+			zap.String("method", hook.Method),
+			zap.String("url", hook.URL),
+		)
+
+		if hook.IdempotencyKey == "" {
+			hook.IdempotencyKey = c.Request().Header().Get(IdempotencyKeyHeader)
+		}
+		hook.Tenant, err = GetRequestTenant(c, hook.Tenant)
+		if err != nil {
+			l.Warn("Request validation failed.", zap.Error(err))
+			return FailWith(http.StatusForbidden, err.Error(), c)
+		}
+
+		err = hook.Validate()
+		if err == nil {
+			err = app.CheckEgress(hook.URL)
+		}
+		if err != nil {
+			l.Warn("Request validation failed.", zap.Error(err))
+			return FailWith(http.StatusBadRequest, err.Error(), c)
+		}
+
+		data := hook.ToMessage()
+		l = l.With(zap.Object("hookID", data["id"]))
+
+		log.D(l, "Sending hook to queue...")
+		var result *PublishResult
+		err = WithSegment("publish-hook", c, func() error {
+			result, err = app.PublishMessage(data)
+			return err
+		})
+		if err != nil {
+			l.Error("Hook failed to be published.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Hook failed to be published (%s).", err.Error()), c)
+		}
+		if result.QuotaError != nil {
+			return FailWithQuota(result.QuotaError, c)
+		}
+
+		log.D(l, "Hook sent to queue successfully...", func(cm log.CM) {
+			cm.Write(zap.Bool("duplicate", result.Duplicate))
+		})
+		setPublishResultHeaders(result, c)
+		return SucceedWith(map[string]interface{}{
+			"id":        result.ID,
+			"duplicate": result.Duplicate,
+		}, c)
+	}
+}
+
+// HookResult is the outcome of a single hook in a batch
+type HookResult struct {
+	Success   bool   `json:"success"`
+	ID        string `json:"id,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// AddHookBatchHandler sends many hooks described by a JSON array in the request body at once
+func AddHookBatchHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		l := app.Logger.With(
+			zap.String("source", "addHookBatchHandler"),
+			zap.String("queue", app.Queue),
+		)
+
+		var hooks []*Hook
+		err := WithSegment("payload", c, func() error {
+			return GetRequestJSON(&hooks, c)
+		})
+		if err != nil {
+			l.Warn("Failed to parse hooks in request body.", zap.Error(err))
+			return FailWith(http.StatusBadRequest, fmt.Sprintf("Failed to parse hooks in request body (%s).", err.Error()), c)
+		}
+
+		if len(hooks) == 0 || len(hooks) > MaxBatchSize {
+			l.Warn("Request validation failed.", zap.Int("hookCount", len(hooks)))
+			return FailWith(http.StatusBadRequest, fmt.Sprintf("The batch must have between 1 and %d hooks", MaxBatchSize), c)
+		}
+
+		results := make([]*HookResult, len(hooks))
+		messages := []map[string]interface{}{}
+		messageIndexes := []int{}
+		for i, hook := range hooks {
+			if hook == nil {
+				results[i] = &HookResult{Success: false, Reason: "hook must be a JSON object"}
+				continue
+			}
+			hook.Tenant, err = GetRequestTenant(c, hook.Tenant)
+			if err == nil {
+				err = hook.Validate()
+			}
+			if err == nil {
+				err = app.CheckEgress(hook.URL)
+			}
+			if err != nil {
+				results[i] = &HookResult{Success: false, Reason: err.Error()}
+				continue
+			}
+			messages = append(messages, hook.ToMessage())
+			messageIndexes = append(messageIndexes, i)
+		}
+
+		l = l.With(
+			zap.Int("hookCount", len(hooks)),
+			zap.Int("validHookCount", len(messages)),
+		)
+
+		log.D(l, "Sending hooks to queue...")
+		var published []*PublishResult
+		err = WithSegment("publish-hooks", c, func() error {
+			published, err = app.PublishMessages(messages)
+			return err
+		})
+		if err != nil {
+			l.Error("Hooks failed to be published.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Hooks failed to be published (%s).", err.Error()), c)
+		}
+
+		duplicates := 0
+		overQuota := 0
+		for j, result := range published {
+			if result.QuotaError != nil {
+				overQuota++
+				results[messageIndexes[j]] = &HookResult{Success: false, Reason: result.QuotaError.Error()}
+				continue
+			}
+			if result.Duplicate {
+				duplicates++
+			}
+			results[messageIndexes[j]] = &HookResult{Success: true, ID: result.ID, Duplicate: result.Duplicate}
+		}
+
+		log.D(l, "Hooks sent to queue successfully...", func(cm log.CM) {
+			cm.Write(zap.Int("duplicateHookCount", duplicates), zap.Int("overQuotaHookCount", overQuota))
+		})
+		return SucceedWith(map[string]interface{}{
+			"published":  len(messages) - duplicates - overQuota,
+			"duplicates": duplicates,
+			"failed":     len(hooks) - len(messages) + overQuota,
+			"results":    results,
+		}, c)
+	}
+}
@@ -16,6 +16,8 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/api"
+	"github.com/topfreegames/santiago/queue"
 	. "github.com/topfreegames/santiago/testing"
 )
 
@@ -68,6 +70,583 @@ var _ = Describe("Add Hook Handler", func() {
 		Expect(payload["test"]).To(BeEquivalentTo("qwe"))
 	})
 
+	It("should forward prefixed request headers with hook", func() {
+		app, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		queueID := uuid.NewV4().String()
+		app.Queue = queueID
+
+		status, body := PostJSONWithHeaders(app, "/hooks?method=POST&url=http://test.com", map[string]interface{}{
+			"test": "qwe",
+		}, map[string]string{
+			"X-Santiago-Header-Content-Type":  "application/json",
+			"X-Santiago-Header-Authorization": "Bearer my-token",
+			"X-Other-Header":                  "not-forwarded",
+		})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("OK"))
+
+		results, err := testClient.BLPop(20*time.Millisecond, queueID).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+
+		var hook map[string]interface{}
+		err = json.Unmarshal([]byte(results[1]), &hook)
+		Expect(err).NotTo(HaveOccurred())
+
+		headers := hook["headers"].(map[string]interface{})
+		Expect(headers).To(HaveLen(2))
+		Expect(headers["Content-Type"]).To(Equal("application/json"))
+		Expect(headers["Authorization"]).To(Equal("Bearer my-token"))
+	})
+
+	Describe("Idempotency", func() {
+		It("should not enqueue hook twice with same idempotency key", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			for i := 0; i < 2; i++ {
+				status, body := PostJSONWithHeaders(app, "/hooks?method=POST&url=http://test.com", map[string]interface{}{
+					"test": "qwe",
+				}, map[string]string{
+					"Idempotency-Key": "order-123",
+				})
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(Equal("OK"))
+			}
+
+			items, err := testClient.LRange(queueID, 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(items).To(HaveLen(1))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(items[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["idempotencyKey"]).To(Equal("order-123"))
+		})
+
+		It("should return ID of the original hook for duplicates", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			hook := map[string]interface{}{
+				"method":         "POST",
+				"url":            "http://test.com/hook",
+				"idempotencyKey": "order-123",
+			}
+
+			status, body := PostJSON(app, "/v2/hooks", hook)
+			Expect(status).To(Equal(http.StatusOK))
+			var first map[string]interface{}
+			err = json.Unmarshal([]byte(body), &first)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(first["duplicate"]).To(BeFalse())
+
+			status, body = PostJSON(app, "/v2/hooks", hook)
+			Expect(status).To(Equal(http.StatusOK))
+			var second map[string]interface{}
+			err = json.Unmarshal([]byte(body), &second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second["duplicate"]).To(BeTrue())
+			Expect(second["id"]).To(Equal(first["id"]))
+
+			total, err := testClient.LLen(queueID).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+		})
+
+		It("should dedupe hooks within the same batch", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			status, body := PostJSON(app, "/hooks/batch", []map[string]interface{}{
+				{"method": "POST", "url": "http://partner-1.com/hook", "idempotencyKey": "event-1"},
+				{"method": "POST", "url": "http://partner-1.com/hook", "idempotencyKey": "event-1"},
+				{"method": "POST", "url": "http://partner-2.com/hook", "idempotencyKey": "event-2"},
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			var result map[string]interface{}
+			err = json.Unmarshal([]byte(body), &result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result["published"]).To(BeEquivalentTo(2))
+			Expect(result["duplicates"]).To(BeEquivalentTo(1))
+
+			results := result["results"].([]interface{})
+			Expect(results[1].(map[string]interface{})["duplicate"]).To(BeTrue())
+			Expect(results[1].(map[string]interface{})["id"]).To(Equal(results[0].(map[string]interface{})["id"]))
+
+			total, err := testClient.LLen(queueID).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(2))
+		})
+
+		It("should not dedupe hooks of different tenants", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			status, body := PostJSON(app, "/hooks/batch", []map[string]interface{}{
+				{"method": "POST", "url": "http://test.com/hook", "idempotencyKey": "order-123", "tenant": "partner-a"},
+				{"method": "POST", "url": "http://test.com/hook", "idempotencyKey": "order-123", "tenant": "partner-b"},
+				{"method": "POST", "url": "http://test.com/hook", "idempotencyKey": "order-123"},
+				{"method": "POST", "url": "http://test.com/hook", "idempotencyKey": "order-123", "tenant": "partner-a"},
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			var result map[string]interface{}
+			err = json.Unmarshal([]byte(body), &result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result["published"]).To(BeEquivalentTo(3))
+			Expect(result["duplicates"]).To(BeEquivalentTo(1))
+
+			results := result["results"].([]interface{})
+			Expect(results[3].(map[string]interface{})["duplicate"]).To(BeTrue())
+			Expect(results[3].(map[string]interface{})["id"]).To(Equal(results[0].(map[string]interface{})["id"]))
+		})
+	})
+
+	Describe("V2", func() {
+		It("should dispatch hook described in JSON", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			expiresAt := time.Now().Add(time.Hour).Unix()
+			status, body := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method":      "put",
+				"url":         "http://test.com/hook",
+				"headers":     map[string]string{"Content-Type": "application/json"},
+				"payload":     map[string]interface{}{"test": "qwe"},
+				"expiresAt":   expiresAt,
+				"maxAttempts": 3,
+				"timeoutMs":   1500,
+				"tags":        map[string]string{"game": "sniper"},
+				"tenant":      "partner-a",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			var result map[string]interface{}
+			err = json.Unmarshal([]byte(body), &result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result["success"]).To(BeTrue())
+			Expect(result["id"]).NotTo(BeEmpty())
+
+			results, err := testClient.BLPop(20*time.Millisecond, queueID).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(2))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(results[1]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(hook["id"]).To(Equal(result["id"]))
+			Expect(hook["method"]).To(Equal("PUT"))
+			Expect(hook["url"]).To(Equal("http://test.com/hook"))
+			Expect(hook["payload"]).To(Equal(`{"test":"qwe"}`))
+			Expect(hook["attempts"]).To(BeEquivalentTo(0))
+			Expect(hook["expires"]).To(BeEquivalentTo(expiresAt))
+			Expect(hook["maxAttempts"]).To(BeEquivalentTo(3))
+			Expect(hook["timeoutMs"]).To(BeEquivalentTo(1500))
+			Expect(hook["headers"]).To(HaveKeyWithValue("Content-Type", "application/json"))
+			Expect(hook["tags"]).To(HaveKeyWithValue("game", "sniper"))
+			Expect(hook["tenant"]).To(Equal("partner-a"))
+		})
+
+		It("should fail if body is not valid JSON", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			status, body := Post(app, "/v2/hooks", "not-json")
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("Failed to parse hook"))
+		})
+
+		It("should fail if hook is invalid", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			status, body := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method":    "POST",
+				"url":       "http://test.com/hook",
+				"timeoutMs": -1,
+			})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("'timeoutMs'"))
+
+			total, err := testClient.LLen(queueID).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+		})
+	})
+
+	Describe("Batch", func() {
+		It("should dispatch all valid hooks and report each result", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			status, body := PostJSON(app, "/hooks/batch", []map[string]interface{}{
+				{"method": "POST", "url": "http://partner-1.com/hook", "payload": map[string]interface{}{"event": "qwe"}},
+				{"method": "SEND", "url": "http://partner-2.com/hook"},
+				{"method": "GET", "url": "http://partner-3.com/hook", "maxAttempts": 2},
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			var result map[string]interface{}
+			err = json.Unmarshal([]byte(body), &result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result["success"]).To(BeTrue())
+			Expect(result["published"]).To(BeEquivalentTo(2))
+			Expect(result["failed"]).To(BeEquivalentTo(1))
+
+			results := result["results"].([]interface{})
+			Expect(results).To(HaveLen(3))
+			Expect(results[0].(map[string]interface{})["success"]).To(BeTrue())
+			Expect(results[0].(map[string]interface{})["id"]).NotTo(BeEmpty())
+			Expect(results[1].(map[string]interface{})["success"]).To(BeFalse())
+			Expect(results[1].(map[string]interface{})["reason"]).To(ContainSubstring("'method'"))
+			Expect(results[2].(map[string]interface{})["success"]).To(BeTrue())
+
+			items, err := testClient.LRange(queueID, 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(items).To(HaveLen(2))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(items[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["url"]).To(Equal("http://partner-1.com/hook"))
+			Expect(hook["payload"]).To(Equal(`{"event":"qwe"}`))
+
+			err = json.Unmarshal([]byte(items[1]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["url"]).To(Equal("http://partner-3.com/hook"))
+			Expect(hook["maxAttempts"]).To(BeEquivalentTo(2))
+		})
+
+		It("should fail if batch is empty", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			status, body := PostJSON(app, "/hooks/batch", []map[string]interface{}{})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("between 1 and"))
+		})
+
+		It("should fail if body is not a JSON array", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			status, body := PostJSON(app, "/hooks/batch", map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+			})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("Failed to parse hooks"))
+		})
+	})
+
+	Describe("Egress", func() {
+		It("should reject hooks to denied destinations", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+			app.Egress, err = queue.NewEgressPolicy(&queue.EgressConfig{DenyPrivateNetworks: true})
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			status, body := PostJSON(app, "/hooks?method=POST&url=http://169.254.169.254/latest", map[string]interface{}{})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("not allowed"))
+
+			status, body = PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method": "POST",
+				"url":    "gopher://test.com/hook",
+			})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("scheme gopher"))
+
+			status, body = PostJSON(app, "/hooks/batch", []map[string]interface{}{
+				{"method": "POST", "url": "http://test.com/hook"},
+				{"method": "POST", "url": "http://127.0.0.1:6379/hook"},
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			var result map[string]interface{}
+			err = json.Unmarshal([]byte(body), &result)
+			Expect(err).NotTo(HaveOccurred())
+			results := result["results"].([]interface{})
+			Expect(results[0].(map[string]interface{})["success"]).To(BeTrue())
+			Expect(results[1].(map[string]interface{})["success"]).To(BeFalse())
+			Expect(results[1].(map[string]interface{})["reason"]).To(ContainSubstring("127.0.0.1"))
+
+			total, err := testClient.LLen(queueID).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+		})
+	})
+
+	Describe("Priorities", func() {
+		It("should enqueue hooks in the queue of their priority", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			status, _ := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://test.com/hook",
+				"priority": "HIGH",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, _ = PostJSON(app, "/hooks?method=POST&url=http://test.com&priority=low", map[string]interface{}{})
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, _ = PostJSON(app, "/hooks/batch", []map[string]interface{}{
+				{"method": "POST", "url": "http://test.com/hook", "priority": "normal"},
+				{"method": "POST", "url": "http://test.com/hook", "priority": "high"},
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			for priority, expected := range map[string]int{"high": 2, "normal": 1, "low": 1} {
+				total, err := testClient.LLen(queue.PriorityQueue(queueID, priority)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(total).To(BeEquivalentTo(expected), priority)
+			}
+
+			results, err := testClient.LRange(queue.PriorityQueue(queueID, "high"), 0, 0).Result()
+			Expect(err).NotTo(HaveOccurred())
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(results[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["priority"]).To(Equal("high"))
+		})
+
+		It("should fail if priority is invalid", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+			app.Queue = uuid.NewV4().String()
+
+			status, body := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://test.com/hook",
+				"priority": "urgent",
+			})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("'priority'"))
+
+			status, body = PostJSON(app, "/hooks?method=POST&url=http://test.com&priority=urgent", map[string]interface{}{})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(body).To(ContainSubstring("'priority'"))
+		})
+	})
+
+	Describe("Tenants", func() {
+		It("should enqueue hooks of tenants in their own queue", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+			app.TenantQueues = true
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			status, _ := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+				"tenant": "partner-a",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, _ = PostJSONWithHeaders(app, "/hooks?method=POST&url=http://test.com", map[string]interface{}{}, map[string]string{
+				api.TenantHeader: "partner-b",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, _ = PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			for _, key := range []string{queueID, queue.TenantQueue(queueID, "partner-a"), queue.TenantQueue(queueID, "partner-b")} {
+				total, err := testClient.LLen(key).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(total).To(BeEquivalentTo(1), key)
+			}
+
+			tenants, err := app.Tenants().List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tenants).To(Equal([]string{"partner-a", "partner-b"}))
+		})
+
+		It("should reject hooks over the quota of the tenant", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+			app.TenantQueues = true
+			app.TenantQuotas = []*queue.TenantQuota{{Tenant: "partner-a", Rate: 1, Burst: 1}}
+			app.Queue = uuid.NewV4().String()
+
+			hook := map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+				"tenant": "partner-a",
+			}
+			status, _ := PostJSON(app, "/v2/hooks", hook)
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, body := PostJSON(app, "/v2/hooks", hook)
+			Expect(status).To(Equal(http.StatusTooManyRequests))
+			Expect(body).To(ContainSubstring("Quota of tenant partner-a exceeded"))
+
+			status, body = PostJSON(app, "/hooks/batch", []map[string]interface{}{
+				hook,
+				{"method": "POST", "url": "http://test.com/hook", "tenant": "partner-b"},
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			var result map[string]interface{}
+			err = json.Unmarshal([]byte(body), &result)
+			Expect(err).NotTo(HaveOccurred())
+			results := result["results"].([]interface{})
+			Expect(results[0].(map[string]interface{})["success"]).To(BeFalse())
+			Expect(results[0].(map[string]interface{})["reason"]).To(ContainSubstring("partner-a"))
+			Expect(results[1].(map[string]interface{})["success"]).To(BeTrue())
+		})
+
+		It("should not count duplicated hooks against the quota of the tenant", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+			app.TenantQueues = true
+			app.TenantQuotas = []*queue.TenantQuota{{Tenant: "partner-a", Rate: 1, Burst: 2}}
+			app.Queue = uuid.NewV4().String()
+
+			hook := map[string]interface{}{
+				"method":         "POST",
+				"url":            "http://test.com/hook",
+				"tenant":         "partner-a",
+				"idempotencyKey": "order-123",
+			}
+			for i := 0; i < 3; i++ {
+				status, _ := PostJSON(app, "/v2/hooks", hook)
+				Expect(status).To(Equal(http.StatusOK))
+			}
+
+			status, _ := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+				"tenant": "partner-a",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, body := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method":         "POST",
+				"url":            "http://test.com/hook",
+				"tenant":         "partner-a",
+				"idempotencyKey": "order-456",
+			})
+			Expect(status).To(Equal(http.StatusTooManyRequests))
+			Expect(body).To(ContainSubstring("Quota of tenant partner-a exceeded"))
+
+			//the idempotency key of hooks over the quota is not used up
+			key, err := testClient.Exists(app.IdempotencyKey("partner-a", "order-456")).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(BeFalse())
+		})
+
+		It("should reject duplicates in the same batch of hooks over the quota of the tenant", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+			app.TenantQueues = true
+			app.TenantQuotas = []*queue.TenantQuota{{Tenant: "partner-a", Rate: 1, Burst: 1}}
+			app.Queue = uuid.NewV4().String()
+
+			status, _ := PostJSON(app, "/v2/hooks", map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+				"tenant": "partner-a",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+
+			hook := map[string]interface{}{
+				"method":         "POST",
+				"url":            "http://test.com/hook",
+				"tenant":         "partner-a",
+				"idempotencyKey": "order-789",
+			}
+			status, body := PostJSON(app, "/hooks/batch", []map[string]interface{}{hook, hook})
+			Expect(status).To(Equal(http.StatusOK))
+
+			var result map[string]interface{}
+			err = json.Unmarshal([]byte(body), &result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result["published"]).To(BeEquivalentTo(0))
+			Expect(result["duplicates"]).To(BeEquivalentTo(0))
+			Expect(result["failed"]).To(BeEquivalentTo(2))
+			results := result["results"].([]interface{})
+			for _, item := range results {
+				Expect(item.(map[string]interface{})["success"]).To(BeFalse())
+				Expect(item.(map[string]interface{})["reason"]).To(ContainSubstring("Quota of tenant partner-a exceeded"))
+			}
+
+			key, err := testClient.Exists(app.IdempotencyKey("partner-a", "order-789")).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(BeFalse())
+		})
+
+		It("should fail if hook tenant differs from the API key tenant", func() {
+			app, err := GetDefaultTestApp(logger)
+			Expect(err).NotTo(HaveOccurred())
+			app.TenantQueues = true
+			app.AuthEnabled = true
+			key := uuid.NewV4().String()
+			app.ConfigAPIKeys = []*queue.APIKey{queue.NewAPIKey(key, "partner", "partner-a", false)}
+
+			queueID := uuid.NewV4().String()
+			app.Queue = queueID
+
+			headers := map[string]string{api.APIKeyHeader: key}
+			status, body := PostJSONWithHeaders(app, "/v2/hooks", map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+				"tenant": "partner-b",
+			}, headers)
+			Expect(status).To(Equal(http.StatusForbidden))
+			Expect(body).To(ContainSubstring("partner-a"))
+
+			status, _ = PostJSONWithHeaders(app, "/v2/hooks", map[string]interface{}{
+				"method": "POST",
+				"url":    "http://test.com/hook",
+			}, headers)
+			Expect(status).To(Equal(http.StatusOK))
+
+			total, err := testClient.LLen(queue.TenantQueue(queueID, "partner-a")).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+		})
+	})
+
 	Measure("it should add hooks", func(b Benchmarker) {
 		app, err := GetDefaultTestApp(logger)
 		Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,125 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+// ListAPIKeysHandler lists the API keys stored in Redis, without the keys themselves
+func ListAPIKeysHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		l := app.Logger.With(
+			zap.String("source", "listAPIKeysHandler"),
+			zap.String("queue", app.Queue),
+		)
+
+		var apiKeys []*queue.APIKey
+		var err error
+		err = WithSegment("list-api-keys", c, func() error {
+			apiKeys, err = app.APIKeys().List()
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to list API keys.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to list API keys (%s).", err.Error()), c)
+		}
+
+		log.D(l, "API keys listed successfully.")
+		return SucceedWith(map[string]interface{}{
+			"apiKeys": apiKeys,
+		}, c)
+	}
+}
+
+// CreateAPIKeyHandler creates a new API key for the client described in the request body
+func CreateAPIKeyHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		l := app.Logger.With(
+			zap.String("source", "createAPIKeyHandler"),
+			zap.String("queue", app.Queue),
+		)
+
+		var body struct {
+			Client string `json:"client"`
+			Tenant string `json:"tenant"`
+			Admin  bool   `json:"admin"`
+		}
+		err := WithSegment("payload", c, func() error {
+			return GetRequestJSON(&body, c)
+		})
+		if err != nil {
+			l.Warn("Failed to parse API key in request body.", zap.Error(err))
+			return FailWith(http.StatusBadRequest, fmt.Sprintf("Failed to parse API key in request body (%s).", err.Error()), c)
+		}
+		if body.Client == "" {
+			l.Warn("Request validation failed.")
+			return FailWith(http.StatusBadRequest, "The 'client' field must be provided", c)
+		}
+		if body.Tenant != "" && !queue.ValidTenant(body.Tenant) {
+			l.Warn("Request validation failed.")
+			return FailWith(http.StatusBadRequest, fmt.Sprintf("'tenant' must have at most %d letters, digits, dots, dashes or underscores", queue.MaxTenantLength), c)
+		}
+
+		var key string
+		var apiKey *queue.APIKey
+		err = WithSegment("create-api-key", c, func() error {
+			key, apiKey, err = app.APIKeys().Create(body.Client, body.Tenant, body.Admin)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to create API key.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to create API key (%s).", err.Error()), c)
+		}
+
+		log.I(l, "API key created successfully.", func(cm log.CM) {
+			cm.Write(zap.String("apiKeyID", apiKey.ID), zap.String("apiKeyClient", apiKey.Client), zap.Bool("admin", apiKey.Admin))
+		})
+		return SucceedWith(map[string]interface{}{
+			"id":     apiKey.ID,
+			"key":    key,
+			"client": apiKey.Client,
+			"tenant": apiKey.Tenant,
+			"admin":  apiKey.Admin,
+		}, c)
+	}
+}
+
+// RevokeAPIKeyHandler revokes an API key stored in Redis
+func RevokeAPIKeyHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		l := app.Logger.With(
+			zap.String("source", "revokeAPIKeyHandler"),
+			zap.String("queue", app.Queue),
+			zap.String("apiKeyID", id),
+		)
+
+		var found bool
+		var err error
+		err = WithSegment("revoke-api-key", c, func() error {
+			found, err = app.APIKeys().Revoke(id)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to revoke API key.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to revoke API key (%s).", err.Error()), c)
+		}
+		if !found {
+			return FailWith(http.StatusNotFound, "API key not found.", c)
+		}
+
+		log.I(l, "API key revoked successfully.")
+		return SucceedWith(map[string]interface{}{}, c)
+	}
+}
@@ -0,0 +1,155 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/api"
+	"github.com/topfreegames/santiago/queue"
+	. "github.com/topfreegames/santiago/testing"
+	"github.com/uber-go/zap"
+)
+
+var _ = Describe("Authentication", func() {
+	var logger *MockLogger
+	var app *api.App
+	var adminKey string
+
+	BeforeEach(func() {
+		logger = NewMockLogger()
+		var err error
+		app, err = GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		app.Queue = uuid.NewV4().String()
+		app.AuthEnabled = true
+
+		adminKey = uuid.NewV4().String()
+		app.ConfigAPIKeys = []*queue.APIKey{queue.NewAPIKey(adminKey, "admin-client", "", true)}
+	})
+
+	var createAPIKey = func(client string) (string, string) {
+		status, body := PostJSONWithHeaders(app, "/apikeys", map[string]interface{}{
+			"client": client,
+		}, map[string]string{api.APIKeyHeader: adminKey})
+		Expect(status).To(Equal(http.StatusOK), body)
+
+		var result map[string]interface{}
+		err := json.Unmarshal([]byte(body), &result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["client"]).To(Equal(client))
+		Expect(result["admin"]).To(BeFalse())
+		return result["id"].(string), result["key"].(string)
+	}
+
+	It("should reject requests without a valid API key", func() {
+		status, body := Get(app, "/status")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+		Expect(body).To(ContainSubstring(api.APIKeyHeader))
+
+		status, _ = GetWithHeaders(app, "/status", map[string]string{api.APIKeyHeader: "invalid"})
+		Expect(status).To(Equal(http.StatusUnauthorized))
+
+		status, _ = PostJSON(app, "/hooks?method=POST&url=http://test.com", map[string]interface{}{})
+		Expect(status).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should not manage API keys while authentication is disabled", func() {
+		app.AuthEnabled = false
+		_, key, err := app.APIKeys().Create("partner", "", false)
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := Get(app, "/apikeys")
+		Expect(status).To(Equal(http.StatusForbidden))
+
+		status, _ = PostJSON(app, "/apikeys", map[string]interface{}{"client": "partner", "admin": true})
+		Expect(status).To(Equal(http.StatusForbidden))
+
+		status, _ = Delete(app, fmt.Sprintf("/apikeys/%s", key.ID))
+		Expect(status).To(Equal(http.StatusForbidden))
+
+		keys, err := app.APIKeys().List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveLen(1))
+		Expect(keys[0].ID).To(Equal(key.ID))
+	})
+
+	It("should not authenticate healthcheck", func() {
+		status, _ := Get(app, "/healthcheck")
+		Expect(status).To(Equal(http.StatusOK))
+	})
+
+	It("should accept API keys in header or as bearer token", func() {
+		_, key := createAPIKey("partner")
+
+		status, _ := GetWithHeaders(app, "/status", map[string]string{api.APIKeyHeader: key})
+		Expect(status).To(Equal(http.StatusOK))
+
+		status, _ = GetWithHeaders(app, "/status", map[string]string{"Authorization": fmt.Sprintf("Bearer %s", key)})
+		Expect(status).To(Equal(http.StatusOK))
+	})
+
+	It("should only allow admin keys to manage API keys", func() {
+		_, key := createAPIKey("partner")
+
+		status, _ := GetWithHeaders(app, "/apikeys", map[string]string{api.APIKeyHeader: key})
+		Expect(status).To(Equal(http.StatusForbidden))
+		Expect(logger).To(HaveLogMessage(
+			zap.WarnLevel, "Request failed.",
+			"client", "partner",
+			"statusCode", http.StatusForbidden,
+		))
+	})
+
+	It("should list and revoke API keys", func() {
+		id, key := createAPIKey("partner")
+
+		status, body := GetWithHeaders(app, "/apikeys", map[string]string{api.APIKeyHeader: adminKey})
+		Expect(status).To(Equal(http.StatusOK))
+		var result map[string]interface{}
+		err := json.Unmarshal([]byte(body), &result)
+		Expect(err).NotTo(HaveOccurred())
+		apiKeys := result["apiKeys"].([]interface{})
+		Expect(apiKeys).To(HaveLen(1))
+		Expect(apiKeys[0].(map[string]interface{})["id"]).To(Equal(id))
+		Expect(apiKeys[0].(map[string]interface{})["client"]).To(Equal("partner"))
+		Expect(apiKeys[0].(map[string]interface{})).NotTo(HaveKey("hash"))
+
+		status, _ = DeleteWithHeaders(app, fmt.Sprintf("/apikeys/%s", id), map[string]string{api.APIKeyHeader: adminKey})
+		Expect(status).To(Equal(http.StatusOK))
+
+		status, _ = GetWithHeaders(app, "/status", map[string]string{api.APIKeyHeader: key})
+		Expect(status).To(Equal(http.StatusUnauthorized))
+
+		status, _ = DeleteWithHeaders(app, fmt.Sprintf("/apikeys/%s", id), map[string]string{api.APIKeyHeader: adminKey})
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should fail to create API key without client", func() {
+		status, body := PostJSONWithHeaders(app, "/apikeys", map[string]interface{}{}, map[string]string{api.APIKeyHeader: adminKey})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring("'client'"))
+	})
+
+	It("should fail to create API key with invalid tenant", func() {
+		status, body := PostJSONWithHeaders(app, "/apikeys", map[string]interface{}{
+			"client": "partner",
+			"tenant": "partner:a",
+		}, map[string]string{api.APIKeyHeader: adminKey})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring("'tenant'"))
+
+		apiKeys, err := app.APIKeys().List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apiKeys).To(BeEmpty())
+	})
+})
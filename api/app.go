@@ -9,11 +9,15 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/net/context"
 	"gopkg.in/redis.v4"
 
 	"github.com/getsentry/raven-go"
@@ -24,22 +28,43 @@ import (
 	newrelic "github.com/newrelic/go-agent"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/viper"
+	"github.com/topfreegames/santiago/config"
 	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
 	"github.com/uber-go/zap"
 )
 
+//claimIdempotencyKeyScript stores the hook ID under the idempotency key if it is not set yet,
+//returning the ID stored by the hook that claimed it before otherwise
+const claimIdempotencyKeyScript = `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return ""
+end
+return redis.call("GET", KEYS[1])
+`
+
 //App is responsible for Santiago's API
 type App struct {
-	Fast          bool
-	Config        *viper.Viper
-	Logger        zap.Logger
-	ServerOptions *Options
-	Engine        engine.Server
-	WebApp        *echo.Echo
-	Client        *redis.Client
-	Queue         string
-	Errors        metrics.EWMA
-	NewRelic      newrelic.Application
+	Fast               bool
+	Config             *viper.Viper
+	Logger             zap.Logger
+	ServerOptions      *Options
+	Engine             engine.Server
+	WebApp             *echo.Echo
+	Client             redis.Cmdable
+	Queue              string
+	Errors             metrics.EWMA
+	NewRelic           newrelic.Application
+	Egress             *queue.EgressPolicy
+	AuthEnabled        bool
+	ConfigAPIKeys      []*queue.APIKey
+	TenantQueues       bool
+	TenantQuotas       []*queue.TenantQuota
+	DefaultTenantQuota *queue.TenantQuota
+	draining           int32
+	inFlight           int64
+	listener           net.Listener
+	listenerMu         sync.Mutex
 }
 
 //New opens a new channel connection
@@ -56,9 +81,7 @@ func New(options *Options, logger zap.Logger, fast bool) (*App, error) {
 	a := App{
 		Logger:        l,
 		ServerOptions: options,
-		Config:        viper.New(),
 		Fast:          fast,
-		Queue:         "webhooks",
 	}
 
 	err := a.initialize()
@@ -76,9 +99,7 @@ func (a *App) initialize() error {
 	start := time.Now()
 	log.D(l, "Initializing app...")
 
-	a.setDefaultConfigurationOptions()
-
-	err := a.loadConfiguration()
+	err := a.configure()
 	if err != nil {
 		return err
 	}
@@ -109,15 +130,46 @@ func (a *App) initialize() error {
 	return nil
 }
 
-func (a *App) setDefaultConfigurationOptions() {
-	a.Config.SetDefault("api.workingText", "WORKING")
+//configDefaults are the values of the API settings that are not configured, besides the shared ones in config.Defaults
+var configDefaults = map[string]interface{}{
+	"api.workingText":     "WORKING",
+	"api.idempotency.ttl": "24h",
+	"api.auth.enabled":    false,
+	"api.tenants.enabled": false,
+}
+
+//CheckConfig loads and validates the configuration of the API without connecting to Redis
+func CheckConfig(options *Options, logger zap.Logger) error {
+	a := &App{
+		Logger:        logger,
+		ServerOptions: options,
+	}
+	return a.configure()
+}
+
+//configure loads the configuration, failing if any setting is invalid
+func (a *App) configure() error {
+	err := a.loadConfiguration()
+	if err != nil {
+		return err
+	}
+
+	err = a.validateConfiguration()
+	if err != nil {
+		return err
+	}
 
-	a.Config.SetDefault("api.redis.host", "localhost")
-	a.Config.SetDefault("api.redis.port", 57575)
-	a.Config.SetDefault("api.redis.password", "")
-	a.Config.SetDefault("api.redis.db", 0)
+	err = a.configureEgress()
+	if err != nil {
+		return err
+	}
 
-	a.Config.SetDefault("api.sentry.url", "")
+	err = a.configureAuth()
+	if err != nil {
+		return err
+	}
+
+	return a.configureTenants()
 }
 
 func (a *App) loadConfiguration() error {
@@ -143,47 +195,71 @@ func (a *App) loadConfiguration() error {
 		return err
 	}
 
-	a.Config.SetConfigFile(a.ServerOptions.ConfigFile)
-	a.Config.SetEnvPrefix("snt") // read in environment variables that match
-	a.Config.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	a.Config.AutomaticEnv()
-
-	// If a config file is found, read it in.
-	if err := a.Config.ReadInConfig(); err != nil {
+	a.Config, err = config.Load(a.ServerOptions.ConfigFile, configDefaults)
+	if err != nil {
 		l.Error("Configuration could not be loaded.", zap.Error(err))
 		return err
 	}
+	a.Queue = config.Queue(a.Config)
 
 	l.Info(
 		"Configuration loaded successfully.",
-		zap.String("configPath", a.Config.ConfigFileUsed()),
+		zap.String("configPath", absConfigFile),
+		zap.String("queue", a.Queue),
 	)
 	return nil
 }
 
-func (a *App) connectToRedis() error {
-	redisHost := a.Config.GetString("api.redis.host")
-	redisPort := a.Config.GetInt("api.redis.port")
-	redisPass := a.Config.GetString("api.redis.password")
-	redisDB := a.Config.GetInt("api.redis.db")
+func (a *App) validateConfiguration() error {
+	c := config.NewChecker(a.Config)
+	config.Check(c)
+	c.Duration("api.idempotency.ttl")
+	err := c.Err()
+	if err != nil {
+		a.Logger.Error("Invalid configuration.", zap.String("operation", "validateConfiguration"), zap.Error(err))
+	}
+	return err
+}
+
+func (a *App) configureEgress() error {
+	if !a.Config.IsSet("api.egress") {
+		return nil
+	}
+
+	egressConfig := &queue.EgressConfig{}
+	err := a.Config.UnmarshalKey("api.egress", egressConfig)
+	if err != nil {
+		return err
+	}
+	a.Egress, err = queue.NewEgressPolicy(egressConfig)
+	if err != nil {
+		a.Logger.Error("Invalid egress configuration.", zap.String("operation", "configureEgress"), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+//CheckEgress returns an error if hooks may not be sent to the given URL
+func (a *App) CheckEgress(url string) error {
+	if a.Egress == nil {
+		return nil
+	}
+	return a.Egress.CheckURL(url)
+}
 
+func (a *App) connectToRedis() error {
+	options := config.Redis(a.Config)
 	l := a.Logger.With(
 		zap.String("source", "api"),
 		zap.String("operation", "connectToRedis"),
-		zap.String("redisHost", redisHost),
-		zap.Int("redisPort", redisPort),
-		zap.Int("redisDB", redisDB),
+		zap.String("redisMode", options.Mode),
+		zap.String("redisAddrs", strings.Join(options.Addrs(), ",")),
+		zap.Int("redisDB", options.DB),
 	)
 
 	log.D(l, "Connecting to Redis...")
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", redisHost, redisPort),
-		Password: redisPass,
-		DB:       redisDB,
-	})
-
 	start := time.Now()
-	_, err := client.Ping().Result()
+	client, err := options.Connect()
 	if err != nil {
 		l.Error("Could not connect to redis.", zap.Error(err))
 		return err
@@ -197,7 +273,7 @@ func (a *App) connectToRedis() error {
 }
 
 func (a *App) connectRaven() {
-	raven.SetDSN(a.Config.GetString("api.sentry.url"))
+	raven.SetDSN(a.Config.GetString("sentry.url"))
 }
 
 func (a *App) configureNewRelic() error {
@@ -233,83 +309,362 @@ func (a *App) initializeWebApp() {
 		zap.Bool("debug", debug),
 	)
 
-	a.Engine = standard.New(fmt.Sprintf("%s:%d", a.ServerOptions.Host, a.ServerOptions.Port))
-	if a.Fast {
-		engine := fasthttp.New(fmt.Sprintf("%s:%d", a.ServerOptions.Host, a.ServerOptions.Port))
-		engine.ReadBufferSize = 30000
-		a.Engine = engine
-	}
+	a.Engine = a.newEngine(nil)
 	a.WebApp = echo.New()
 
 	a.WebApp.Use(NewLoggerMiddleware(a.Logger).Serve)
+	a.WebApp.Use(NewDrainingMiddleware(a).Serve)
 	a.WebApp.Use(NewRecoveryMiddleware(a.onErrorHandler).Serve)
 	a.WebApp.Use(NewVersionMiddleware().Serve)
 	a.WebApp.Use(NewSentryMiddleware(a).Serve)
 	a.WebApp.Use(NewNewRelicMiddleware(a, a.Logger).Serve)
+	a.WebApp.Use(NewAuthMiddleware(a).Serve)
 
 	a.WebApp.Get("/healthcheck", HealthCheckHandler(a))
 	a.WebApp.Get("/status", StatusHandler(a))
+	a.WebApp.Get("/circuits", ListCircuitsHandler(a))
+	a.WebApp.Get("/circuits/:host", GetCircuitHandler(a))
 	a.WebApp.Post("/hooks", AddHookHandler(a))
+	a.WebApp.Post("/v2/hooks", AddHookV2Handler(a))
+	a.WebApp.Post("/hooks/batch", AddHookBatchHandler(a))
+	a.WebApp.Get("/hooks/:id", GetHookHandler(a))
+
+	a.WebApp.Get("/deadletters", ListDeadLettersHandler(a))
+	a.WebApp.Get("/deadletters/:id", GetDeadLetterHandler(a))
+	a.WebApp.Delete("/deadletters/:id", DeleteDeadLetterHandler(a))
+	a.WebApp.Post("/deadletters/:id/replay", ReplayDeadLetterHandler(a))
+
+	a.WebApp.Get("/apikeys", ListAPIKeysHandler(a))
+	a.WebApp.Post("/apikeys", CreateAPIKeyHandler(a))
+	a.WebApp.Delete("/apikeys/:id", RevokeAPIKeyHandler(a))
 
 	log.I(l, "Web App configured successfully")
 }
 
-//GetMessageCount returns the message count for the queue
+//GetMessageCount returns the message count for the queue, adding up every priority and tenant
 func (a *App) GetMessageCount() (int, error) {
-	queue := a.Queue
+	counts, err := a.GetMessageCountByPriority()
+	if err != nil {
+		return 0, err
+	}
+
+	messageCount := 0
+	for _, count := range counts {
+		messageCount += count
+	}
+	return messageCount, nil
+}
 
+//GetMessageCountByPriority returns the message count for the queue of each priority, adding up every tenant
+func (a *App) GetMessageCountByPriority() (map[string]int, error) {
 	l := a.Logger.With(
-		zap.String("operation", "GetMessageCount"),
-		zap.Object("queue", queue),
+		zap.String("operation", "GetMessageCountByPriority"),
+		zap.Object("queue", a.Queue),
 	)
 
 	log.D(l, "Getting message count...")
 
-	total, err := a.Client.LLen(queue).Result()
+	tenants := a.Tenants()
+	tenantList, err := tenants.List()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	baseQueues := []string{a.Queue}
+	for _, tenant := range tenantList {
+		baseQueues = append(baseQueues, tenants.QueueFor(tenant))
 	}
 
-	messageCount := int(total)
+	lengths := map[string][]*redis.IntCmd{}
+	_, err = a.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		for _, priority := range queue.Priorities {
+			for _, baseQueue := range baseQueues {
+				lengths[priority] = append(lengths[priority], pipe.LLen(queue.PriorityQueue(baseQueue, priority)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for priority, cmds := range lengths {
+		for _, cmd := range cmds {
+			counts[priority] += int(cmd.Val())
+		}
+	}
 	log.D(l, "Message count retrieved successfully.", func(cm log.CM) {
-		cm.Write(zap.Int("messageCount", messageCount))
+		cm.Write(
+			zap.Int("high", counts[queue.PriorityHigh]),
+			zap.Int("normal", counts[queue.PriorityNormal]),
+			zap.Int("low", counts[queue.PriorityLow]),
+		)
 	})
 
-	return messageCount, nil
+	return counts, nil
+}
+
+//DeadLetterQueue returns the dead letter queue of the app queue
+func (a *App) DeadLetterQueue() *queue.DeadLetterQueue {
+	return queue.NewDeadLetterQueue(a.Client, a.Queue)
+}
+
+//CircuitBreaker returns the circuit breaker the workers of the app queue use to track destination hosts
+func (a *App) CircuitBreaker() *queue.CircuitBreaker {
+	return queue.NewCircuitBreaker(a.Client, a.Queue, 0, 0)
+}
+
+//Deliveries returns the delivery records of the app queue
+func (a *App) Deliveries() *queue.Deliveries {
+	return queue.NewDeliveries(a.Client, a.Queue, queue.DefaultDeliveryRetention)
 }
 
-//PublishHook sends a hook to the queue
-func (a *App) PublishHook(method, url string, payload string) error {
+//PublishResult is the outcome of publishing a hook. Hooks whose tenant is over its quota are not published
+//and hold the quota error
+type PublishResult struct {
+	ID         string
+	Duplicate  bool
+	QuotaError *queue.QuotaError
+}
+
+//PublishHook sends a hook to the queue, returning its ID
+func (a *App) PublishHook(method, url string, payload string, headers map[string]string) (string, error) {
+	hook := &Hook{
+		Method:  method,
+		URL:     url,
+		Headers: headers,
+	}
+	data := hook.ToMessage()
+	data["payload"] = payload
+	result, err := a.PublishMessage(data)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+//PublishMessage sends a message built with Hook.ToMessage to the queue, unless a hook with the same idempotency key
+//was already sent within the idempotency TTL or its tenant is over its quota
+func (a *App) PublishMessage(data map[string]interface{}) (*PublishResult, error) {
 	queue := a.Queue
 
 	l := a.Logger.With(
 		zap.String("operation", "PublishHook"),
-		zap.String("url", url),
-		zap.Object("payload", payload),
+		zap.Object("hookID", data["id"]),
+		zap.Object("url", data["url"]),
+		zap.Object("payload", data["payload"]),
 		zap.Object("queue", queue),
 	)
 
-	data := map[string]interface{}{
-		"method":   method,
-		"url":      url,
-		"payload":  payload,
-		"attempts": 0,
-	}
-	dataJSON, _ := json.Marshal(data)
-
 	start := time.Now()
 
 	log.D(l, "Publishing hook...")
-	_, err := a.Client.RPush(queue, dataJSON).Result()
+	results, err := a.publish([]map[string]interface{}{data})
 	if err != nil {
 		l.Error("Publishing hook failed.", zap.Error(err))
-		return err
+		return nil, err
+	}
+	if results[0].Duplicate {
+		log.I(l, "Hook was already published with the same idempotency key.", func(cm log.CM) {
+			cm.Write(zap.String("originalHookID", results[0].ID))
+		})
+		return results[0], nil
+	}
+	if results[0].QuotaError != nil {
+		l.Warn("Tenant quota exceeded.", zap.Error(results[0].QuotaError))
+		return results[0], nil
 	}
 	log.I(l, "Hook published successfully.", func(cm log.CM) {
 		cm.Write(zap.Duration("PublishDuration", time.Now().Sub(start)))
 	})
 
-	return nil
+	return results[0], nil
+}
+
+//PublishMessages sends many messages built with Hook.ToMessage to the queue in a single pipeline, skipping the ones
+//whose idempotency key was already used within the idempotency TTL and the ones whose tenant is over its quota
+func (a *App) PublishMessages(messages []map[string]interface{}) ([]*PublishResult, error) {
+	queue := a.Queue
+
+	l := a.Logger.With(
+		zap.String("operation", "PublishMessages"),
+		zap.Int("messageCount", len(messages)),
+		zap.Object("queue", queue),
+	)
+
+	if len(messages) == 0 {
+		return []*PublishResult{}, nil
+	}
+
+	start := time.Now()
+
+	log.D(l, "Publishing hooks...")
+	results, err := a.publish(messages)
+	if err != nil {
+		l.Error("Publishing hooks failed.", zap.Error(err))
+		return nil, err
+	}
+	log.I(l, "Hooks published successfully.", func(cm log.CM) {
+		cm.Write(zap.Duration("PublishDuration", time.Now().Sub(start)))
+	})
+
+	return results, nil
+}
+
+//IdempotencyKey returns the key holding the ID of the hook of the given tenant published with the given idempotency key,
+//so tenants may use the same idempotency keys without colliding
+func (a *App) IdempotencyKey(tenant, key string) string {
+	if tenant == "" {
+		return fmt.Sprintf("%s:idempotency:%s", a.Queue, key)
+	}
+	return fmt.Sprintf("%s:tenant:%s:idempotency:%s", a.Queue, tenant, key)
+}
+
+func (a *App) idempotencyKeyOf(data map[string]interface{}) string {
+	tenant, _ := data["tenant"].(string)
+	return a.IdempotencyKey(tenant, data["idempotencyKey"].(string))
+}
+
+//claimIdempotencyKeys sets the idempotency keys of the messages that have one, returning
+//the ID of the hook that previously claimed it for each duplicated message
+func (a *App) claimIdempotencyKeys(messages []map[string]interface{}) (map[int]string, error) {
+	duplicates := map[int]string{}
+	keyed := []int{}
+	for i, data := range messages {
+		if key, ok := data["idempotencyKey"].(string); ok && key != "" {
+			keyed = append(keyed, i)
+		}
+	}
+	if len(keyed) == 0 {
+		return duplicates, nil
+	}
+
+	ttl := a.Config.GetDuration("api.idempotency.ttl")
+	cmds, err := a.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		for _, i := range keyed {
+			pipe.Eval(
+				claimIdempotencyKeyScript,
+				[]string{a.idempotencyKeyOf(messages[i])},
+				messages[i]["id"], int64(ttl/time.Millisecond),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range keyed {
+		if originalID, ok := cmds[j].(*redis.Cmd).Val().(string); ok && originalID != "" {
+			duplicates[i] = originalID
+		}
+	}
+	return duplicates, nil
+}
+
+func (a *App) releaseIdempotencyKeys(messages []map[string]interface{}) {
+	keys := []string{}
+	for _, data := range messages {
+		if key, ok := data["idempotencyKey"].(string); ok && key != "" {
+			keys = append(keys, a.idempotencyKeyOf(data))
+		}
+	}
+	if len(keys) > 0 {
+		a.Client.Del(keys...)
+	}
+}
+
+//publish stores a pending delivery record for each new message and pushes them all to the queue of their priority,
+//or to the queues of their tenants if tenants have their own queues. Only new messages count against the tenant quotas
+func (a *App) publish(messages []map[string]interface{}) ([]*PublishResult, error) {
+	duplicates, err := a.claimIdempotencyKeys(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*PublishResult, len(messages))
+	fresh := []map[string]interface{}{}
+	freshIndexes := []int{}
+	for i, data := range messages {
+		if originalID, ok := duplicates[i]; ok {
+			results[i] = &PublishResult{ID: originalID, Duplicate: true}
+			continue
+		}
+		fresh = append(fresh, data)
+		freshIndexes = append(freshIndexes, i)
+	}
+
+	exceeded, err := a.ReserveQuotas(fresh)
+	if err != nil {
+		a.releaseIdempotencyKeys(fresh)
+		return nil, err
+	}
+
+	toPublish := []map[string]interface{}{}
+	overQuota := []map[string]interface{}{}
+	tenants := a.Tenants()
+	newTenants := map[string]bool{}
+	queueOrder := []string{}
+	values := map[string][]interface{}{}
+	for j, data := range fresh {
+		i := freshIndexes[j]
+		if quotaErr, ok := exceeded[j]; ok {
+			results[i] = &PublishResult{ID: data["id"].(string), QuotaError: quotaErr}
+			overQuota = append(overQuota, data)
+			continue
+		}
+		results[i] = &PublishResult{ID: data["id"].(string)}
+		dataJSON, _ := json.Marshal(data)
+		toPublish = append(toPublish, data)
+
+		tenant := a.tenantOf(data)
+		if tenant != "" {
+			newTenants[tenant] = true
+		}
+		priority, _ := data["priority"].(string)
+		target := queue.PriorityQueue(tenants.QueueFor(tenant), priority)
+		if _, ok := values[target]; !ok {
+			queueOrder = append(queueOrder, target)
+		}
+		values[target] = append(values[target], dataJSON)
+	}
+	//hooks over the quota may be sent again with the same idempotency key, and so may their duplicates in the
+	//same batch, which are rejected as well since the hooks they are duplicates of were never enqueued
+	a.releaseIdempotencyKeys(overQuota)
+	rejected := map[string]*queue.QuotaError{}
+	for j := range fresh {
+		if quotaErr, ok := exceeded[j]; ok {
+			rejected[fresh[j]["id"].(string)] = quotaErr
+		}
+	}
+	for i := range duplicates {
+		if quotaErr, ok := rejected[results[i].ID]; ok {
+			results[i] = &PublishResult{ID: messages[i]["id"].(string), QuotaError: quotaErr}
+		}
+	}
+	if len(toPublish) == 0 {
+		return results, nil
+	}
+
+	deliveries := a.Deliveries()
+	_, err = a.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		for _, data := range toPublish {
+			deliveries.Add(pipe, queue.NewPendingDelivery(data))
+		}
+		for tenant := range newTenants {
+			tenants.Register(pipe, tenant)
+		}
+		for _, target := range queueOrder {
+			pipe.RPush(target, values[target]...)
+		}
+		queue.Signal(pipe, a.Queue)
+		return nil
+	})
+	if err != nil {
+		a.releaseIdempotencyKeys(toPublish)
+		return nil, err
+	}
+	return results, nil
 }
 
 func (a *App) onErrorHandler(err error, stack []byte) {
@@ -327,15 +682,90 @@ func (a *App) onErrorHandler(err error, stack []byte) {
 	raven.CaptureError(err, tags)
 }
 
-//Start the application
-func (a *App) Start() {
+//newEngine returns the server of the app, accepting connections on the given listener or, if nil, on its own
+func (a *App) newEngine(listener net.Listener) engine.Server {
+	config := engine.Config{
+		Address:  fmt.Sprintf("%s:%d", a.ServerOptions.Host, a.ServerOptions.Port),
+		Listener: listener,
+	}
+	if a.Fast {
+		server := fasthttp.WithConfig(config)
+		server.ReadBufferSize = 30000
+		return server
+	}
+	return standard.WithConfig(config)
+}
+
+//Start the application, returning the error that made the server stop. The app owns the listener of the server,
+//so Stop can close it
+func (a *App) Start() error {
 	l := a.Logger.With(
 		zap.String("operation", "Start"),
 	)
 
 	bind := fmt.Sprintf("%s:%d", a.ServerOptions.Host, a.ServerOptions.Port)
+	a.listenerMu.Lock()
+	if a.Draining() {
+		a.listenerMu.Unlock()
+		return fmt.Errorf("app is stopped")
+	}
+	listener, err := net.Listen("tcp", bind)
+	if err != nil {
+		a.listenerMu.Unlock()
+		return err
+	}
+	a.listener = listener
+	a.Engine = a.newEngine(listener)
+	a.listenerMu.Unlock()
+
 	log.I(l, "Listening for requests.", func(cm log.CM) {
 		cm.Write(zap.String("bind", bind))
 	})
-	a.WebApp.Run(a.Engine)
+	return a.WebApp.Run(a.Engine)
+}
+
+//Draining returns whether the app is being stopped and no longer accepts new hooks
+func (a *App) Draining() bool {
+	return atomic.LoadInt32(&a.draining) == 1
+}
+
+//InFlight returns the number of requests being served
+func (a *App) InFlight() int {
+	return int(atomic.LoadInt64(&a.inFlight))
+}
+
+//Stop makes the app reject new hooks, stops the server from accepting new connections and waits for the requests
+//being served to finish. If ctx is done first, ctx error is returned
+func (a *App) Stop(ctx context.Context) error {
+	l := a.Logger.With(
+		zap.String("operation", "Stop"),
+	)
+
+	a.listenerMu.Lock()
+	atomic.StoreInt32(&a.draining, 1)
+	l.Info("Draining app...", zap.Int("inFlight", a.InFlight()))
+	if a.listener != nil {
+		err := a.listener.Close()
+		if err != nil {
+			a.listenerMu.Unlock()
+			l.Error("Failed to stop listening for requests.", zap.Error(err))
+			return err
+		}
+		a.listener = nil
+	}
+	a.listenerMu.Unlock()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for a.InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			l.Warn("App drain timed out.", zap.Int("inFlight", a.InFlight()))
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	l.Info("App drained successfully.")
+	return nil
 }
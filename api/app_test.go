@@ -8,8 +8,14 @@ package api_test
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
+	"golang.org/x/net/context"
 	"gopkg.in/redis.v4"
 
 	. "github.com/onsi/ginkgo"
@@ -89,6 +95,36 @@ var _ = Describe("App", func() {
 				expected := app.Config.GetString("api.workingText")
 				Expect(expected).To(Equal("WORKING"))
 			})
+
+			It("Should read the queue and redis settings shared with the workers", func() {
+				options := api.DefaultOptions()
+				options.ConfigFile = "../config/test.yaml"
+
+				app, err := api.New(options, logger, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(app.Queue).To(Equal("webhooks"))
+				Expect(app.Config.GetInt("redis.port")).To(Equal(57575))
+			})
+
+			It("Should report every invalid setting", func() {
+				dir, err := ioutil.TempDir("", "santiago-api-config")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(dir)
+				path := filepath.Join(dir, "invalid.yaml")
+				err = ioutil.WriteFile(path, []byte("queue: \"\"\nredis:\n  port: 0\napi:\n  idempotency:\n    ttl: forever\n"), 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				options := api.DefaultOptions()
+				options.ConfigFile = path
+				err = api.CheckConfig(options, logger)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("queue must be a name without spaces"))
+				Expect(err.Error()).To(ContainSubstring("redis.port must be at least 1"))
+				Expect(err.Error()).To(ContainSubstring("api.idempotency.ttl must be a duration"))
+
+				_, err = api.New(options, logger, false)
+				Expect(err).To(HaveOccurred())
+			})
 		})
 
 		Describe("App Submit Hook to Queue", func() {
@@ -106,8 +142,11 @@ var _ = Describe("App", func() {
 					"x": 1,
 				})
 
-				err = app.PublishHook("POST", "http://test.url.com", string(payloadJSON))
+				hookID, err := app.PublishHook("POST", "http://test.url.com", string(payloadJSON), map[string]string{
+					"Content-Type": "application/json",
+				})
 				Expect(err).NotTo(HaveOccurred())
+				Expect(hookID).NotTo(BeEmpty())
 
 				res, err := testClient.BLPop(100*time.Millisecond, queueID).Result()
 				Expect(err).NotTo(HaveOccurred())
@@ -119,9 +158,11 @@ var _ = Describe("App", func() {
 				err = json.Unmarshal([]byte(res[1]), &hook)
 				Expect(err).NotTo(HaveOccurred())
 
+				Expect(hook["id"]).To(Equal(hookID))
 				Expect(hook["attempts"]).To(BeEquivalentTo(0))
 				Expect(hook["method"]).To(BeEquivalentTo("POST"))
 				Expect(hook["url"]).To(BeEquivalentTo("http://test.url.com"))
+				Expect(hook["headers"]).To(HaveKeyWithValue("Content-Type", "application/json"))
 
 				var payload map[string]interface{}
 				err = json.Unmarshal([]byte(hook["payload"].(string)), &payload)
@@ -130,5 +171,68 @@ var _ = Describe("App", func() {
 				Expect(payload["x"]).To(BeEquivalentTo(1))
 			})
 		})
+
+		Describe("App Stop", func() {
+			It("Should stop accepting new hooks", func() {
+				app, err := GetDefaultTestApp(logger)
+				Expect(err).NotTo(HaveOccurred())
+				app.Queue = uuid.NewV4().String()
+
+				err = app.Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(app.Draining()).To(BeTrue())
+
+				status, _ := Post(app, "/hooks?method=POST&url=http://test.url.com", "{}")
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+
+				total, err := testClient.LLen(app.Queue).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(total).To(BeEquivalentTo(0))
+			})
+
+			It("Should stop listening for new connections", func() {
+				options := api.DefaultOptions()
+				options.ConfigFile = "../config/test.yaml"
+				options.Host = "127.0.0.1"
+				options.Port = 58585
+				app, err := api.New(options, logger, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				errs := make(chan error, 1)
+				go func() {
+					errs <- app.Start()
+				}()
+				Eventually(func() error {
+					conn, err := net.Dial("tcp", "127.0.0.1:58585")
+					if err == nil {
+						conn.Close()
+					}
+					return err
+				}).Should(BeNil())
+
+				err = app.Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				select {
+				case <-errs:
+				case <-time.After(time.Second):
+					Fail("server did not stop")
+				}
+				_, err = net.Dial("tcp", "127.0.0.1:58585")
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("Should keep serving read requests", func() {
+				app, err := GetDefaultTestApp(logger)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = app.Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				status, _ := Get(app, "/status")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(app.InFlight()).To(Equal(0))
+			})
+		})
 	})
 })
@@ -0,0 +1,122 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+//APIKeyHeader is the request header holding the API key of the client, that may also be sent as a bearer token
+const APIKeyHeader = "X-Santiago-Api-Key"
+
+//ConfigAPIKey is an API key set in the configuration file
+type ConfigAPIKey struct {
+	Key    string `mapstructure:"key"`
+	Client string `mapstructure:"client"`
+	Tenant string `mapstructure:"tenant"`
+	Admin  bool   `mapstructure:"admin"`
+}
+
+func (a *App) configureAuth() error {
+	a.AuthEnabled = a.Config.GetBool("api.auth.enabled")
+
+	configKeys := []*ConfigAPIKey{}
+	err := a.Config.UnmarshalKey("api.auth.keys", &configKeys)
+	if err != nil {
+		return err
+	}
+
+	a.ConfigAPIKeys = []*queue.APIKey{}
+	for _, configKey := range configKeys {
+		if configKey.Key == "" || configKey.Client == "" {
+			err := fmt.Errorf("every API key in the configuration must have a key and a client")
+			a.Logger.Error("Invalid authentication configuration.", zap.String("operation", "configureAuth"), zap.Error(err))
+			return err
+		}
+		if configKey.Tenant != "" && !queue.ValidTenant(configKey.Tenant) {
+			err := fmt.Errorf("'%s' is not a valid tenant for an API key", configKey.Tenant)
+			a.Logger.Error("Invalid authentication configuration.", zap.String("operation", "configureAuth"), zap.Error(err))
+			return err
+		}
+		a.ConfigAPIKeys = append(a.ConfigAPIKeys, queue.NewAPIKey(configKey.Key, configKey.Client, configKey.Tenant, configKey.Admin))
+	}
+	return nil
+}
+
+//APIKeys returns the API keys of the app queue stored in Redis
+func (a *App) APIKeys() *queue.APIKeys {
+	return queue.NewAPIKeys(a.Client, a.Queue)
+}
+
+//Authenticate returns the API key with the given key, set in the configuration file or stored in Redis, or nil if it does not exist
+func (a *App) Authenticate(key string) (*queue.APIKey, error) {
+	if key == "" {
+		return nil, nil
+	}
+	for _, apiKey := range a.ConfigAPIKeys {
+		if apiKey.Matches(key) {
+			return apiKey, nil
+		}
+	}
+	return a.APIKeys().Get(key)
+}
+
+//GetRequestAPIKey returns the API key sent in the request, either in the X-Santiago-Api-Key header or as a bearer token
+func GetRequestAPIKey(c echo.Context) string {
+	if key := c.Request().Header().Get(APIKeyHeader); key != "" {
+		return key
+	}
+	authorization := c.Request().Header().Get("Authorization")
+	if len(authorization) > 7 && strings.ToLower(authorization[:7]) == "bearer " {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+//GetRequestTenant returns the tenant hooks of the request belong to: the tenant of its API key, if any, or else the given tenant
+//or the one in the X-Santiago-Tenant header. It fails if the API key tenant differs from the one requested
+func GetRequestTenant(c echo.Context, tenant string) (string, error) {
+	if tenant == "" {
+		tenant = c.Request().Header().Get(TenantHeader)
+	}
+	if keyTenant, ok := c.Get("tenant").(string); ok && keyTenant != "" {
+		if tenant != "" && tenant != keyTenant {
+			return "", fmt.Errorf("The API key can only send hooks of tenant %s", keyTenant)
+		}
+		return keyTenant, nil
+	}
+	return tenant, nil
+}
+
+//GetRequestTenantScope returns the tenant the API key of the request is restricted to, or an empty string
+//if it may access the hooks of every tenant, like admin keys and keys without a tenant
+func GetRequestTenantScope(c echo.Context) string {
+	if admin, ok := c.Get("admin").(bool); ok && admin {
+		return ""
+	}
+	tenant, _ := c.Get("tenant").(string)
+	return tenant
+}
+
+//CanAccessTenant returns whether the API key of the request may access the hooks of the given tenant
+func CanAccessTenant(c echo.Context, tenant string) bool {
+	scope := GetRequestTenantScope(c)
+	return scope == "" || scope == tenant
+}
+
+//GetRequestClient returns the client identity of the authenticated request or an empty string
+func GetRequestClient(c echo.Context) string {
+	if client, ok := c.Get("client").(string); ok {
+		return client
+	}
+	return ""
+}
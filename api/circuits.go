@@ -0,0 +1,77 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/labstack/echo"
+	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+// ListCircuitsHandler lists the circuits of the destination hosts with failures or open circuits
+func ListCircuitsHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		l := app.Logger.With(
+			zap.String("source", "listCircuitsHandler"),
+			zap.String("queue", app.Queue),
+		)
+
+		var circuits []*queue.Circuit
+		var err error
+		err = WithSegment("list-circuits", c, func() error {
+			circuits, err = app.CircuitBreaker().List()
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to list circuits.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to list circuits (%s).", err.Error()), c)
+		}
+
+		open := 0
+		for _, circuit := range circuits {
+			if circuit.State != queue.CircuitClosed {
+				open++
+			}
+		}
+
+		log.D(l, "Circuits listed successfully.")
+		return SucceedWith(map[string]interface{}{
+			"circuits": circuits,
+			"open":     open,
+		}, c)
+	}
+}
+
+// GetCircuitHandler returns the circuit of a destination host
+func GetCircuitHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		host := c.Param("host")
+		l := app.Logger.With(
+			zap.String("source", "getCircuitHandler"),
+			zap.String("queue", app.Queue),
+			zap.String("host", host),
+		)
+
+		var circuit *queue.Circuit
+		var err error
+		err = WithSegment("get-circuit", c, func() error {
+			circuit, err = app.CircuitBreaker().Get(host)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to retrieve circuit.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to retrieve circuit (%s).", err.Error()), c)
+		}
+
+		return SucceedWith(map[string]interface{}{
+			"circuit": circuit,
+		}, c)
+	}
+}
@@ -0,0 +1,69 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/queue"
+	. "github.com/topfreegames/santiago/testing"
+)
+
+var _ = Describe("Circuits Handlers", func() {
+	var logger *MockLogger
+
+	BeforeEach(func() {
+		logger = NewMockLogger()
+	})
+
+	It("should list circuits with failures", func() {
+		app, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		app.Queue = uuid.NewV4().String()
+
+		breaker := queue.NewCircuitBreaker(app.Client, app.Queue, 1, 0)
+		_, err = breaker.RecordFailure("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+
+		status, body := Get(app, "/circuits")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var result map[string]interface{}
+		err = json.Unmarshal([]byte(body), &result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["success"]).To(BeTrue())
+		Expect(result["open"]).To(BeEquivalentTo(1))
+
+		circuits := result["circuits"].([]interface{})
+		Expect(circuits).To(HaveLen(1))
+		circuit := circuits[0].(map[string]interface{})
+		Expect(circuit["host"]).To(Equal("partner.com"))
+		Expect(circuit["state"]).To(Equal(queue.CircuitOpen))
+		Expect(circuit["failures"]).To(BeEquivalentTo(1))
+	})
+
+	It("should get closed circuit of host without failures", func() {
+		app, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		app.Queue = uuid.NewV4().String()
+
+		status, body := Get(app, "/circuits/partner.com")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var result map[string]interface{}
+		err = json.Unmarshal([]byte(body), &result)
+		Expect(err).NotTo(HaveOccurred())
+
+		circuit := result["circuit"].(map[string]interface{})
+		Expect(circuit["host"]).To(Equal("partner.com"))
+		Expect(circuit["state"]).To(Equal(queue.CircuitClosed))
+	})
+})
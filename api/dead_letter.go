@@ -0,0 +1,208 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+func getIntQueryParam(c echo.Context, name string, defaultValue int64) (int64, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// ListDeadLettersHandler lists the hooks that exhausted their delivery attempts, only of its tenant for API keys restricted to one
+func ListDeadLettersHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		l := app.Logger.With(
+			zap.String("source", "listDeadLettersHandler"),
+			zap.String("queue", app.Queue),
+		)
+
+		offset, err := getIntQueryParam(c, "offset", 0)
+		if err != nil || offset < 0 {
+			return FailWith(http.StatusBadRequest, "The 'offset' querystring parameter must be a non-negative integer", c)
+		}
+		limit, err := getIntQueryParam(c, "limit", 20)
+		if err != nil || limit < 1 || limit > 100 {
+			return FailWith(http.StatusBadRequest, "The 'limit' querystring parameter must be an integer between 1 and 100", c)
+		}
+
+		var letters []*queue.DeadLetter
+		var total int64
+		err = WithSegment("list-dead-letters", c, func() error {
+			dlq := app.DeadLetterQueue()
+			if tenant := GetRequestTenantScope(c); tenant != "" {
+				letters, err = dlq.ListTenant(tenant, offset, limit)
+				if err != nil {
+					return err
+				}
+				total, err = dlq.CountTenant(tenant)
+				return err
+			}
+			letters, err = dlq.List(offset, limit)
+			if err != nil {
+				return err
+			}
+			total, err = dlq.Count()
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to list dead letters.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to list dead letters (%s).", err.Error()), c)
+		}
+
+		log.D(l, "Dead letters listed successfully.")
+		return SucceedWith(map[string]interface{}{
+			"deadLetters": letters,
+			"total":       total,
+		}, c)
+	}
+}
+
+// GetDeadLetterHandler returns a single dead letter
+func GetDeadLetterHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		l := app.Logger.With(
+			zap.String("source", "getDeadLetterHandler"),
+			zap.String("queue", app.Queue),
+			zap.String("deadLetterID", id),
+		)
+
+		var letter *queue.DeadLetter
+		var err error
+		err = WithSegment("get-dead-letter", c, func() error {
+			letter, err = app.DeadLetterQueue().Get(id)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to retrieve dead letter.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to retrieve dead letter (%s).", err.Error()), c)
+		}
+		if letter == nil || !CanAccessTenant(c, letter.Tenant) {
+			return FailWith(http.StatusNotFound, "Dead letter not found.", c)
+		}
+
+		return SucceedWith(map[string]interface{}{
+			"deadLetter": letter,
+		}, c)
+	}
+}
+
+// DeleteDeadLetterHandler discards a dead letter
+func DeleteDeadLetterHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		l := app.Logger.With(
+			zap.String("source", "deleteDeadLetterHandler"),
+			zap.String("queue", app.Queue),
+			zap.String("deadLetterID", id),
+		)
+
+		var letter *queue.DeadLetter
+		var err error
+		err = WithSegment("get-dead-letter", c, func() error {
+			letter, err = app.DeadLetterQueue().Get(id)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to retrieve dead letter.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to retrieve dead letter (%s).", err.Error()), c)
+		}
+		if letter == nil || !CanAccessTenant(c, letter.Tenant) {
+			return FailWith(http.StatusNotFound, "Dead letter not found.", c)
+		}
+
+		var found bool
+		err = WithSegment("delete-dead-letter", c, func() error {
+			found, err = app.DeadLetterQueue().Delete(letter)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to delete dead letter.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to delete dead letter (%s).", err.Error()), c)
+		}
+		if !found {
+			return FailWith(http.StatusNotFound, "Dead letter not found.", c)
+		}
+
+		log.I(l, "Dead letter deleted successfully.")
+		return SucceedWith(map[string]interface{}{}, c)
+	}
+}
+
+// ReplayDeadLetterHandler sends a dead letter back to the queue of its tenant with its attempts reset, within the tenant quota
+func ReplayDeadLetterHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		l := app.Logger.With(
+			zap.String("source", "replayDeadLetterHandler"),
+			zap.String("queue", app.Queue),
+			zap.String("deadLetterID", id),
+		)
+
+		var letter *queue.DeadLetter
+		var err error
+		err = WithSegment("get-dead-letter", c, func() error {
+			letter, err = app.DeadLetterQueue().Get(id)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to retrieve dead letter.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to retrieve dead letter (%s).", err.Error()), c)
+		}
+		if letter == nil || !CanAccessTenant(c, letter.Tenant) {
+			return FailWith(http.StatusNotFound, "Dead letter not found.", c)
+		}
+
+		var exceeded map[int]*queue.QuotaError
+		err = WithSegment("reserve-quotas", c, func() error {
+			exceeded, err = app.ReserveQuotas([]map[string]interface{}{letter.Message()})
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to check tenant quota.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to check tenant quota (%s).", err.Error()), c)
+		}
+		if quotaErr, ok := exceeded[0]; ok {
+			return FailWithQuota(quotaErr, c)
+		}
+
+		var found bool
+		err = WithSegment("replay-dead-letter", c, func() error {
+			found, err = app.DeadLetterQueue().Replay(letter)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to replay dead letter.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to replay dead letter (%s).", err.Error()), c)
+		}
+		if !found {
+			return FailWith(http.StatusNotFound, "Dead letter not found.", c)
+		}
+
+		//the hook is sent again with the same ID, so its delivery starts over
+		err = app.Deliveries().Save(queue.NewPendingDelivery(letter.Message()))
+		if err != nil {
+			l.Error("Failed to reset hook delivery.", zap.Error(err))
+		}
+
+		log.I(l, "Dead letter replayed successfully.")
+		return SucceedWith(map[string]interface{}{}, c)
+	}
+}
@@ -0,0 +1,198 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/api"
+	"github.com/topfreegames/santiago/queue"
+	. "github.com/topfreegames/santiago/testing"
+)
+
+func addDeadLetter(app *api.App, failedAt int64) *queue.DeadLetter {
+	letter := &queue.DeadLetter{
+		ID:             uuid.NewV4().String(),
+		Method:         "POST",
+		URL:            "http://test.com/hook",
+		Payload:        "{\"x\":1}",
+		Attempts:       11,
+		LastStatusCode: 500,
+		LastError:      "Error requesting webhook. Status code: 500",
+		FailedAt:       failedAt,
+	}
+	err := app.DeadLetterQueue().Add(letter)
+	Expect(err).NotTo(HaveOccurred())
+	return letter
+}
+
+var _ = Describe("Dead Letter Handlers", func() {
+	var logger *MockLogger
+	var testClient *redis.Client
+	var app *api.App
+
+	BeforeEach(func() {
+		logger = NewMockLogger()
+		cli, err := GetTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+
+		app, err = GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		app.Queue = uuid.NewV4().String()
+	})
+
+	Describe("List Dead Letters Handler", func() {
+		It("should list dead letters", func() {
+			for i := int64(1); i <= 3; i++ {
+				addDeadLetter(app, i)
+			}
+
+			status, body := Get(app, "/deadletters?limit=2")
+			Expect(status).To(Equal(http.StatusOK))
+
+			var obj map[string]interface{}
+			err := json.Unmarshal([]byte(body), &obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(obj["success"]).To(BeTrue())
+			Expect(obj["total"]).To(BeEquivalentTo(3))
+
+			letters := obj["deadLetters"].([]interface{})
+			Expect(letters).To(HaveLen(2))
+			Expect(letters[0].(map[string]interface{})["failedAt"]).To(BeEquivalentTo(3))
+		})
+
+		It("should fail with invalid limit", func() {
+			status, _ := Get(app, "/deadletters?limit=qwe")
+			Expect(status).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("Get Dead Letter Handler", func() {
+		It("should get dead letter", func() {
+			letter := addDeadLetter(app, time.Now().Unix())
+
+			status, body := Get(app, fmt.Sprintf("/deadletters/%s", letter.ID))
+			Expect(status).To(Equal(http.StatusOK))
+
+			var obj map[string]interface{}
+			err := json.Unmarshal([]byte(body), &obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			stored := obj["deadLetter"].(map[string]interface{})
+			Expect(stored["id"]).To(Equal(letter.ID))
+			Expect(stored["url"]).To(Equal("http://test.com/hook"))
+			Expect(stored["lastStatusCode"]).To(BeEquivalentTo(500))
+		})
+
+		It("should return 404 for unknown dead letter", func() {
+			status, _ := Get(app, fmt.Sprintf("/deadletters/%s", uuid.NewV4().String()))
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Delete Dead Letter Handler", func() {
+		It("should delete dead letter", func() {
+			letter := addDeadLetter(app, time.Now().Unix())
+
+			status, _ := Delete(app, fmt.Sprintf("/deadletters/%s", letter.ID))
+			Expect(status).To(Equal(http.StatusOK))
+
+			stored, err := app.DeadLetterQueue().Get(letter.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(BeNil())
+
+			status, _ = Delete(app, fmt.Sprintf("/deadletters/%s", letter.ID))
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Replay Dead Letter Handler", func() {
+		It("should replay dead letter", func() {
+			letter := addDeadLetter(app, time.Now().Unix())
+
+			status, _ := Post(app, fmt.Sprintf("/deadletters/%s/replay", letter.ID), "")
+			Expect(status).To(Equal(http.StatusOK))
+
+			res, err := testClient.LRange(app.Queue, 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(res[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["attempts"]).To(BeEquivalentTo(0))
+			Expect(hook["url"]).To(Equal("http://test.com/hook"))
+
+			delivery, err := app.Deliveries().Get(letter.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delivery.Status).To(Equal(queue.DeliveryPending))
+			Expect(delivery.Attempts).To(Equal(0))
+
+			status, _ = Post(app, fmt.Sprintf("/deadletters/%s/replay", letter.ID), "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Tenants", func() {
+		var headers map[string]string
+		var own, other *queue.DeadLetter
+
+		BeforeEach(func() {
+			key := uuid.NewV4().String()
+			app.AuthEnabled = true
+			app.ConfigAPIKeys = []*queue.APIKey{queue.NewAPIKey(key, "partner", "partner-a", false)}
+			headers = map[string]string{api.APIKeyHeader: key}
+
+			own = &queue.DeadLetter{ID: uuid.NewV4().String(), Method: "POST", URL: "http://test.com/hook", Tenant: "partner-a", FailedAt: 2}
+			other = &queue.DeadLetter{ID: uuid.NewV4().String(), Method: "POST", URL: "http://test.com/hook", Tenant: "partner-b", FailedAt: 1}
+			for _, letter := range []*queue.DeadLetter{own, other} {
+				err := app.DeadLetterQueue().Add(letter)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("should only list dead letters of the API key tenant", func() {
+			status, body := GetWithHeaders(app, "/deadletters", headers)
+			Expect(status).To(Equal(http.StatusOK))
+
+			var obj map[string]interface{}
+			err := json.Unmarshal([]byte(body), &obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(obj["total"]).To(BeEquivalentTo(1))
+			letters := obj["deadLetters"].([]interface{})
+			Expect(letters).To(HaveLen(1))
+			Expect(letters[0].(map[string]interface{})["id"]).To(Equal(own.ID))
+		})
+
+		It("should not give access to dead letters of other tenants", func() {
+			status, _ := GetWithHeaders(app, fmt.Sprintf("/deadletters/%s", other.ID), headers)
+			Expect(status).To(Equal(http.StatusNotFound))
+
+			status, _ = PostJSONWithHeaders(app, fmt.Sprintf("/deadletters/%s/replay", other.ID), map[string]interface{}{}, headers)
+			Expect(status).To(Equal(http.StatusNotFound))
+
+			status, _ = DeleteWithHeaders(app, fmt.Sprintf("/deadletters/%s", other.ID), headers)
+			Expect(status).To(Equal(http.StatusNotFound))
+
+			stored, err := app.DeadLetterQueue().Get(other.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).NotTo(BeNil())
+
+			status, _ = DeleteWithHeaders(app, fmt.Sprintf("/deadletters/%s", own.ID), headers)
+			Expect(status).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,46 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+// GetHookHandler returns the delivery status of a hook
+func GetHookHandler(app *App) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		l := app.Logger.With(
+			zap.String("source", "getHookHandler"),
+			zap.String("queue", app.Queue),
+			zap.String("hookID", id),
+		)
+
+		var delivery *queue.Delivery
+		var err error
+		err = WithSegment("get-delivery", c, func() error {
+			delivery, err = app.Deliveries().Get(id)
+			return err
+		})
+		if err != nil {
+			l.Error("Failed to retrieve hook delivery.", zap.Error(err))
+			return FailWith(500, fmt.Sprintf("Failed to retrieve hook delivery (%s).", err.Error()), c)
+		}
+		if delivery == nil || !CanAccessTenant(c, delivery.Tenant) {
+			return FailWith(http.StatusNotFound, "Hook not found.", c)
+		}
+
+		return SucceedWith(map[string]interface{}{
+			"hook": delivery,
+		}, c)
+	}
+}
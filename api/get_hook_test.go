@@ -0,0 +1,118 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/api"
+	"github.com/topfreegames/santiago/queue"
+	. "github.com/topfreegames/santiago/testing"
+)
+
+var _ = Describe("Get Hook Handler", func() {
+	var logger *MockLogger
+
+	BeforeEach(func() {
+		logger = NewMockLogger()
+	})
+
+	It("should return pending delivery of published hook", func() {
+		app, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		app.Queue = uuid.NewV4().String()
+
+		hookID, err := app.PublishHook("POST", "http://test.com/hook", "{\"x\":1}", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		status, body := Get(app, fmt.Sprintf("/hooks/%s", hookID))
+		Expect(status).To(Equal(http.StatusOK))
+
+		var result map[string]interface{}
+		err = json.Unmarshal([]byte(body), &result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result["success"]).To(BeTrue())
+
+		hook := result["hook"].(map[string]interface{})
+		Expect(hook["id"]).To(Equal(hookID))
+		Expect(hook["method"]).To(Equal("POST"))
+		Expect(hook["url"]).To(Equal("http://test.com/hook"))
+		Expect(hook["status"]).To(Equal(queue.DeliveryPending))
+		Expect(hook["attempts"]).To(BeEquivalentTo(0))
+		Expect(hook["createdAt"]).To(BeNumerically(">", 0))
+	})
+
+	It("should return delivery updated by the workers", func() {
+		app, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		app.Queue = uuid.NewV4().String()
+
+		hookID := uuid.NewV4().String()
+		err = app.Deliveries().Save(&queue.Delivery{
+			ID:             hookID,
+			Method:         "POST",
+			URL:            "http://test.com/hook",
+			Status:         queue.DeliveryFailed,
+			Attempts:       3,
+			LastStatusCode: 500,
+			LastResponse:   "Internal Server Error",
+			LastError:      "Error requesting webhook. Status code: 500",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, body := Get(app, fmt.Sprintf("/hooks/%s", hookID))
+		Expect(status).To(Equal(http.StatusOK))
+
+		var result map[string]interface{}
+		err = json.Unmarshal([]byte(body), &result)
+		Expect(err).NotTo(HaveOccurred())
+
+		hook := result["hook"].(map[string]interface{})
+		Expect(hook["status"]).To(Equal(queue.DeliveryFailed))
+		Expect(hook["attempts"]).To(BeEquivalentTo(3))
+		Expect(hook["lastStatusCode"]).To(BeEquivalentTo(500))
+		Expect(hook["lastResponse"]).To(Equal("Internal Server Error"))
+	})
+
+	It("should return 404 for unknown hook", func() {
+		app, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := Get(app, fmt.Sprintf("/hooks/%s", uuid.NewV4().String()))
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should restrict API keys of a tenant to its own hooks", func() {
+		app, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		app.Queue = uuid.NewV4().String()
+		app.AuthEnabled = true
+		key := uuid.NewV4().String()
+		app.ConfigAPIKeys = []*queue.APIKey{queue.NewAPIKey(key, "partner", "partner-a", false)}
+
+		hookID := uuid.NewV4().String()
+		err = app.Deliveries().Save(&queue.Delivery{
+			ID:     hookID,
+			Method: "POST",
+			URL:    "http://test.com/hook",
+			Tenant: "partner-b",
+			Status: queue.DeliveryPending,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := GetWithHeaders(app, fmt.Sprintf("/hooks/%s", hookID), map[string]string{api.APIKeyHeader: key})
+		Expect(status).To(Equal(http.StatusNotFound))
+
+		status, _ = GetWithHeaders(app, "/status", map[string]string{api.APIKeyHeader: key})
+		Expect(status).To(Equal(http.StatusForbidden))
+	})
+})
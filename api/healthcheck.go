@@ -19,6 +19,10 @@ func HealthCheckHandler(app *App) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		app.Logger.Debug("Starting healthcheck...")
 
+		if app.Draining() {
+			return c.String(http.StatusServiceUnavailable, "Draining")
+		}
+
 		_, err := app.Client.Ping().Result()
 		if err != nil {
 			app.Logger.Error("Healthcheck failed", zap.Error(err))
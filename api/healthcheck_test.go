@@ -9,6 +9,8 @@ package api_test
 import (
 	"net/http"
 
+	"golang.org/x/net/context"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/topfreegames/santiago/testing"
@@ -40,4 +42,16 @@ var _ = Describe("Healthcheck Handler", func() {
 		Expect(status).To(Equal(http.StatusOK))
 		Expect(body).To(Equal("OTHERWORKING"))
 	})
+
+	It("Should respond with service unavailable while draining", func() {
+		a, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = a.Stop(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		status, body := Get(a, "/healthcheck")
+
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(Equal("Draining"))
+	})
 })
@@ -9,6 +9,8 @@ package api
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"strings"
 
 	"github.com/labstack/echo"
 	newrelic "github.com/newrelic/go-agent"
@@ -23,6 +25,13 @@ func FailWith(status int, message string, c echo.Context) error {
 	return c.String(status, string(result))
 }
 
+// SucceedWith sends payload to user with status 200
+func SucceedWith(payload map[string]interface{}, c echo.Context) error {
+	payload["success"] = true
+	result, _ := json.Marshal(payload)
+	return c.String(http.StatusOK, string(result))
+}
+
 //GetRequestBody from echo context
 func GetRequestBody(c echo.Context) (string, error) {
 	bodyCache := c.Get("requestBody")
@@ -38,6 +47,22 @@ func GetRequestBody(c echo.Context) (string, error) {
 	return string(b), nil
 }
 
+//ForwardedHeaderPrefix is the prefix of request headers that are forwarded with the hook, without the prefix
+const ForwardedHeaderPrefix = "X-Santiago-Header-"
+
+//GetForwardedHeaders returns the request headers to be forwarded with the hook
+func GetForwardedHeaders(c echo.Context) map[string]string {
+	headers := map[string]string{}
+	prefix := strings.ToLower(ForwardedHeaderPrefix)
+	for _, key := range c.Request().Header().Keys() {
+		if !strings.HasPrefix(strings.ToLower(key), prefix) || len(key) == len(prefix) {
+			continue
+		}
+		headers[key[len(prefix):]] = c.Request().Header().Get(key)
+	}
+	return headers
+}
+
 //GetRequestJSON as the specified interface from echo context
 func GetRequestJSON(payloadStruct interface{}, c echo.Context) error {
 	body, err := GetRequestBody(c)
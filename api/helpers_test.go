@@ -55,12 +55,17 @@ func GetDefaultTestApp(logger zap.Logger) (*api.App, error) {
 
 //Get from server
 func Get(app *api.App, url string) (int, string) {
-	return doRequest(app, "GET", url, "")
+	return doRequest(app, "GET", url, "", nil)
+}
+
+//GetWithHeaders from server
+func GetWithHeaders(app *api.App, url string, headers map[string]string) (int, string) {
+	return doRequest(app, "GET", url, "", headers)
 }
 
 //Post to server
 func Post(app *api.App, url, body string) (int, string) {
-	return doRequest(app, "POST", url, body)
+	return doRequest(app, "POST", url, body, nil)
 }
 
 //PostJSON to server
@@ -72,9 +77,18 @@ func PostJSON(app *api.App, url string, body interface{}) (int, string) {
 	return Post(app, url, string(result))
 }
 
+//PostJSONWithHeaders to server
+func PostJSONWithHeaders(app *api.App, url string, body interface{}, headers map[string]string) (int, string) {
+	result, err := json.Marshal(body)
+	if err != nil {
+		return 510, "Failed to marshal specified body to JSON format"
+	}
+	return doRequest(app, "POST", url, string(result), headers)
+}
+
 //Put to server
 func Put(app *api.App, url, body string) (int, string) {
-	return doRequest(app, "PUT", url, body)
+	return doRequest(app, "PUT", url, body, nil)
 }
 
 //PutJSON to server
@@ -88,7 +102,12 @@ func PutJSON(app *api.App, url string, body interface{}) (int, string) {
 
 //Delete from server
 func Delete(app *api.App, url string) (int, string) {
-	return doRequest(app, "DELETE", url, "")
+	return doRequest(app, "DELETE", url, "", nil)
+}
+
+//DeleteWithHeaders from server
+func DeleteWithHeaders(app *api.App, url string, headers map[string]string) (int, string) {
+	return doRequest(app, "DELETE", url, "", headers)
 }
 
 var client *http.Client
@@ -101,7 +120,7 @@ func initClient() {
 	}
 }
 
-func doRequest(app *api.App, method, url, body string) (int, string) {
+func doRequest(app *api.App, method, url, body string, headers map[string]string) (int, string) {
 	initClient()
 	defer transport.CloseIdleConnections()
 	app.Engine.SetHandler(app.WebApp)
@@ -113,6 +132,9 @@ func doRequest(app *api.App, method, url, body string) (int, string) {
 	}
 	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", ts.URL, url), bodyBuff)
 	req.Header.Set("Connection", "close")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 	req.Close = true
 	Expect(err).NotTo(HaveOccurred())
 
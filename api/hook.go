@@ -0,0 +1,154 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/queue"
+)
+
+//MaxHookTimeoutMs is the maximum request timeout a hook may ask for
+const MaxHookTimeoutMs = 5 * 60 * 1000
+
+//MaxBatchSize is the maximum number of hooks that can be sent in a single batch
+const MaxBatchSize = 1000
+
+//MaxIdempotencyKeyLength is the maximum length of the idempotency key of a hook
+const MaxIdempotencyKeyLength = 255
+
+var validMethods = map[string]bool{
+	"GET":     true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"HEAD":    true,
+	"OPTIONS": true,
+}
+
+//Hook is the definition of a web hook to be dispatched
+type Hook struct {
+	Method         string             `json:"method"`
+	URL            string             `json:"url"`
+	Headers        map[string]string  `json:"headers"`
+	Payload        json.RawMessage    `json:"payload"`
+	ExpiresAt      int64              `json:"expiresAt"`
+	MaxAttempts    int                `json:"maxAttempts"`
+	TimeoutMs      int64              `json:"timeoutMs"`
+	Tags           map[string]string  `json:"tags"`
+	IdempotencyKey string             `json:"idempotencyKey"`
+	Tenant         string             `json:"tenant"`
+	Priority       string             `json:"priority"`
+	Retry          *queue.RetryConfig `json:"retry"`
+}
+
+//Validate returns an error describing the first invalid field of the hook
+func (h *Hook) Validate() error {
+	h.Method = strings.ToUpper(h.Method)
+	if !validMethods[h.Method] {
+		return fmt.Errorf("'method' must be one of GET, POST, PUT, PATCH, DELETE, HEAD or OPTIONS")
+	}
+
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("'url' must be an absolute http or https URL")
+	}
+
+	if h.ExpiresAt < 0 || (h.ExpiresAt > 0 && h.ExpiresAt <= time.Now().Unix()) {
+		return fmt.Errorf("'expiresAt' must be a unix timestamp in the future")
+	}
+
+	if h.MaxAttempts < 0 {
+		return fmt.Errorf("'maxAttempts' must not be negative")
+	}
+
+	if h.TimeoutMs < 0 || h.TimeoutMs > MaxHookTimeoutMs {
+		return fmt.Errorf("'timeoutMs' must be between 0 and %d", MaxHookTimeoutMs)
+	}
+
+	if len(h.IdempotencyKey) > MaxIdempotencyKeyLength {
+		return fmt.Errorf("'idempotencyKey' must have at most %d characters", MaxIdempotencyKeyLength)
+	}
+
+	if h.Tenant != "" && !queue.ValidTenant(h.Tenant) {
+		return fmt.Errorf("'tenant' must have at most %d letters, digits, dots, dashes or underscores", queue.MaxTenantLength)
+	}
+
+	h.Priority = strings.ToLower(h.Priority)
+	if h.Priority != "" && !queue.ValidPriority(h.Priority) {
+		return fmt.Errorf("'priority' must be one of high, normal or low")
+	}
+
+	if h.Retry != nil {
+		err := h.Retry.Validate()
+		if err != nil {
+			return fmt.Errorf("'retry' is invalid: %s", err)
+		}
+	}
+
+	return nil
+}
+
+//GetPayload returns the body to be sent to the web hook. JSON strings are sent unquoted, any other JSON value as is
+func (h *Hook) GetPayload() string {
+	if len(h.Payload) == 0 || string(h.Payload) == "null" {
+		return ""
+	}
+
+	var payload string
+	err := json.Unmarshal(h.Payload, &payload)
+	if err == nil {
+		return payload
+	}
+	return string(h.Payload)
+}
+
+//ToMessage returns the queue message the workers consume to dispatch the hook, identified by a new hook ID
+func (h *Hook) ToMessage() map[string]interface{} {
+	data := map[string]interface{}{
+		"id":        uuid.NewV4().String(),
+		"method":    h.Method,
+		"url":       h.URL,
+		"payload":   h.GetPayload(),
+		"attempts":  0,
+		"createdAt": time.Now().Unix(),
+	}
+	if len(h.Headers) > 0 {
+		data["headers"] = h.Headers
+	}
+	if h.ExpiresAt > 0 {
+		data["expires"] = h.ExpiresAt
+	}
+	if h.MaxAttempts > 0 {
+		data["maxAttempts"] = h.MaxAttempts
+	}
+	if h.TimeoutMs > 0 {
+		data["timeoutMs"] = h.TimeoutMs
+	}
+	if len(h.Tags) > 0 {
+		data["tags"] = h.Tags
+	}
+	if h.IdempotencyKey != "" {
+		data["idempotencyKey"] = h.IdempotencyKey
+	}
+	if h.Tenant != "" {
+		data["tenant"] = h.Tenant
+	}
+	if h.Priority != "" {
+		data["priority"] = h.Priority
+	}
+	if h.Retry != nil {
+		data["retry"] = h.Retry
+	}
+	return data
+}
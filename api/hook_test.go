@@ -0,0 +1,126 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/topfreegames/santiago/api"
+	"github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Hook", func() {
+	getValidHook := func() *Hook {
+		return &Hook{
+			Method:  "post",
+			URL:     "http://test.com/hook",
+			Payload: json.RawMessage(`{"qwe":123}`),
+		}
+	}
+
+	Describe("Validate", func() {
+		It("should accept valid hook and normalize method", func() {
+			hook := getValidHook()
+			Expect(hook.Validate()).NotTo(HaveOccurred())
+			Expect(hook.Method).To(Equal("POST"))
+		})
+
+		It("should fail with invalid method", func() {
+			hook := getValidHook()
+			hook.Method = "SEND"
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'method'")))
+		})
+
+		It("should fail with relative or non-http url", func() {
+			hook := getValidHook()
+			hook.URL = "/hook"
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'url'")))
+
+			hook.URL = "ftp://test.com/hook"
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'url'")))
+		})
+
+		It("should fail with expiration in the past", func() {
+			hook := getValidHook()
+			hook.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'expiresAt'")))
+		})
+
+		It("should fail with negative max attempts", func() {
+			hook := getValidHook()
+			hook.MaxAttempts = -1
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'maxAttempts'")))
+		})
+
+		It("should fail with timeout out of bounds", func() {
+			hook := getValidHook()
+			hook.TimeoutMs = MaxHookTimeoutMs + 1
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'timeoutMs'")))
+		})
+
+		It("should fail with invalid retry policy", func() {
+			hook := getValidHook()
+			hook.Retry = &queue.RetryConfig{Policy: "random"}
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'retry'")))
+
+			hook.Retry = &queue.RetryConfig{Policy: queue.RetryFixed}
+			Expect(hook.Validate()).To(MatchError(ContainSubstring("'scheduleMs'")))
+		})
+	})
+
+	Describe("GetPayload", func() {
+		It("should return JSON documents as is", func() {
+			hook := getValidHook()
+			Expect(hook.GetPayload()).To(Equal(`{"qwe":123}`))
+		})
+
+		It("should unquote JSON strings", func() {
+			hook := getValidHook()
+			hook.Payload = json.RawMessage(`"a=1&b=2"`)
+			Expect(hook.GetPayload()).To(Equal("a=1&b=2"))
+		})
+
+		It("should return empty payload if none", func() {
+			hook := getValidHook()
+			hook.Payload = nil
+			Expect(hook.GetPayload()).To(Equal(""))
+
+			hook.Payload = json.RawMessage("null")
+			Expect(hook.GetPayload()).To(Equal(""))
+		})
+	})
+
+	Describe("ToMessage", func() {
+		It("should only include options that were set", func() {
+			hook := getValidHook()
+			msg := hook.ToMessage()
+			Expect(msg).To(HaveKeyWithValue("method", "post"))
+			Expect(msg).To(HaveKeyWithValue("url", "http://test.com/hook"))
+			Expect(msg).To(HaveKeyWithValue("payload", `{"qwe":123}`))
+			Expect(msg).To(HaveKeyWithValue("attempts", 0))
+			Expect(msg).To(HaveKey("createdAt"))
+			Expect(msg).NotTo(HaveKey("headers"))
+			Expect(msg).NotTo(HaveKey("expires"))
+			Expect(msg).NotTo(HaveKey("maxAttempts"))
+			Expect(msg).NotTo(HaveKey("timeoutMs"))
+			Expect(msg).NotTo(HaveKey("tags"))
+			Expect(msg).NotTo(HaveKey("retry"))
+		})
+
+		It("should include retry policy", func() {
+			hook := getValidHook()
+			hook.Retry = &queue.RetryConfig{Policy: queue.RetryLinear, BaseMs: 1000}
+			Expect(hook.Validate()).NotTo(HaveOccurred())
+
+			msg := hook.ToMessage()
+			Expect(msg).To(HaveKeyWithValue("retry", hook.Retry))
+		})
+	})
+})
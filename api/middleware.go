@@ -9,7 +9,10 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"runtime/debug"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/getsentry/raven-go"
@@ -166,14 +169,14 @@ func (l *LoggerMiddleware) Serve(next echo.HandlerFunc) echo.HandlerFunc {
 		status = c.Response().Status()
 		ip = c.Request().RemoteAddress()
 
-		route := c.Get("route")
-		if route == nil {
-			log.Debug("Route does not have route set in ctx")
-			return err
+		//routes without a name set in ctx are logged by their path
+		route, ok := c.Get("route").(string)
+		if !ok {
+			route = path
 		}
 
 		reqLog := log.With(
-			zap.String("route", route.(string)),
+			zap.String("route", route),
 			zap.Time("endTime", endTime),
 			zap.Int("statusCode", status),
 			zap.Duration("latency", latency),
@@ -181,6 +184,9 @@ func (l *LoggerMiddleware) Serve(next echo.HandlerFunc) echo.HandlerFunc {
 			zap.String("method", method),
 			zap.String("path", path),
 		)
+		if client := GetRequestClient(c); client != "" {
+			reqLog = reqLog.With(zap.String("client", client))
+		}
 
 		//request failed
 		if status > 399 && status < 500 {
@@ -234,3 +240,80 @@ func (nr *NewRelicMiddleware) Serve(next echo.HandlerFunc) echo.HandlerFunc {
 		return nil
 	}
 }
+
+//NewDrainingMiddleware returns a new draining middleware
+func NewDrainingMiddleware(app *App) *DrainingMiddleware {
+	return &DrainingMiddleware{
+		App: app,
+	}
+}
+
+//DrainingMiddleware keeps track of the requests being served and, once the app is stopping,
+//rejects requests that would publish new hooks (all POST routes)
+type DrainingMiddleware struct {
+	App *App
+}
+
+// Serve serves the middleware
+func (d *DrainingMiddleware) Serve(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if d.App.Draining() && c.Request().Method() == "POST" {
+			c.Response().Header().Set("Connection", "close")
+			return c.String(http.StatusServiceUnavailable, "Santiago is shutting down. Please try again.")
+		}
+
+		atomic.AddInt64(&d.App.inFlight, 1)
+		defer atomic.AddInt64(&d.App.inFlight, -1)
+		return next(c)
+	}
+}
+
+//NewAuthMiddleware returns a new authentication middleware
+func NewAuthMiddleware(app *App) *AuthMiddleware {
+	return &AuthMiddleware{
+		App: app,
+	}
+}
+
+//AuthMiddleware authenticates requests by their API key once authentication is enabled,
+//associating them with the client that owns the key. Only admin keys may manage API keys, so API keys
+//can not be managed while authentication is disabled, and keys restricted to a tenant may not access the
+//status or circuits of the whole queue
+type AuthMiddleware struct {
+	App *App
+}
+
+// Serve serves the middleware
+func (a *AuthMiddleware) Serve(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !a.App.AuthEnabled && strings.HasPrefix(c.Path(), "/apikeys") {
+			return FailWith(http.StatusForbidden, "API keys may only be managed once authentication is enabled", c)
+		}
+		if !a.App.AuthEnabled || c.Path() == "/healthcheck" {
+			return next(c)
+		}
+
+		apiKey, err := a.App.Authenticate(GetRequestAPIKey(c))
+		if err != nil {
+			a.App.Logger.Error("Failed to authenticate request.", zap.String("source", "authMiddleware"), zap.Error(err))
+			return FailWith(http.StatusInternalServerError, fmt.Sprintf("Failed to authenticate request (%s).", err.Error()), c)
+		}
+		if apiKey == nil {
+			c.Response().Header().Set("WWW-Authenticate", "Bearer")
+			return FailWith(http.StatusUnauthorized, fmt.Sprintf("A valid API key must be sent in the '%s' header or as a bearer token", APIKeyHeader), c)
+		}
+
+		c.Set("client", apiKey.Client)
+		c.Set("admin", apiKey.Admin)
+		if apiKey.Tenant != "" {
+			c.Set("tenant", apiKey.Tenant)
+		}
+		if strings.HasPrefix(c.Path(), "/apikeys") && !apiKey.Admin {
+			return FailWith(http.StatusForbidden, "Only admin API keys may manage API keys", c)
+		}
+		if GetRequestTenantScope(c) != "" && (c.Path() == "/status" || strings.HasPrefix(c.Path(), "/circuits")) {
+			return FailWith(http.StatusForbidden, "API keys of a tenant may not access the status of the whole queue", c)
+		}
+		return next(c)
+	}
+}
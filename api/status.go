@@ -21,9 +21,9 @@ func StatusHandler(app *App) func(c echo.Context) error {
 		log.D(app.Logger, "Starting status...")
 
 		var err error
-		var messageCount int
+		var messageCounts map[string]int
 		err = WithSegment("retrieve-message-count", c, func() error {
-			messageCount, err = app.GetMessageCount()
+			messageCounts, err = app.GetMessageCountByPriority()
 			return err
 		})
 
@@ -35,9 +35,15 @@ func StatusHandler(app *App) func(c echo.Context) error {
 			return FailWith(500, msg, c)
 		}
 
+		messageCount := 0
+		for _, count := range messageCounts {
+			messageCount += count
+		}
+
 		items, err := json.Marshal(map[string]interface{}{
-			"errors":          app.Errors.Rate(),
-			"messagesInQueue": messageCount,
+			"errors":             app.Errors.Rate(),
+			"messagesInQueue":    messageCount,
+			"messagesByPriority": messageCounts,
 		})
 
 		if err != nil {
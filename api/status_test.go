@@ -13,6 +13,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/queue"
 	. "github.com/topfreegames/santiago/testing"
 )
 
@@ -57,6 +58,29 @@ var _ = Describe("Status Handler", func() {
 		Expect(obj["messagesInQueue"]).To(BeEquivalentTo(10))
 	})
 
+	It("Should respond with number of items in queue of each priority", func() {
+		a, err := GetDefaultTestApp(logger)
+		Expect(err).NotTo(HaveOccurred())
+		a.Queue = uuid.NewV4().String()
+
+		a.Client.RPush(a.Queue, "{\"x\":1}")
+		a.Client.RPush(queue.PriorityQueue(a.Queue, queue.PriorityHigh), "{\"x\":1}", "{\"x\":2}")
+		a.Client.SAdd(queue.TenantsKey(a.Queue), "tenant-a")
+		a.Client.RPush(queue.PriorityQueue(queue.TenantQueue(a.Queue, "tenant-a"), queue.PriorityLow), "{\"x\":1}")
+
+		status, body := Get(a, "/status")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var obj map[string]interface{}
+		err = json.Unmarshal([]byte(body), &obj)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj["messagesInQueue"]).To(BeEquivalentTo(4))
+		byPriority := obj["messagesByPriority"].(map[string]interface{})
+		Expect(byPriority["high"]).To(BeEquivalentTo(2))
+		Expect(byPriority["normal"]).To(BeEquivalentTo(1))
+		Expect(byPriority["low"]).To(BeEquivalentTo(1))
+	})
+
 	Measure("it should get status", func(b Benchmarker) {
 		app, err := GetDefaultTestApp(logger)
 		Expect(err).NotTo(HaveOccurred())
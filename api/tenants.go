@@ -0,0 +1,107 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+func (a *App) configureTenants() error {
+	a.TenantQueues = a.Config.GetBool("api.tenants.enabled")
+
+	a.DefaultTenantQuota = &queue.TenantQuota{}
+	err := a.Config.UnmarshalKey("api.tenants.defaultQuota", a.DefaultTenantQuota)
+	if err != nil {
+		return err
+	}
+
+	a.TenantQuotas = []*queue.TenantQuota{}
+	err = a.Config.UnmarshalKey("api.tenants.quotas", &a.TenantQuotas)
+	if err != nil {
+		return err
+	}
+	for _, quota := range a.TenantQuotas {
+		if !queue.ValidTenant(quota.Tenant) {
+			err := fmt.Errorf("'%s' is not a valid tenant for a quota", quota.Tenant)
+			a.Logger.Error("Invalid tenants configuration.", zap.String("operation", "configureTenants"), zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+//Tenants returns the tenants of the app queue with their quotas
+func (a *App) Tenants() *queue.Tenants {
+	tenants := queue.NewTenants(a.Client, a.Queue)
+	if a.DefaultTenantQuota != nil {
+		tenants.DefaultQuota = a.DefaultTenantQuota
+	}
+	if a.TenantQuotas != nil {
+		tenants.Quotas = a.TenantQuotas
+	}
+	return tenants
+}
+
+//tenantOf returns the tenant whose queue the message is published to, or an empty string if it goes to the app queue
+func (a *App) tenantOf(data map[string]interface{}) string {
+	if !a.TenantQueues {
+		return ""
+	}
+	tenant, _ := data["tenant"].(string)
+	return tenant
+}
+
+//ReserveQuotas checks the quotas of the tenants of the given messages, counting them against the rate quotas.
+//It returns the quota error of each message whose tenant is over its quota, by message index
+func (a *App) ReserveQuotas(messages []map[string]interface{}) (map[int]*queue.QuotaError, error) {
+	exceeded := map[int]*queue.QuotaError{}
+	if !a.TenantQueues {
+		return exceeded, nil
+	}
+
+	tenantMessages := map[string][]int{}
+	order := []string{}
+	for i, data := range messages {
+		tenant := a.tenantOf(data)
+		if tenant == "" {
+			continue
+		}
+		if _, ok := tenantMessages[tenant]; !ok {
+			order = append(order, tenant)
+		}
+		tenantMessages[tenant] = append(tenantMessages[tenant], i)
+	}
+
+	tenants := a.Tenants()
+	for _, tenant := range order {
+		err := tenants.Reserve(tenant, len(tenantMessages[tenant]))
+		if quotaErr, ok := err.(*queue.QuotaError); ok {
+			for _, i := range tenantMessages[tenant] {
+				exceeded[i] = quotaErr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return exceeded, nil
+}
+
+//FailWithQuota fails with status code 429, telling the client when to try again if the tenant is over its rate quota
+func FailWithQuota(err *queue.QuotaError, c echo.Context) error {
+	if err.RetryAfter > 0 {
+		c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", int64(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+	return FailWith(http.StatusTooManyRequests, err.Error(), c)
+}
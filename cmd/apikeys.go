@@ -0,0 +1,111 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/topfreegames/santiago/queue"
+)
+
+var apiKeysQueue string
+var apiKeyClient string
+var apiKeyTenant string
+var apiKeyAdmin bool
+
+//apiKeysCmd represents the apikeys command
+var apiKeysCmd = &cobra.Command{
+	Use:   "apikeys",
+	Short: "manages API keys",
+	Long:  `Creates, lists and revokes the API keys clients use to authenticate to Santiago API.`,
+}
+
+//createAPIKeyCmd represents the apikeys create command
+var createAPIKeyCmd = &cobra.Command{
+	Use:   "create",
+	Short: "creates an API key",
+	Long: `Creates an API key for the given client and prints it.
+The key can not be retrieved again, since only its hash is stored.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if apiKeyClient == "" {
+			log.Fatal("--client must be specified.")
+		}
+		if apiKeyTenant != "" && !queue.ValidTenant(apiKeyTenant) {
+			log.Fatalf("--tenant must have at most %d letters, digits, dots, dashes or underscores.", queue.MaxTenantLength)
+		}
+
+		apiKeys := getAPIKeys()
+		key, apiKey, err := apiKeys.Create(apiKeyClient, apiKeyTenant, apiKeyAdmin)
+		if err != nil {
+			log.Fatalf("Could not create API key: %s", err)
+		}
+		fmt.Printf("API key %s created for client %s (tenant: %s, admin: %t):\n%s\n", apiKey.ID, apiKey.Client, apiKey.Tenant, apiKey.Admin, key)
+	},
+}
+
+//listAPIKeysCmd represents the apikeys list command
+var listAPIKeysCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists API keys",
+	Long:  `Lists the API keys stored in Redis, without the keys themselves.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		apiKeys, err := getAPIKeys().List()
+		if err != nil {
+			log.Fatalf("Could not list API keys: %s", err)
+		}
+		for _, apiKey := range apiKeys {
+			createdAt := time.Unix(apiKey.CreatedAt, 0).Format(time.RFC3339)
+			fmt.Printf("%s %s (tenant: %s, admin: %t, created at %s)\n", apiKey.ID, apiKey.Client, apiKey.Tenant, apiKey.Admin, createdAt)
+		}
+		fmt.Printf("%d API keys found.\n", len(apiKeys))
+	},
+}
+
+//revokeAPIKeyCmd represents the apikeys revoke command
+var revokeAPIKeyCmd = &cobra.Command{
+	Use:   "revoke [id]",
+	Short: "revokes an API key",
+	Long:  `Revokes the API key with the given ID, as printed by the create and list commands.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("The ID of the API key must be specified.")
+		}
+
+		found, err := getAPIKeys().Revoke(args[0])
+		if err != nil {
+			log.Fatalf("Could not revoke API key: %s", err)
+		}
+		if !found {
+			log.Fatalf("API key %s not found.", args[0])
+		}
+		fmt.Printf("API key %s revoked successfully.\n", args[0])
+	},
+}
+
+func getAPIKeys() *queue.APIKeys {
+	config := loadConfig()
+	client, err := getRedisClient(config)
+	if err != nil {
+		log.Fatalf("Could not connect to redis: %s", err)
+	}
+	return queue.NewAPIKeys(client, getQueue(config, apiKeysQueue))
+}
+
+func init() {
+	RootCmd.AddCommand(apiKeysCmd)
+	apiKeysCmd.AddCommand(createAPIKeyCmd)
+	apiKeysCmd.AddCommand(listAPIKeysCmd)
+	apiKeysCmd.AddCommand(revokeAPIKeyCmd)
+
+	apiKeysCmd.PersistentFlags().StringVarP(&apiKeysQueue, "queue", "q", "", "Queue of the API whose keys are managed (defaults to the configured queue)")
+	createAPIKeyCmd.Flags().StringVarP(&apiKeyClient, "client", "l", "", "Client that owns the API key")
+	createAPIKeyCmd.Flags().StringVarP(&apiKeyTenant, "tenant", "t", "", "Tenant all hooks sent with the API key belong to")
+	createAPIKeyCmd.Flags().BoolVarP(&apiKeyAdmin, "admin", "a", false, "Allow the API key to manage API keys")
+}
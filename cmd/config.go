@@ -0,0 +1,74 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"gopkg.in/redis.v4"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/topfreegames/santiago/api"
+	"github.com/topfreegames/santiago/config"
+	"github.com/uber-go/zap"
+)
+
+//configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "manages the configuration",
+	Long:  `Checks the configuration of Santiago API.`,
+}
+
+//checkConfigCmd represents the config check command
+var checkConfigCmd = &cobra.Command{
+	Use:   "check",
+	Short: "checks the configuration",
+	Long: `Loads the configuration file, overridden by the SNT_ environment variables,
+and reports every invalid setting. It does not connect to Redis.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := zap.New(zap.NewJSONEncoder(), zap.FatalLevel)
+		err := api.CheckConfig(api.NewOptions("", 0, false, APIConfigurationFile), logger)
+		if err != nil {
+			log.Fatalf("Configuration %s is invalid: %s", APIConfigurationFile, err)
+		}
+		fmt.Printf("Configuration %s is valid.\n", APIConfigurationFile)
+	},
+}
+
+//loadConfig loads and checks the shared settings of the configuration file, exiting if any of them is invalid
+func loadConfig() *viper.Viper {
+	settings, err := config.Load(APIConfigurationFile, nil)
+	if err != nil {
+		log.Fatalf("Could not load configuration: %s", err)
+	}
+	c := config.NewChecker(settings)
+	config.Check(c)
+	if err := c.Err(); err != nil {
+		log.Fatalf("Configuration %s is invalid: %s", APIConfigurationFile, err)
+	}
+	return settings
+}
+
+func getRedisClient(settings *viper.Viper) (redis.Cmdable, error) {
+	return config.Redis(settings).Connect()
+}
+
+//getQueue returns the name of the keys of the given queue or of the configured one if it is empty
+func getQueue(settings *viper.Viper, queue string) string {
+	if queue != "" {
+		return config.Redis(settings).QueueName(queue)
+	}
+	return config.Queue(settings)
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(checkConfigCmd)
+}
@@ -0,0 +1,135 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	"github.com/spf13/cobra"
+	"github.com/topfreegames/santiago/queue"
+)
+
+var replayQueue string
+var replayHost string
+var replayPrefix string
+var replayFrom string
+var replayTo string
+var replayDryRun bool
+
+//replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "re-enqueues journaled hooks",
+	Long: `Re-enqueues, with their attempts reset, all the hooks in the delivery journal
+that were sent to the given URL host or prefix within the given time range.
+Use --dry-run to print the hooks that would be sent without enqueueing them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if replayHost == "" && replayPrefix == "" {
+			log.Fatal("Either --host or --prefix must be specified.")
+		}
+
+		to := time.Now()
+		if replayTo != "" {
+			to = parseReplayTime("to", replayTo)
+		}
+		from := to.Add(-1 * time.Hour)
+		if replayFrom != "" {
+			from = parseReplayTime("from", replayFrom)
+		}
+
+		config := loadConfig()
+		client, err := getRedisClient(config)
+		if err != nil {
+			log.Fatalf("Could not connect to redis: %s", err)
+		}
+		replayQueue = getQueue(config, replayQueue)
+
+		count, err := replayHooks(client, from, to)
+		if err != nil {
+			log.Fatalf("Could not replay hooks: %s", err)
+		}
+
+		if replayDryRun {
+			fmt.Printf("%d hooks would be re-enqueued.\n", count)
+			return
+		}
+		fmt.Printf("%d hooks re-enqueued successfully.\n", count)
+	},
+}
+
+func parseReplayTime(name, value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("Invalid --%s time, it must be in RFC3339 format (i.e.: 2016-11-01T11:31:10-02:00): %s", name, err)
+	}
+	return t
+}
+
+func replayHooks(client redis.Cmdable, from, to time.Time) (int, error) {
+	entries, err := queue.NewJournal(client, replayQueue, 0).Find(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	messages := []string{}
+	deliveries := []*queue.Delivery{}
+	for _, entry := range entries {
+		if !entry.Matches(replayHost, replayPrefix) {
+			continue
+		}
+
+		sentAt := time.Unix(entry.SentAt, 0).Format(time.RFC3339)
+		if replayDryRun {
+			fmt.Printf("%s %s (sent at %s) %s\n", entry.Method, entry.URL, sentAt, entry.Payload)
+		} else {
+			fmt.Printf("Re-enqueueing %s %s (sent at %s)...\n", entry.Method, entry.URL, sentAt)
+		}
+
+		msg := entry.Message()
+		msg["createdAt"] = time.Now().Unix()
+		msgJSON, _ := json.Marshal(msg)
+		messages = append(messages, string(msgJSON))
+		deliveries = append(deliveries, queue.NewPendingDelivery(msg))
+	}
+
+	if replayDryRun || len(messages) == 0 {
+		return len(messages), nil
+	}
+
+	err = queue.Requeue(client, replayQueue, messages...)
+	if err != nil {
+		return 0, err
+	}
+
+	//Replayed hooks keep their IDs, so their delivery records start over
+	records := queue.NewDeliveries(client, replayQueue, queue.DefaultDeliveryRetention)
+	_, err = client.Pipelined(func(pipe *redis.Pipeline) error {
+		for _, delivery := range deliveries {
+			records.Add(pipe, delivery)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(messages), nil
+}
+
+func init() {
+	RootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().StringVarP(&replayQueue, "queue", "q", "", "Queue whose journal will be replayed (defaults to the configured queue)")
+	replayCmd.Flags().StringVarP(&replayHost, "host", "o", "", "Replay hooks sent to this URL host (i.e.: api.partner.com)")
+	replayCmd.Flags().StringVarP(&replayPrefix, "prefix", "p", "", "Replay hooks whose URL starts with this prefix (i.e.: https://api.partner.com/hooks)")
+	replayCmd.Flags().StringVarP(&replayFrom, "from", "f", "", "Replay hooks sent after this time in RFC3339 format (defaults to one hour before --to)")
+	replayCmd.Flags().StringVarP(&replayTo, "to", "t", "", "Replay hooks sent before this time in RFC3339 format (defaults to now)")
+	replayCmd.Flags().BoolVarP(&replayDryRun, "dry-run", "d", false, "Print the hooks that would be re-enqueued without enqueueing them")
+}
@@ -8,6 +8,12 @@ package cmd
 
 import (
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
 
 	"github.com/spf13/cobra"
 	"github.com/topfreegames/santiago/api"
@@ -19,6 +25,7 @@ var apiPort int
 var isDebug bool
 var fast bool
 var quiet bool
+var drainTimeoutMs int64
 
 // startCmd represents the start command
 var startCmd = &cobra.Command{
@@ -49,7 +56,27 @@ var startCmd = &cobra.Command{
 			log.Fatalf("Could not start server: %s", err)
 			return
 		}
-		app.Start()
+		errs := make(chan error, 1)
+		go func() {
+			errs <- app.Start()
+		}()
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		var sig os.Signal
+		select {
+		case err = <-errs:
+			log.Fatalf("API server stopped: %v", err)
+		case sig = <-signals:
+		}
+		logger.Info("Received signal, draining API...", zap.String("signal", sig.String()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(drainTimeoutMs)*time.Millisecond)
+		err = app.Stop(ctx)
+		cancel()
+		if err != nil && err != context.DeadlineExceeded {
+			log.Fatalf("Could not drain API: %s", err)
+		}
 	},
 }
 
@@ -61,4 +88,5 @@ func init() {
 	startCmd.Flags().BoolVarP(&isDebug, "debug", "d", false, "Should Santiago run in debug mode?")
 	startCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Should Santiago run in quiet mode? (LOGLEVEL=ERROR)")
 	startCmd.Flags().BoolVarP(&fast, "fast", "f", false, "Run with FastHTTP")
+	startCmd.Flags().Int64Var(&drainTimeoutMs, "drain-timeout-ms", 10000, "Time in ms to wait for in-flight requests on SIGTERM/SIGINT before exiting")
 }
@@ -0,0 +1,172 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/topfreegames/santiago/queue"
+)
+
+//Error lists every invalid setting of a configuration
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+//Checker validates the settings of a configuration, collecting every problem found so they are all reported at once
+type Checker struct {
+	Config   *viper.Viper
+	problems []string
+}
+
+//NewChecker returns a checker for the given configuration
+func NewChecker(config *viper.Viper) *Checker {
+	return &Checker{Config: config, problems: []string{}}
+}
+
+//Fail adds a problem to the checker
+func (c *Checker) Fail(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+//FailIf adds the error, if any, to the checker as the problem of the given setting
+func (c *Checker) FailIf(key string, err error) {
+	if err != nil {
+		c.Fail("%s: %s", key, err)
+	}
+}
+
+//Int checks that the setting is an integer of at least min and returns it
+func (c *Checker) Int(key string, min int) int {
+	var value int
+	var err error
+	switch v := c.Config.Get(key).(type) {
+	case int:
+		value = v
+	case int64:
+		value = int(v)
+	case float64:
+		if v != math.Trunc(v) {
+			c.Fail("%s must be an integer", key)
+			return 0
+		}
+		value = int(v)
+	default:
+		value, err = strconv.Atoi(c.Config.GetString(key))
+		if err != nil {
+			c.Fail("%s must be an integer", key)
+			return 0
+		}
+	}
+	if value < min {
+		c.Fail("%s must be at least %d", key, min)
+	}
+	return value
+}
+
+//Duration checks that the setting is a non-negative duration, i.e. 30s, and returns it
+func (c *Checker) Duration(key string) time.Duration {
+	value, err := time.ParseDuration(c.Config.GetString(key))
+	if err != nil {
+		c.Fail("%s must be a duration, i.e. 30s", key)
+		return 0
+	}
+	if value < 0 {
+		c.Fail("%s must not be negative", key)
+	}
+	return value
+}
+
+//URL checks that the setting, if set, is an absolute URL and returns it
+func (c *Checker) URL(key string) string {
+	value := c.Config.GetString(key)
+	if value == "" {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		c.Fail("%s must be an absolute URL", key)
+	}
+	return value
+}
+
+//Addrs checks that the setting is a non-empty list of host:port addresses and returns it
+func (c *Checker) Addrs(key string) []string {
+	addrs := c.Config.GetStringSlice(key)
+	if len(addrs) == 0 {
+		c.Fail("%s must list at least one address", key)
+	}
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host == "" || port == "" {
+			c.Fail("%s must be host:port addresses, not %s", key, addr)
+		}
+	}
+	return addrs
+}
+
+//Err returns an Error with the problems found or nil if there are none
+func (c *Checker) Err() error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return &Error{Problems: c.problems}
+}
+
+//Check checks the settings shared by the API and the workers
+func Check(c *Checker) {
+	name := c.Config.GetString("queue")
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		c.Fail("queue must be a name without spaces")
+	}
+	switch mode := c.Config.GetString("redis.mode"); mode {
+	case queue.RedisSingle:
+		if c.Config.GetString("redis.host") == "" {
+			c.Fail("redis.host must be set")
+		}
+		if port := c.Int("redis.port", 1); port > 65535 {
+			c.Fail("redis.port must be at most 65535")
+		}
+	case queue.RedisSentinel:
+		if c.Config.GetString("redis.sentinel.masterName") == "" {
+			c.Fail("redis.sentinel.masterName must be set in sentinel mode")
+		}
+		c.Addrs("redis.sentinel.addrs")
+	case queue.RedisCluster:
+		c.Addrs("redis.cluster.addrs")
+		if c.Config.GetInt("redis.db") != 0 {
+			c.Fail("redis.db must be 0 in cluster mode")
+		}
+	default:
+		c.Fail("redis.mode must be one of %s", strings.Join(queue.RedisModes, ", "))
+	}
+	c.Int("redis.db", 0)
+	c.Int("redis.maxRetries", 0)
+	c.Int("redis.maxRedirects", 0)
+	c.Int("redis.pool.size", 0)
+	for _, key := range []string{
+		"redis.dialTimeout",
+		"redis.readTimeout",
+		"redis.writeTimeout",
+		"redis.pool.timeout",
+		"redis.pool.idleTimeout",
+	} {
+		c.Duration(key)
+	}
+	c.URL("sentry.url")
+}
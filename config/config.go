@@ -0,0 +1,215 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/topfreegames/santiago/queue"
+)
+
+//DefaultQueue is the queue the API sends hooks to and the workers take them from unless another one is configured
+const DefaultQueue = "webhooks"
+
+//EnvPrefix is the prefix of the environment variables that override settings, i.e. SNT_REDIS_HOST overrides redis.host
+const EnvPrefix = "snt"
+
+//Defaults are the values of the settings shared by the API and the workers that are not configured
+var Defaults = map[string]interface{}{
+	"queue":                     DefaultQueue,
+	"redis.mode":                queue.RedisSingle,
+	"redis.host":                "localhost",
+	"redis.port":                6379,
+	"redis.password":            "",
+	"redis.db":                  0,
+	"redis.sentinel.masterName": "",
+	"redis.sentinel.addrs":      []string{},
+	"redis.cluster.addrs":       []string{},
+	"redis.maxRetries":          3,
+	"redis.maxRedirects":        0,
+	"redis.dialTimeout":         "0s",
+	"redis.readTimeout":         "0s",
+	"redis.writeTimeout":        "0s",
+	"redis.pool.size":           0,
+	"redis.pool.timeout":        "0s",
+	"redis.pool.idleTimeout":    "0s",
+	"sentry.url":                "",
+}
+
+//legacyKeys maps the settings of older API configuration files to the shared settings that replaced them
+var legacyKeys = map[string]string{
+	"api.redis.host":     "redis.host",
+	"api.redis.port":     "redis.port",
+	"api.redis.password": "redis.password",
+	"api.redis.db":       "redis.db",
+	"api.sentry.url":     "sentry.url",
+}
+
+//New returns an empty configuration whose settings are overridden by environment variables
+func New() *viper.Viper {
+	config := viper.New()
+	config.SetEnvPrefix(EnvPrefix)
+	config.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	config.AutomaticEnv()
+	return config
+}
+
+//Load reads the given configuration file, if any, filling the settings it does not have with Defaults and the given
+//defaults. Defaults are merged into the settings of the file instead of being set as viper defaults, since viper
+//ignores the defaults of settings whose section is in the file. Legacy settings and their environment variables,
+//i.e. SNT_API_REDIS_HOST, still apply to the settings that replaced them
+func Load(file string, defaults map[string]interface{}) (*viper.Viper, error) {
+	settings := map[string]interface{}{}
+	if file != "" {
+		fileConfig := viper.New()
+		fileConfig.SetConfigFile(file)
+		err := fileConfig.ReadInConfig()
+		if err != nil {
+			return nil, err
+		}
+		settings = normalize(fileConfig.AllSettings()).(map[string]interface{})
+	}
+
+	for legacyKey, key := range legacyKeys {
+		if value, ok := lookup(settings, legacyKey); ok {
+			setDefault(settings, key, value)
+		}
+	}
+	for _, values := range []map[string]interface{}{Defaults, defaults} {
+		for key, value := range values {
+			setDefault(settings, key, value)
+		}
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	config := New()
+	config.SetConfigType("json")
+	err = config.ReadConfig(bytes.NewReader(settingsJSON))
+	if err != nil {
+		return nil, err
+	}
+	for legacyKey, key := range legacyKeys {
+		if value := os.Getenv(envVar(legacyKey)); value != "" && os.Getenv(envVar(key)) == "" {
+			config.Set(key, value)
+		}
+	}
+	return config, nil
+}
+
+//Redis returns the options of the connection to Redis
+func Redis(config *viper.Viper) *queue.RedisOptions {
+	return &queue.RedisOptions{
+		Mode:          config.GetString("redis.mode"),
+		Host:          config.GetString("redis.host"),
+		Port:          config.GetInt("redis.port"),
+		Password:      config.GetString("redis.password"),
+		DB:            config.GetInt("redis.db"),
+		MasterName:    config.GetString("redis.sentinel.masterName"),
+		SentinelAddrs: config.GetStringSlice("redis.sentinel.addrs"),
+		ClusterAddrs:  config.GetStringSlice("redis.cluster.addrs"),
+		MaxRetries:    config.GetInt("redis.maxRetries"),
+		MaxRedirects:  config.GetInt("redis.maxRedirects"),
+		DialTimeout:   config.GetDuration("redis.dialTimeout"),
+		ReadTimeout:   config.GetDuration("redis.readTimeout"),
+		WriteTimeout:  config.GetDuration("redis.writeTimeout"),
+		PoolSize:      config.GetInt("redis.pool.size"),
+		PoolTimeout:   config.GetDuration("redis.pool.timeout"),
+		IdleTimeout:   config.GetDuration("redis.pool.idleTimeout"),
+	}
+}
+
+//Queue returns the name of the keys of the configured queue, which is hash tagged in Redis Cluster
+func Queue(config *viper.Viper) string {
+	return Redis(config).QueueName(config.GetString("queue"))
+}
+
+//envVar returns the environment variable that overrides the setting with the given dotted key
+func envVar(key string) string {
+	return strings.ToUpper(EnvPrefix + "_" + strings.Replace(key, ".", "_", -1))
+}
+
+//normalize converts the maps decoded from configuration files to maps with string keys, so they can be encoded as JSON
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalize(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[key] = normalize(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalize(item)
+		}
+		return items
+	}
+	return value
+}
+
+//child returns the key of the settings matching name regardless of case, like viper does
+func child(settings map[string]interface{}, name string) (string, bool) {
+	for key := range settings {
+		if strings.ToLower(key) == strings.ToLower(name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+//lookup returns the value of the setting with the given dotted key
+func lookup(settings map[string]interface{}, key string) (interface{}, bool) {
+	path := strings.Split(key, ".")
+	for i, name := range path {
+		k, ok := child(settings, name)
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			return settings[k], true
+		}
+		settings, ok = settings[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+//setDefault sets the setting with the given dotted key unless it is already set. Settings whose section is not a map are left alone
+func setDefault(settings map[string]interface{}, key string, value interface{}) {
+	path := strings.Split(key, ".")
+	for _, name := range path[:len(path)-1] {
+		k, ok := child(settings, name)
+		if !ok {
+			k = name
+			settings[k] = map[string]interface{}{}
+		}
+		section, ok := settings[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		settings = section
+	}
+	if _, ok := child(settings, path[len(path)-1]); !ok {
+		settings[path[len(path)-1]] = value
+	}
+}
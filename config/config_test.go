@@ -0,0 +1,246 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/topfreegames/santiago/config"
+)
+
+var _ = Describe("Config", func() {
+	var dir string
+
+	writeConfig := func(contents string) string {
+		path := filepath.Join(dir, "config.yaml")
+		err := ioutil.WriteFile(path, []byte(contents), 0600)
+		Expect(err).NotTo(HaveOccurred())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "santiago-config")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Load", func() {
+		It("should use the defaults without a configuration file", func() {
+			config, err := Load("", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.GetString("queue")).To(Equal(DefaultQueue))
+			Expect(config.GetString("redis.host")).To(Equal("localhost"))
+			Expect(config.GetInt("redis.port")).To(Equal(6379))
+		})
+
+		It("should fill the settings missing from the sections of the file", func() {
+			path := writeConfig(`
+redis:
+  host: redis.local
+worker:
+  poolSize: 10
+`)
+			config, err := Load(path, map[string]interface{}{
+				"worker.poolSize":     100,
+				"worker.popBatchSize": 1,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.GetString("redis.host")).To(Equal("redis.local"))
+			Expect(config.GetInt("redis.port")).To(Equal(6379))
+			Expect(config.GetInt("worker.poolSize")).To(Equal(10))
+			Expect(config.GetInt("worker.popBatchSize")).To(Equal(1))
+		})
+
+		It("should map the legacy settings of the API", func() {
+			path := writeConfig(`
+api:
+  redis:
+    host: legacy.local
+    port: 1234
+  sentry:
+    url: http://sentry.local/1
+`)
+			config, err := Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.GetString("redis.host")).To(Equal("legacy.local"))
+			Expect(config.GetInt("redis.port")).To(Equal(1234))
+			Expect(config.GetString("sentry.url")).To(Equal("http://sentry.local/1"))
+		})
+
+		It("should override settings with environment variables", func() {
+			os.Setenv("SNT_REDIS_HOST", "env.local")
+			os.Setenv("SNT_API_REDIS_PORT", "4321")
+			defer os.Unsetenv("SNT_REDIS_HOST")
+			defer os.Unsetenv("SNT_API_REDIS_PORT")
+
+			path := writeConfig(`
+redis:
+  host: redis.local
+  port: 6380
+`)
+			config, err := Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.GetString("redis.host")).To(Equal("env.local"))
+			Expect(config.GetInt("redis.port")).To(Equal(4321))
+		})
+
+		It("should fail if the file does not exist", func() {
+			_, err := Load(filepath.Join(dir, "missing.yaml"), nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Redis", func() {
+		It("should read the options of the connection", func() {
+			path := writeConfig(`
+redis:
+  mode: sentinel
+  password: secret
+  sentinel:
+    masterName: santiago
+    addrs:
+      - sentinel-1:26379
+      - sentinel-2:26379
+  maxRetries: 5
+  readTimeout: 2s
+  pool:
+    size: 50
+`)
+			config, err := Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			options := Redis(config)
+			Expect(options.Mode).To(Equal("sentinel"))
+			Expect(options.Password).To(Equal("secret"))
+			Expect(options.MasterName).To(Equal("santiago"))
+			Expect(options.SentinelAddrs).To(Equal([]string{"sentinel-1:26379", "sentinel-2:26379"}))
+			Expect(options.MaxRetries).To(Equal(5))
+			Expect(options.ReadTimeout).To(Equal(2 * time.Second))
+			Expect(options.PoolSize).To(Equal(50))
+			Expect(options.PoolTimeout).To(BeZero())
+			Expect(Queue(config)).To(Equal(DefaultQueue))
+		})
+
+		It("should hash tag the queue in cluster mode", func() {
+			path := writeConfig(`
+queue: hooks
+redis:
+  mode: cluster
+  cluster:
+    addrs: [node-1:7000, node-2:7000]
+  maxRetries: 0
+  maxRedirects: 8
+`)
+			config, err := Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Redis(config).ClusterAddrs).To(Equal([]string{"node-1:7000", "node-2:7000"}))
+			Expect(Redis(config).MaxRetries).To(Equal(0))
+			Expect(Redis(config).MaxRedirects).To(Equal(8))
+			Expect(Queue(config)).To(Equal("{hooks}"))
+
+			c := NewChecker(config)
+			Check(c)
+			Expect(c.Err()).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("Check", func() {
+		It("should accept the defaults", func() {
+			config, err := Load("", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			c := NewChecker(config)
+			Check(c)
+			Expect(c.Err()).NotTo(HaveOccurred())
+		})
+
+		It("should check the settings of sentinel and cluster deployments", func() {
+			path := writeConfig(`
+redis:
+  mode: sentinel
+  sentinel:
+    addrs: [sentinel-1]
+`)
+			config, err := Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			c := NewChecker(config)
+			Check(c)
+			Expect(c.Err().(*Error).Problems).To(Equal([]string{
+				"redis.sentinel.masterName must be set in sentinel mode",
+				"redis.sentinel.addrs must be host:port addresses, not sentinel-1",
+			}))
+
+			path = writeConfig(`
+redis:
+  mode: cluster
+  db: 1
+`)
+			config, err = Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			c = NewChecker(config)
+			Check(c)
+			Expect(c.Err().(*Error).Problems).To(Equal([]string{
+				"redis.cluster.addrs must list at least one address",
+				"redis.db must be 0 in cluster mode",
+			}))
+
+			path = writeConfig(`
+redis:
+  mode: replicated
+`)
+			config, err = Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			c = NewChecker(config)
+			Check(c)
+			Expect(c.Err().(*Error).Problems).To(Equal([]string{
+				"redis.mode must be one of single, sentinel, cluster",
+			}))
+		})
+
+		It("should report every invalid setting", func() {
+			path := writeConfig(`
+queue: "web hooks"
+redis:
+  port: 70000
+  db: -1
+sentry:
+  url: not-a-url
+worker:
+  poolSize: ten
+  timeout: soon
+`)
+			config, err := Load(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			c := NewChecker(config)
+			Check(c)
+			Expect(c.Int("worker.poolSize", 1)).To(Equal(0))
+			c.Duration("worker.timeout")
+
+			err = c.Err()
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*Error).Problems).To(Equal([]string{
+				"queue must be a name without spaces",
+				"redis.port must be at most 65535",
+				"redis.db must be at least 0",
+				"sentry.url must be an absolute URL",
+				"worker.poolSize must be an integer",
+				"worker.timeout must be a duration, i.e. 30s",
+			}))
+			Expect(err.Error()).To(ContainSubstring("invalid configuration: queue must be a name without spaces; "))
+		})
+	})
+})
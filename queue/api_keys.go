@@ -0,0 +1,162 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/redis.v4"
+)
+
+//APIKey is a key clients use to authenticate to the API. Only the hash of the key is stored.
+//Hooks sent with keys that have a tenant always belong to that tenant
+type APIKey struct {
+	ID        string `json:"id"`
+	Hash      string `json:"hash,omitempty"`
+	Client    string `json:"client"`
+	Tenant    string `json:"tenant,omitempty"`
+	Admin     bool   `json:"admin"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+//HashAPIKey returns the hash of the given API key
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+//apiKeyID returns the ID of the API key with the given hash
+func apiKeyID(hash string) string {
+	return hash[:16]
+}
+
+//NewAPIKey returns the API key of a client, with the given key
+func NewAPIKey(key, client, tenant string, admin bool) *APIKey {
+	hash := HashAPIKey(key)
+	return &APIKey{
+		ID:        apiKeyID(hash),
+		Hash:      hash,
+		Client:    client,
+		Tenant:    tenant,
+		Admin:     admin,
+		CreatedAt: time.Now().Unix(),
+	}
+}
+
+//Matches returns whether the given key is this API key
+func (k *APIKey) Matches(key string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(k.Hash)) == 1
+}
+
+//APIKeys stores the API keys of a queue in Redis
+type APIKeys struct {
+	Client redis.Cmdable
+	Queue  string
+}
+
+//NewAPIKeys returns the API keys store for the given queue
+func NewAPIKeys(client redis.Cmdable, queue string) *APIKeys {
+	return &APIKeys{
+		Client: client,
+		Queue:  queue,
+	}
+}
+
+//Key returns the hash holding the API keys by ID
+func (k *APIKeys) Key() string {
+	return fmt.Sprintf("%s:apikeys", k.Queue)
+}
+
+//Create generates a new API key for the client, returning the key itself, which is not stored
+func (k *APIKeys) Create(client, tenant string, admin bool) (string, *APIKey, error) {
+	secret := make([]byte, 24)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	key := hex.EncodeToString(secret)
+
+	apiKey := NewAPIKey(key, client, tenant, admin)
+	apiKeyJSON, err := json.Marshal(apiKey)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = k.Client.HSet(k.Key(), apiKey.ID, string(apiKeyJSON)).Result()
+	if err != nil {
+		return "", nil, err
+	}
+	return key, apiKey, nil
+}
+
+//Get returns the API key with the given key or nil if it does not exist
+func (k *APIKeys) Get(key string) (*APIKey, error) {
+	item, err := k.Client.HGet(k.Key(), apiKeyID(HashAPIKey(key))).Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var apiKey APIKey
+	err = json.Unmarshal([]byte(item), &apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if !apiKey.Matches(key) {
+		return nil, nil
+	}
+	return &apiKey, nil
+}
+
+//List returns all API keys from the oldest to the most recent, without their hashes
+func (k *APIKeys) List() ([]*APIKey, error) {
+	items, err := k.Client.HGetAll(k.Key()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := []*APIKey{}
+	for _, item := range items {
+		var apiKey APIKey
+		err = json.Unmarshal([]byte(item), &apiKey)
+		if err != nil {
+			return nil, err
+		}
+		apiKey.Hash = ""
+		apiKeys = append(apiKeys, &apiKey)
+	}
+	sort.Sort(apiKeysByCreation(apiKeys))
+	return apiKeys, nil
+}
+
+//Revoke removes the API key with the given ID, returning whether it existed
+func (k *APIKeys) Revoke(id string) (bool, error) {
+	res, err := k.Client.HDel(k.Key(), id).Result()
+	if err != nil {
+		return false, err
+	}
+	return res > 0, nil
+}
+
+type apiKeysByCreation []*APIKey
+
+func (a apiKeysByCreation) Len() int      { return len(a) }
+func (a apiKeysByCreation) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a apiKeysByCreation) Less(i, j int) bool {
+	if a[i].CreatedAt == a[j].CreatedAt {
+		return a[i].ID < a[j].ID
+	}
+	return a[i].CreatedAt < a[j].CreatedAt
+}
@@ -0,0 +1,83 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("API Keys", func() {
+	var testClient *redis.Client
+	var apiKeys *APIKeys
+
+	BeforeEach(func() {
+		cli, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+		apiKeys = NewAPIKeys(testClient, uuid.NewV4().String())
+	})
+
+	It("should create and get API key", func() {
+		key, apiKey, err := apiKeys.Create("partner", "tenant-a", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(HaveLen(48))
+		Expect(apiKey.Client).To(Equal("partner"))
+		Expect(apiKey.Tenant).To(Equal("tenant-a"))
+		Expect(apiKey.Admin).To(BeTrue())
+
+		stored, err := apiKeys.Get(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(apiKey))
+
+		items, err := testClient.HGetAll(apiKeys.Key()).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(items).To(HaveLen(1))
+		Expect(items[apiKey.ID]).NotTo(ContainSubstring(key))
+	})
+
+	It("should return nil for unknown API key", func() {
+		stored, err := apiKeys.Get("unknown")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(BeNil())
+	})
+
+	It("should list API keys without their hashes", func() {
+		_, first, err := apiKeys.Create("partner-1", "", false)
+		Expect(err).NotTo(HaveOccurred())
+		_, second, err := apiKeys.Create("partner-2", "", false)
+		Expect(err).NotTo(HaveOccurred())
+
+		list, err := apiKeys.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(2))
+		ids := []string{list[0].ID, list[1].ID}
+		Expect(ids).To(ConsistOf(first.ID, second.ID))
+		Expect(list[0].Hash).To(BeEmpty())
+	})
+
+	It("should revoke API key", func() {
+		key, apiKey, err := apiKeys.Create("partner", "", false)
+		Expect(err).NotTo(HaveOccurred())
+
+		found, err := apiKeys.Revoke(apiKey.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		stored, err := apiKeys.Get(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(BeNil())
+
+		found, err = apiKeys.Revoke(apiKey.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+})
@@ -0,0 +1,205 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gopkg.in/redis.v4"
+)
+
+//Circuit states of a destination host
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+//allowScript returns 0 if a request to the host is allowed or the time in ms until it may be,
+//moving open circuits whose timeout elapsed to half-open and letting a single probe request through
+var allowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local circuit = redis.call("HMGET", KEYS[1], "state", "openedAt", "probeUntil")
+local state = circuit[1]
+if not state or state == "closed" then
+	return 0
+end
+if state == "open" then
+	local retryAt = tonumber(circuit[2]) + tonumber(ARGV[2])
+	if now < retryAt then
+		return retryAt - now
+	end
+end
+local probeUntil = tonumber(circuit[3]) or 0
+if state == "half-open" and now < probeUntil then
+	return probeUntil - now
+end
+redis.call("HMSET", KEYS[1], "state", "half-open", "probeUntil", now + tonumber(ARGV[3]), "updatedAt", now)
+return 0
+`)
+
+//failureScript counts a failed request to the host, opening its circuit if the failed request was
+//a half-open probe or if consecutive failures reached the threshold. It returns 1 if the circuit opened
+var failureScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+redis.call("SADD", KEYS[2], ARGV[3])
+local state = redis.call("HGET", KEYS[1], "state")
+local failures = redis.call("HINCRBY", KEYS[1], "failures", 1)
+if state == "half-open" or (state ~= "open" and failures >= tonumber(ARGV[2])) then
+	redis.call("HMSET", KEYS[1], "state", "open", "openedAt", now, "updatedAt", now)
+	return 1
+end
+if not state then
+	redis.call("HSET", KEYS[1], "state", "closed")
+end
+redis.call("HSET", KEYS[1], "updatedAt", now)
+return 0
+`)
+
+//Circuit is the circuit breaker state of a destination host
+type Circuit struct {
+	Host      string `json:"host"`
+	State     string `json:"state"`
+	Failures  int    `json:"failures"`
+	OpenedAt  int64  `json:"openedAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+//CircuitBreaker stops sending requests to destination hosts that keep failing, sharing the circuits of a queue in Redis.
+//A circuit opens after FailureThreshold consecutive failed requests to the host. After OpenTimeout a single probe request
+//is let through (half-open): the circuit closes if it succeeds or opens again if it fails
+type CircuitBreaker struct {
+	Client           redis.Cmdable
+	Queue            string
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	ProbeTimeout     time.Duration
+}
+
+//NewCircuitBreaker returns the circuit breaker of the given queue
+func NewCircuitBreaker(client redis.Cmdable, queue string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Client:           client,
+		Queue:            queue,
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		ProbeTimeout:     time.Minute,
+	}
+}
+
+//HostFor returns the host whose circuit applies to the given URL
+func HostFor(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+//Key returns the hash holding the circuit of the given host
+func (c *CircuitBreaker) Key(host string) string {
+	return fmt.Sprintf("%s:circuit:%s", c.Queue, host)
+}
+
+//HostsKey returns the set holding the hosts with failures or open circuits
+func (c *CircuitBreaker) HostsKey() string {
+	return fmt.Sprintf("%s:circuits", c.Queue)
+}
+
+func toMs(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+//Allow returns whether a request to the host may be sent now or for how long it should be parked
+func (c *CircuitBreaker) Allow(host string) (time.Duration, error) {
+	res, err := allowScript.Run(
+		c.Client,
+		[]string{c.Key(host)},
+		nowMs(), toMs(c.OpenTimeout), toMs(c.ProbeTimeout),
+	).Result()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(res.(int64)) * time.Millisecond, nil
+}
+
+//RecordSuccess closes the circuit of the host
+func (c *CircuitBreaker) RecordSuccess(host string) error {
+	exists, err := c.Client.Exists(c.Key(host)).Result()
+	if err != nil || !exists {
+		return err
+	}
+	_, err = c.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		pipe.Del(c.Key(host))
+		pipe.SRem(c.HostsKey(), host)
+		return nil
+	})
+	return err
+}
+
+//RecordFailure counts a failed request to the host, returning whether its circuit opened
+func (c *CircuitBreaker) RecordFailure(host string) (bool, error) {
+	res, err := failureScript.Run(
+		c.Client,
+		[]string{c.Key(host), c.HostsKey()},
+		nowMs(), c.FailureThreshold, host,
+	).Result()
+	if err != nil {
+		return false, err
+	}
+	return res.(int64) == 1, nil
+}
+
+//Get returns the circuit of the given host. Hosts without failures have closed circuits
+func (c *CircuitBreaker) Get(host string) (*Circuit, error) {
+	hash, err := c.Client.HGetAll(c.Key(host)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	circuit := &Circuit{
+		Host:  host,
+		State: CircuitClosed,
+	}
+	if len(hash) == 0 {
+		return circuit, nil
+	}
+	if hash["state"] != "" {
+		circuit.State = hash["state"]
+	}
+	circuit.Failures, _ = strconv.Atoi(hash["failures"])
+	openedAt, _ := strconv.ParseInt(hash["openedAt"], 10, 64)
+	circuit.OpenedAt = openedAt / 1000
+	updatedAt, _ := strconv.ParseInt(hash["updatedAt"], 10, 64)
+	circuit.UpdatedAt = updatedAt / 1000
+	return circuit, nil
+}
+
+//List returns the circuits of all hosts with failures or open circuits
+func (c *CircuitBreaker) List() ([]*Circuit, error) {
+	hosts, err := c.Client.SMembers(c.HostsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	circuits := []*Circuit{}
+	for _, host := range hosts {
+		circuit, err := c.Get(host)
+		if err != nil {
+			return nil, err
+		}
+		circuits = append(circuits, circuit)
+	}
+	return circuits, nil
+}
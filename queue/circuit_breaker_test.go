@@ -0,0 +1,138 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Circuit Breaker", func() {
+	var testClient *redis.Client
+	var breaker *CircuitBreaker
+
+	BeforeEach(func() {
+		cli, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+		breaker = NewCircuitBreaker(testClient, uuid.NewV4().String(), 2, 50*time.Millisecond)
+	})
+
+	It("should get host of URL", func() {
+		Expect(HostFor("http://partner.com:8080/hook")).To(Equal("partner.com:8080"))
+	})
+
+	It("should allow requests to hosts without failures", func() {
+		wait, err := breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+
+		circuit, err := breaker.Get("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(circuit.State).To(Equal(CircuitClosed))
+	})
+
+	It("should open circuit after consecutive failures", func() {
+		opened, err := breaker.RecordFailure("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opened).To(BeFalse())
+
+		wait, err := breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+
+		opened, err = breaker.RecordFailure("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opened).To(BeTrue())
+
+		wait, err = breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeNumerically(">", 0))
+		Expect(wait).To(BeNumerically("<=", 50*time.Millisecond))
+
+		circuits, err := breaker.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(circuits).To(HaveLen(1))
+		Expect(circuits[0].Host).To(Equal("partner.com"))
+		Expect(circuits[0].State).To(Equal(CircuitOpen))
+		Expect(circuits[0].Failures).To(Equal(2))
+		Expect(circuits[0].OpenedAt).To(BeNumerically(">", 0))
+	})
+
+	It("should reset failures after success", func() {
+		_, err := breaker.RecordFailure("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		err = breaker.RecordSuccess("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+
+		opened, err := breaker.RecordFailure("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opened).To(BeFalse())
+	})
+
+	It("should let a single probe through once open timeout elapses", func() {
+		for i := 0; i < 2; i++ {
+			_, err := breaker.RecordFailure("partner.com")
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		time.Sleep(60 * time.Millisecond)
+
+		wait, err := breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+
+		wait, err = breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeNumerically(">", 0))
+
+		circuit, err := breaker.Get("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(circuit.State).To(Equal(CircuitHalfOpen))
+	})
+
+	It("should open circuit again if probe fails", func() {
+		for i := 0; i < 2; i++ {
+			_, err := breaker.RecordFailure("partner.com")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		time.Sleep(60 * time.Millisecond)
+		_, err := breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+
+		opened, err := breaker.RecordFailure("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opened).To(BeTrue())
+	})
+
+	It("should close circuit if probe succeeds", func() {
+		for i := 0; i < 2; i++ {
+			_, err := breaker.RecordFailure("partner.com")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		time.Sleep(60 * time.Millisecond)
+		_, err := breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = breaker.RecordSuccess("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+
+		circuits, err := breaker.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(circuits).To(BeEmpty())
+
+		wait, err := breaker.Allow("partner.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+	})
+})
@@ -0,0 +1,237 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/redis.v4"
+)
+
+// replayScript removes a dead letter and pushes its message back to the queue of its priority and tenant, only if it was still there
+var replayScript = redis.NewScript(RouteFunction + SignalFunction + `
+route_keys(6)
+if redis.call("HDEL", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("ZREM", KEYS[4], ARGV[1])
+redis.call("RPUSH", route(KEYS[3], ARGV[2]), ARGV[2])
+signal(KEYS[5])
+return 1
+`)
+
+// DeadLetter is a hook that exhausted all its delivery attempts
+type DeadLetter struct {
+	ID             string                 `json:"id"`
+	Method         string                 `json:"method"`
+	URL            string                 `json:"url"`
+	Payload        string                 `json:"payload"`
+	Headers        map[string]string      `json:"headers,omitempty"`
+	Tenant         string                 `json:"tenant,omitempty"`
+	Options        map[string]interface{} `json:"options,omitempty"`
+	Attempts       int                    `json:"attempts"`
+	LastStatusCode int                    `json:"lastStatusCode"`
+	LastError      string                 `json:"lastError"`
+	CreatedAt      int64                  `json:"createdAt"`
+	FailedAt       int64                  `json:"failedAt"`
+}
+
+// Message returns the queue message that dispatches the dead letter again from scratch with its tenant and options,
+// keeping its hook ID
+func (d *DeadLetter) Message() map[string]interface{} {
+	return newMessage(d.ID, d.Method, d.URL, d.Payload, d.Headers, d.CreatedAt, d.Tenant, d.Options)
+}
+
+// DeadLetterQueue stores the dead letters of a queue in Redis
+type DeadLetterQueue struct {
+	Client redis.Cmdable
+	Queue  string
+	// MaxLength is the number of dead letters kept, discarding the oldest ones. Zero keeps every dead letter
+	MaxLength int64
+}
+
+// NewDeadLetterQueue returns the dead letter queue for the given queue
+func NewDeadLetterQueue(client redis.Cmdable, queue string) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		Client: client,
+		Queue:  queue,
+	}
+}
+
+// Key returns the hash holding the dead letters by ID
+func (d *DeadLetterQueue) Key() string {
+	return fmt.Sprintf("%s:dead", d.Queue)
+}
+
+// IndexKey returns the sorted set holding the dead letter IDs scored by failure time
+func (d *DeadLetterQueue) IndexKey() string {
+	return fmt.Sprintf("%s:dead:index", d.Queue)
+}
+
+// TenantIndexKey returns the sorted set holding the IDs of the dead letters of the given tenant scored by failure time
+func (d *DeadLetterQueue) TenantIndexKey(tenant string) string {
+	return fmt.Sprintf("%s:dead:tenant:%s", d.Queue, tenant)
+}
+
+// Add stores a new dead letter
+func (d *DeadLetterQueue) Add(letter *DeadLetter) error {
+	letterJSON, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		pipe.HSet(d.Key(), letter.ID, string(letterJSON))
+		pipe.ZAdd(d.IndexKey(), redis.Z{Score: float64(letter.FailedAt), Member: letter.ID})
+		if letter.Tenant != "" {
+			pipe.ZAdd(d.TenantIndexKey(letter.Tenant), redis.Z{Score: float64(letter.FailedAt), Member: letter.ID})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.trim()
+}
+
+// trim discards the oldest dead letters over MaxLength
+func (d *DeadLetterQueue) trim() error {
+	if d.MaxLength <= 0 {
+		return nil
+	}
+
+	ids, err := d.Client.ZRange(d.IndexKey(), 0, -d.MaxLength-1).Result()
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	items, err := d.Client.HMGet(d.Key(), ids...).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		for i, id := range ids {
+			pipe.HDel(d.Key(), id)
+			pipe.ZRem(d.IndexKey(), id)
+			if item, ok := items[i].(string); ok {
+				var letter DeadLetter
+				if json.Unmarshal([]byte(item), &letter) == nil && letter.Tenant != "" {
+					pipe.ZRem(d.TenantIndexKey(letter.Tenant), id)
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Count returns the number of dead letters
+func (d *DeadLetterQueue) Count() (int64, error) {
+	return d.Client.HLen(d.Key()).Result()
+}
+
+// CountTenant returns the number of dead letters of the given tenant
+func (d *DeadLetterQueue) CountTenant(tenant string) (int64, error) {
+	return d.Client.ZCard(d.TenantIndexKey(tenant)).Result()
+}
+
+// List returns dead letters from the most recent failure to the oldest
+func (d *DeadLetterQueue) List(offset, limit int64) ([]*DeadLetter, error) {
+	return d.list(d.IndexKey(), offset, limit)
+}
+
+// ListTenant returns the dead letters of the given tenant from the most recent failure to the oldest
+func (d *DeadLetterQueue) ListTenant(tenant string, offset, limit int64) ([]*DeadLetter, error) {
+	return d.list(d.TenantIndexKey(tenant), offset, limit)
+}
+
+func (d *DeadLetterQueue) list(indexKey string, offset, limit int64) ([]*DeadLetter, error) {
+	letters := []*DeadLetter{}
+	if limit <= 0 {
+		return letters, nil
+	}
+
+	ids, err := d.Client.ZRevRange(indexKey, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return letters, nil
+	}
+
+	items, err := d.Client.HMGet(d.Key(), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		var letter DeadLetter
+		err = json.Unmarshal([]byte(item.(string)), &letter)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, &letter)
+	}
+
+	return letters, nil
+}
+
+// Get returns the dead letter with the given ID or nil if it does not exist
+func (d *DeadLetterQueue) Get(id string) (*DeadLetter, error) {
+	item, err := d.Client.HGet(d.Key(), id).Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var letter DeadLetter
+	err = json.Unmarshal([]byte(item), &letter)
+	if err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// Delete removes the given dead letter, returning whether it existed
+func (d *DeadLetterQueue) Delete(letter *DeadLetter) (bool, error) {
+	res, err := d.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		pipe.HDel(d.Key(), letter.ID)
+		pipe.ZRem(d.IndexKey(), letter.ID)
+		pipe.ZRem(d.TenantIndexKey(letter.Tenant), letter.ID)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return res[0].(*redis.IntCmd).Val() > 0, nil
+}
+
+// Replay moves the given dead letter back to the queue of its priority and tenant, like workers promote scheduled hooks,
+// with its attempts reset, returning whether it still existed
+func (d *DeadLetterQueue) Replay(letter *DeadLetter) (bool, error) {
+	routes, err := RouteKeys(d.Client, d.Queue)
+	if err != nil {
+		return false, err
+	}
+	msgJSON, _ := json.Marshal(letter.Message())
+	res, err := replayScript.Run(
+		d.Client,
+		append([]string{d.Key(), d.IndexKey(), d.Queue, d.TenantIndexKey(letter.Tenant), ReadyKey(d.Queue)}, routes...),
+		letter.ID, string(msgJSON),
+	).Result()
+	if err != nil {
+		return false, err
+	}
+	return res.(int64) == 1, nil
+}
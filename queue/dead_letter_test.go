@@ -0,0 +1,224 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+func newDeadLetter(failedAt int64) *DeadLetter {
+	return &DeadLetter{
+		ID:             uuid.NewV4().String(),
+		Method:         "POST",
+		URL:            "http://test.com/hook",
+		Payload:        "{\"x\":1}",
+		Attempts:       11,
+		LastStatusCode: 500,
+		LastError:      "Error requesting webhook. Status code: 500",
+		CreatedAt:      failedAt - 100,
+		FailedAt:       failedAt,
+	}
+}
+
+var _ = Describe("Dead Letter Queue", func() {
+	var testClient *redis.Client
+	var dlq *DeadLetterQueue
+
+	BeforeEach(func() {
+		cli, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+		dlq = NewDeadLetterQueue(testClient, uuid.NewV4().String())
+	})
+
+	It("should add and get dead letter", func() {
+		letter := newDeadLetter(time.Now().Unix())
+		err := dlq.Add(letter)
+		Expect(err).NotTo(HaveOccurred())
+
+		stored, err := dlq.Get(letter.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(letter))
+
+		total, err := dlq.Count()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(1))
+	})
+
+	It("should return nil for unknown dead letter", func() {
+		stored, err := dlq.Get(uuid.NewV4().String())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(BeNil())
+	})
+
+	It("should list dead letters from the most recent failure", func() {
+		for i := int64(1); i <= 5; i++ {
+			err := dlq.Add(newDeadLetter(i))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		letters, err := dlq.List(1, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(letters).To(HaveLen(2))
+		Expect(letters[0].FailedAt).To(BeEquivalentTo(4))
+		Expect(letters[1].FailedAt).To(BeEquivalentTo(3))
+	})
+
+	It("should list and count dead letters of a tenant", func() {
+		for i := int64(1); i <= 4; i++ {
+			letter := newDeadLetter(i)
+			if i%2 == 0 {
+				letter.Tenant = "tenant-a"
+			}
+			err := dlq.Add(letter)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		letters, err := dlq.ListTenant("tenant-a", 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(letters).To(HaveLen(2))
+		Expect(letters[0].FailedAt).To(BeEquivalentTo(4))
+		Expect(letters[1].FailedAt).To(BeEquivalentTo(2))
+
+		total, err := dlq.CountTenant("tenant-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(2))
+
+		found, err := dlq.Delete(letters[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		total, err = dlq.CountTenant("tenant-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(1))
+	})
+
+	It("should discard the oldest dead letters over the max length", func() {
+		dlq.MaxLength = 2
+		for i := int64(1); i <= 4; i++ {
+			letter := newDeadLetter(i)
+			letter.Tenant = "tenant-a"
+			err := dlq.Add(letter)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		letters, err := dlq.List(0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(letters).To(HaveLen(2))
+		Expect(letters[0].FailedAt).To(BeEquivalentTo(4))
+		Expect(letters[1].FailedAt).To(BeEquivalentTo(3))
+
+		total, err := dlq.Count()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(2))
+
+		total, err = dlq.CountTenant("tenant-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(2))
+	})
+
+	It("should delete dead letter", func() {
+		letter := newDeadLetter(time.Now().Unix())
+		err := dlq.Add(letter)
+		Expect(err).NotTo(HaveOccurred())
+
+		found, err := dlq.Delete(letter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		found, err = dlq.Delete(letter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+
+		total, err := dlq.Count()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(0))
+	})
+
+	It("should replay dead letter to the queue with attempts reset", func() {
+		letter := newDeadLetter(time.Now().Unix())
+		err := dlq.Add(letter)
+		Expect(err).NotTo(HaveOccurred())
+
+		found, err := dlq.Replay(letter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		res, err := testClient.LRange(dlq.Queue, 0, -1).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(HaveLen(1))
+
+		var hook map[string]interface{}
+		err = json.Unmarshal([]byte(res[0]), &hook)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook["attempts"]).To(BeEquivalentTo(0))
+		Expect(hook["method"]).To(Equal("POST"))
+		Expect(hook["url"]).To(Equal("http://test.com/hook"))
+		Expect(hook["payload"]).To(Equal("{\"x\":1}"))
+
+		found, err = dlq.Replay(letter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+
+	It("should replay dead letter to the queue of its tenant with its options", func() {
+		_, err := testClient.SAdd(TenantsKey(dlq.Queue), "tenant-a").Result()
+		Expect(err).NotTo(HaveOccurred())
+
+		letter := newDeadLetter(time.Now().Unix())
+		letter.Tenant = "tenant-a"
+		letter.Options = map[string]interface{}{"maxAttempts": float64(3)}
+		err = dlq.Add(letter)
+		Expect(err).NotTo(HaveOccurred())
+
+		found, err := dlq.Replay(letter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		total, err := testClient.LLen(dlq.Queue).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(0))
+
+		res, err := testClient.LRange(TenantQueue(dlq.Queue, "tenant-a"), 0, -1).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(HaveLen(1))
+
+		var hook map[string]interface{}
+		err = json.Unmarshal([]byte(res[0]), &hook)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook["tenant"]).To(Equal("tenant-a"))
+		Expect(hook["maxAttempts"]).To(BeEquivalentTo(3))
+		Expect(hook["attempts"]).To(BeEquivalentTo(0))
+	})
+
+	It("should replay dead letter to the queue of its priority", func() {
+		letter := newDeadLetter(time.Now().Unix())
+		letter.Options = map[string]interface{}{"priority": PriorityHigh}
+		err := dlq.Add(letter)
+		Expect(err).NotTo(HaveOccurred())
+
+		found, err := dlq.Replay(letter)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		total, err := testClient.LLen(PriorityQueue(dlq.Queue, PriorityHigh)).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(1))
+
+		total, err = testClient.LLen(dlq.Queue).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(0))
+	})
+})
@@ -0,0 +1,145 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/redis.v4"
+)
+
+//Delivery statuses of a hook
+const (
+	DeliveryPending   = "pending"
+	DeliveryInFlight  = "in-flight"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+//DefaultDeliveryRetention is how long delivery records are kept after their last update
+const DefaultDeliveryRetention = 7 * 24 * time.Hour
+
+//MaxDeliveryResponseLength is the maximum number of bytes of the last response body kept in a delivery record
+const MaxDeliveryResponseLength = 512
+
+//Delivery is the current delivery status of a hook
+type Delivery struct {
+	ID             string `json:"id"`
+	Method         string `json:"method"`
+	URL            string `json:"url"`
+	Tenant         string `json:"tenant,omitempty"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	LastStatusCode int    `json:"lastStatusCode"`
+	LastResponse   string `json:"lastResponse"`
+	LastError      string `json:"lastError"`
+	CreatedAt      int64  `json:"createdAt"`
+	UpdatedAt      int64  `json:"updatedAt"`
+}
+
+func (d *Delivery) toHash() map[string]string {
+	return map[string]string{
+		"id":             d.ID,
+		"method":         d.Method,
+		"url":            d.URL,
+		"tenant":         d.Tenant,
+		"status":         d.Status,
+		"attempts":       strconv.Itoa(d.Attempts),
+		"lastStatusCode": strconv.Itoa(d.LastStatusCode),
+		"lastResponse":   d.LastResponse,
+		"lastError":      d.LastError,
+		"createdAt":      strconv.FormatInt(d.CreatedAt, 10),
+		"updatedAt":      strconv.FormatInt(d.UpdatedAt, 10),
+	}
+}
+
+func deliveryFromHash(hash map[string]string) *Delivery {
+	d := &Delivery{
+		ID:           hash["id"],
+		Method:       hash["method"],
+		URL:          hash["url"],
+		Tenant:       hash["tenant"],
+		Status:       hash["status"],
+		LastResponse: hash["lastResponse"],
+		LastError:    hash["lastError"],
+	}
+	d.Attempts, _ = strconv.Atoi(hash["attempts"])
+	d.LastStatusCode, _ = strconv.Atoi(hash["lastStatusCode"])
+	d.CreatedAt, _ = strconv.ParseInt(hash["createdAt"], 10, 64)
+	d.UpdatedAt, _ = strconv.ParseInt(hash["updatedAt"], 10, 64)
+	return d
+}
+
+//NewPendingDelivery returns the delivery record of a message about to be sent to the queue
+func NewPendingDelivery(msg map[string]interface{}) *Delivery {
+	delivery := &Delivery{
+		Status: DeliveryPending,
+	}
+	delivery.ID, _ = msg["id"].(string)
+	delivery.Method, _ = msg["method"].(string)
+	delivery.URL, _ = msg["url"].(string)
+	delivery.Tenant, _ = msg["tenant"].(string)
+	delivery.CreatedAt, _ = msg["createdAt"].(int64)
+	return delivery
+}
+
+//Deliveries keeps the delivery status of the hooks of a queue by hook ID
+type Deliveries struct {
+	Client    redis.Cmdable
+	Queue     string
+	Retention time.Duration
+}
+
+//NewDeliveries returns the delivery records of the given queue
+func NewDeliveries(client redis.Cmdable, queue string, retention time.Duration) *Deliveries {
+	return &Deliveries{
+		Client:    client,
+		Queue:     queue,
+		Retention: retention,
+	}
+}
+
+//Key returns the hash holding the delivery record of the hook with the given ID
+func (d *Deliveries) Key(id string) string {
+	return fmt.Sprintf("%s:delivery:%s", d.Queue, id)
+}
+
+//Add queues the commands that store the delivery record in the given pipeline
+func (d *Deliveries) Add(pipe *redis.Pipeline, delivery *Delivery) {
+	if delivery.UpdatedAt == 0 {
+		delivery.UpdatedAt = time.Now().Unix()
+	}
+	if len(delivery.LastResponse) > MaxDeliveryResponseLength {
+		delivery.LastResponse = delivery.LastResponse[:MaxDeliveryResponseLength]
+	}
+
+	pipe.HMSet(d.Key(delivery.ID), delivery.toHash())
+	pipe.Expire(d.Key(delivery.ID), d.Retention)
+}
+
+//Save stores the delivery record, replacing the previous one
+func (d *Deliveries) Save(delivery *Delivery) error {
+	_, err := d.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		d.Add(pipe, delivery)
+		return nil
+	})
+	return err
+}
+
+//Get returns the delivery record of the hook with the given ID or nil if it does not exist
+func (d *Deliveries) Get(id string) (*Delivery, error) {
+	hash, err := d.Client.HGetAll(d.Key(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(hash) == 0 {
+		return nil, nil
+	}
+	return deliveryFromHash(hash), nil
+}
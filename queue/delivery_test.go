@@ -0,0 +1,77 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"strings"
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Deliveries", func() {
+	var testClient *redis.Client
+	var deliveries *Deliveries
+
+	BeforeEach(func() {
+		cli, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+		deliveries = NewDeliveries(testClient, uuid.NewV4().String(), time.Minute)
+	})
+
+	It("should save and get delivery", func() {
+		delivery := &Delivery{
+			ID:             uuid.NewV4().String(),
+			Method:         "POST",
+			URL:            "http://test.com/hook",
+			Status:         DeliveryDelivered,
+			Attempts:       2,
+			LastStatusCode: 200,
+			LastResponse:   "OK",
+			CreatedAt:      1478401023,
+			UpdatedAt:      1478401033,
+		}
+		err := deliveries.Save(delivery)
+		Expect(err).NotTo(HaveOccurred())
+
+		stored, err := deliveries.Get(delivery.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(Equal(delivery))
+
+		ttl, err := testClient.TTL(deliveries.Key(delivery.ID)).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ttl).To(BeNumerically(">", 0))
+		Expect(ttl).To(BeNumerically("<=", time.Minute))
+	})
+
+	It("should truncate last response", func() {
+		delivery := &Delivery{
+			ID:           uuid.NewV4().String(),
+			Status:       DeliveryPending,
+			LastResponse: strings.Repeat("a", MaxDeliveryResponseLength+10),
+		}
+		err := deliveries.Save(delivery)
+		Expect(err).NotTo(HaveOccurred())
+
+		stored, err := deliveries.Get(delivery.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.LastResponse).To(HaveLen(MaxDeliveryResponseLength))
+		Expect(stored.UpdatedAt).To(BeNumerically(">", 0))
+	})
+
+	It("should return nil for unknown delivery", func() {
+		stored, err := deliveries.Get(uuid.NewV4().String())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(BeNil())
+	})
+})
@@ -0,0 +1,174 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//PrivateNetworks are the loopback, private, link-local (including cloud metadata endpoints), multicast,
+//benchmarking, reserved and otherwise internal networks denied when an egress policy denies private networks
+var PrivateNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+//EgressError is returned when a hook destination is not allowed by the egress policy
+type EgressError struct {
+	Reason string
+}
+
+func (e *EgressError) Error() string {
+	return fmt.Sprintf("Hook destination is not allowed: %s", e.Reason)
+}
+
+//EgressConfig describes an egress policy in configuration files
+type EgressConfig struct {
+	Schemes             []string `mapstructure:"schemes"`
+	Ports               []int    `mapstructure:"ports"`
+	DenyPrivateNetworks bool     `mapstructure:"denyPrivateNetworks"`
+	Deny                []string `mapstructure:"deny"`
+	Allow               []string `mapstructure:"allow"`
+}
+
+//EgressPolicy restricts the destinations hooks may be sent to, so hooks can not be used to reach internal services.
+//Addresses in Allow are allowed even if they are in Deny. Empty Ports allow any port
+type EgressPolicy struct {
+	Schemes map[string]bool
+	Ports   map[int]bool
+	Deny    []*net.IPNet
+	Allow   []*net.IPNet
+}
+
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	result := []*net.IPNet{}
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("'%s' is not an IP address or CIDR", network)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			network = fmt.Sprintf("%s/%d", network, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an IP address or CIDR", network)
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+//NewEgressPolicy returns the egress policy described by the given config. Only http and https are allowed if it sets no schemes
+func NewEgressPolicy(config *EgressConfig) (*EgressPolicy, error) {
+	policy := &EgressPolicy{
+		Schemes: map[string]bool{},
+		Ports:   map[int]bool{},
+	}
+
+	schemes := config.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	for _, scheme := range schemes {
+		policy.Schemes[strings.ToLower(scheme)] = true
+	}
+	for _, port := range config.Ports {
+		policy.Ports[port] = true
+	}
+
+	deny := config.Deny
+	if config.DenyPrivateNetworks {
+		deny = append(append([]string{}, PrivateNetworks...), deny...)
+	}
+	var err error
+	policy.Deny, err = parseNetworks(deny)
+	if err != nil {
+		return nil, err
+	}
+	policy.Allow, err = parseNetworks(config.Allow)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//CheckIP returns an error if hooks may not be sent to the given address
+func (p *EgressPolicy) CheckIP(ip net.IP) error {
+	if containsIP(p.Allow, ip) {
+		return nil
+	}
+	if containsIP(p.Deny, ip) {
+		return &EgressError{Reason: fmt.Sprintf("address %s is denied", ip)}
+	}
+	return nil
+}
+
+//CheckURL returns an error if hooks may not be sent to the given URL because of its scheme, port or IP address.
+//Host names are not resolved, so their addresses must be checked with CheckIP once resolved
+func (p *EgressPolicy) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return &EgressError{Reason: "invalid URL"}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !p.Schemes[scheme] {
+		return &EgressError{Reason: fmt.Sprintf("scheme %s is denied", u.Scheme)}
+	}
+
+	host, portString, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host = strings.Trim(u.Host, "[]")
+		portString = "80"
+		if scheme == "https" {
+			portString = "443"
+		}
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return &EgressError{Reason: fmt.Sprintf("invalid port %s", portString)}
+	}
+	if len(p.Ports) > 0 && !p.Ports[port] {
+		return &EgressError{Reason: fmt.Sprintf("port %d is denied", port)}
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(ip)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Egress policy", func() {
+	var newPolicy = func(config *EgressConfig) *EgressPolicy {
+		policy, err := NewEgressPolicy(config)
+		Expect(err).NotTo(HaveOccurred())
+		return policy
+	}
+
+	It("should fail to create policy with invalid networks", func() {
+		_, err := NewEgressPolicy(&EgressConfig{Deny: []string{"10.0.0.0/33"}})
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewEgressPolicy(&EgressConfig{Allow: []string{"not-an-ip"}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should only allow http and https by default", func() {
+		policy := newPolicy(&EgressConfig{})
+		Expect(policy.CheckURL("http://example.com/hook")).To(BeNil())
+		Expect(policy.CheckURL("https://example.com/hook")).To(BeNil())
+		Expect(policy.CheckURL("ftp://example.com/hook")).To(HaveOccurred())
+		Expect(policy.CheckURL("file:///etc/passwd")).To(HaveOccurred())
+	})
+
+	It("should restrict ports", func() {
+		policy := newPolicy(&EgressConfig{Ports: []int{443, 8443}})
+		Expect(policy.CheckURL("https://example.com/hook")).To(BeNil())
+		Expect(policy.CheckURL("https://example.com:8443/hook")).To(BeNil())
+		Expect(policy.CheckURL("http://example.com/hook")).To(HaveOccurred())
+		Expect(policy.CheckURL("https://example.com:6379/hook")).To(HaveOccurred())
+	})
+
+	It("should deny private networks", func() {
+		policy := newPolicy(&EgressConfig{DenyPrivateNetworks: true})
+		for _, url := range []string{
+			"http://127.0.0.1/hook",
+			"http://10.1.2.3/hook",
+			"http://169.254.169.254/latest/meta-data",
+			"http://192.168.0.1:8080/hook",
+			"http://[::1]/hook",
+			"http://[::ffff:127.0.0.1]/hook",
+			"http://198.18.0.1/hook",
+			"http://198.19.255.254/hook",
+			"http://224.0.0.251/hook",
+			"http://239.255.255.250:1900/hook",
+			"http://240.0.0.1/hook",
+			"http://255.255.255.255/hook",
+			"http://[ff02::1]/hook",
+		} {
+			err := policy.CheckURL(url)
+			Expect(err).To(HaveOccurred(), url)
+			_, ok := err.(*EgressError)
+			Expect(ok).To(BeTrue())
+		}
+		Expect(policy.CheckURL("http://8.8.8.8/hook")).To(BeNil())
+		Expect(policy.CheckIP(net.ParseIP("172.20.0.1"))).To(HaveOccurred())
+		Expect(policy.CheckIP(net.ParseIP("172.32.0.1"))).To(BeNil())
+		Expect(policy.CheckIP(net.ParseIP("198.20.0.1"))).To(BeNil())
+		Expect(policy.CheckIP(net.ParseIP("223.255.255.255"))).To(BeNil())
+	})
+
+	It("should allow addresses in allow list even if denied", func() {
+		policy := newPolicy(&EgressConfig{
+			DenyPrivateNetworks: true,
+			Deny:                []string{"8.8.8.0/24"},
+			Allow:               []string{"10.0.5.0/24", "8.8.8.8"},
+		})
+		Expect(policy.CheckIP(net.ParseIP("10.0.5.10"))).To(BeNil())
+		Expect(policy.CheckIP(net.ParseIP("10.0.6.10"))).To(HaveOccurred())
+		Expect(policy.CheckIP(net.ParseIP("8.8.8.8"))).To(BeNil())
+		Expect(policy.CheckIP(net.ParseIP("8.8.8.4"))).To(HaveOccurred())
+	})
+})
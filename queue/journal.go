@@ -0,0 +1,122 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/redis.v4"
+)
+
+// JournalEntry records a hook the workers started dispatching
+type JournalEntry struct {
+	ID        string                 `json:"id"`
+	Method    string                 `json:"method"`
+	URL       string                 `json:"url"`
+	Payload   string                 `json:"payload"`
+	Headers   map[string]string      `json:"headers,omitempty"`
+	Tenant    string                 `json:"tenant,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	CreatedAt int64                  `json:"createdAt"`
+	SentAt    int64                  `json:"sentAt"`
+}
+
+// Message returns the queue message that dispatches the journaled hook again from scratch with its tenant and options,
+// keeping its hook ID
+func (j *JournalEntry) Message() map[string]interface{} {
+	return newMessage(j.ID, j.Method, j.URL, j.Payload, j.Headers, j.CreatedAt, j.Tenant, j.Options)
+}
+
+// Matches returns whether the entry URL has the given host and starts with the given prefix. Empty filters match anything
+func (j *JournalEntry) Matches(host, prefix string) bool {
+	return MatchURL(j.URL, host, prefix)
+}
+
+// MatchURL returns whether the URL has the given host and starts with the given prefix. Empty filters match anything
+func MatchURL(rawURL, host, prefix string) bool {
+	if prefix != "" && !strings.HasPrefix(rawURL, prefix) {
+		return false
+	}
+	if host == "" {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if u.Host == host {
+		return true
+	}
+	hostname, _, err := net.SplitHostPort(u.Host)
+	return err == nil && hostname == host
+}
+
+// Journal keeps a rolling, time-bounded record of the hooks dispatched from a queue
+type Journal struct {
+	Client    redis.Cmdable
+	Queue     string
+	Retention time.Duration
+}
+
+// NewJournal returns the delivery journal for the given queue
+func NewJournal(client redis.Cmdable, queue string, retention time.Duration) *Journal {
+	return &Journal{
+		Client:    client,
+		Queue:     queue,
+		Retention: retention,
+	}
+}
+
+// Key returns the sorted set holding the journal entries scored by the time they were sent
+func (j *Journal) Key() string {
+	return fmt.Sprintf("%s:journal", j.Queue)
+}
+
+// Record adds an entry to the journal, discarding entries older than the retention period
+func (j *Journal) Record(entry *JournalEntry) error {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	expired := entry.SentAt - int64(j.Retention.Seconds())
+	_, err = j.Client.Pipelined(func(pipe *redis.Pipeline) error {
+		pipe.ZAdd(j.Key(), redis.Z{Score: float64(entry.SentAt), Member: string(entryJSON)})
+		pipe.ZRemRangeByScore(j.Key(), "-inf", fmt.Sprintf("(%d", expired))
+		return nil
+	})
+	return err
+}
+
+// Find returns the entries sent within the given time range, in the order they were sent
+func (j *Journal) Find(from, to time.Time) ([]*JournalEntry, error) {
+	items, err := j.Client.ZRangeByScore(j.Key(), redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*JournalEntry{}
+	for _, item := range items {
+		var entry JournalEntry
+		err = json.Unmarshal([]byte(item), &entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
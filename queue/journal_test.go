@@ -0,0 +1,78 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+func newJournalEntry(url string, sentAt int64) *JournalEntry {
+	return &JournalEntry{
+		ID:        uuid.NewV4().String(),
+		Method:    "POST",
+		URL:       url,
+		Payload:   "{\"x\":1}",
+		CreatedAt: sentAt,
+		SentAt:    sentAt,
+	}
+}
+
+var _ = Describe("Delivery Journal", func() {
+	var testClient *redis.Client
+	var journal *Journal
+
+	BeforeEach(func() {
+		cli, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+		journal = NewJournal(testClient, uuid.NewV4().String(), time.Hour)
+	})
+
+	It("should find entries sent within time range", func() {
+		now := time.Now().Unix()
+		for i := int64(3); i >= 0; i-- {
+			err := journal.Record(newJournalEntry("http://test.com/hook", now-i*60))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		entries, err := journal.Find(time.Unix(now-150, 0), time.Unix(now-60, 0))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].SentAt).To(Equal(now - 120))
+		Expect(entries[1].SentAt).To(Equal(now - 60))
+	})
+
+	It("should discard entries older than retention", func() {
+		now := time.Now().Unix()
+		err := journal.Record(newJournalEntry("http://test.com/old", now-7200))
+		Expect(err).NotTo(HaveOccurred())
+		err = journal.Record(newJournalEntry("http://test.com/new", now))
+		Expect(err).NotTo(HaveOccurred())
+
+		total, err := testClient.ZCard(journal.Key()).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(1))
+	})
+
+	It("should match entries by host and prefix", func() {
+		entry := newJournalEntry("https://api.partner.com:8443/hooks/purchase", 0)
+
+		Expect(entry.Matches("api.partner.com", "")).To(BeTrue())
+		Expect(entry.Matches("api.partner.com:8443", "")).To(BeTrue())
+		Expect(entry.Matches("", "https://api.partner.com:8443/hooks")).To(BeTrue())
+		Expect(entry.Matches("api.partner.com", "https://api.partner.com:8443/hooks/purchase")).To(BeTrue())
+		Expect(entry.Matches("other.partner.com", "")).To(BeFalse())
+		Expect(entry.Matches("api.partner.com", "https://api.partner.com:8443/other")).To(BeFalse())
+	})
+})
@@ -0,0 +1,63 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+//messageFields are the fields of queue messages kept apart from the hook options in dead letters and journal entries,
+//either because they are stored on their own or because they are the delivery state of a single dispatch
+var messageFields = map[string]bool{
+	"id":           true,
+	"method":       true,
+	"url":          true,
+	"payload":      true,
+	"headers":      true,
+	"createdAt":    true,
+	"tenant":       true,
+	"attempts":     true,
+	"backoff":      true,
+	"retryDelayMs": true,
+	"expires":      true,
+}
+
+//MessageOptions returns the options the hook was enqueued with, i.e. its priority, max attempts, timeout,
+//tags, idempotency key or retry policy, so it can be dispatched again with them
+func MessageOptions(msg map[string]interface{}) map[string]interface{} {
+	options := map[string]interface{}{}
+	for key, value := range msg {
+		if !messageFields[key] {
+			options[key] = value
+		}
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+//newMessage returns the queue message that dispatches a hook again from scratch with its options, keeping its hook ID.
+//Hooks dispatched again do not keep their expiration, since they would never be sent otherwise
+func newMessage(
+	id, method, url, payload string, headers map[string]string, createdAt int64,
+	tenant string, options map[string]interface{},
+) map[string]interface{} {
+	msg := map[string]interface{}{}
+	for key, value := range options {
+		msg[key] = value
+	}
+	msg["id"] = id
+	msg["method"] = method
+	msg["url"] = url
+	msg["payload"] = payload
+	msg["attempts"] = 0
+	msg["createdAt"] = createdAt
+	if len(headers) > 0 {
+		msg["headers"] = headers
+	}
+	if tenant != "" {
+		msg["tenant"] = tenant
+	}
+	return msg
+}
@@ -0,0 +1,40 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import "fmt"
+
+const (
+	//PriorityHigh is the priority of urgent hooks, i.e. purchase confirmations
+	PriorityHigh = "high"
+	//PriorityNormal is the priority of hooks that do not set one
+	PriorityNormal = "normal"
+	//PriorityLow is the priority of hooks that may wait, i.e. analytics
+	PriorityLow = "low"
+)
+
+//Priorities are the priorities hooks may have, from highest to lowest
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+//ValidPriority returns whether the given priority is one of Priorities
+func ValidPriority(priority string) bool {
+	for _, p := range Priorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+//PriorityQueue returns the queue holding the hooks of the given queue with the priority.
+//Hooks with normal or no priority stay in the queue itself. RouteFunction builds the same name in Lua scripts
+func PriorityQueue(queue, priority string) string {
+	if priority == "" || priority == PriorityNormal {
+		return queue
+	}
+	return fmt.Sprintf("%s:priority:%s", queue, priority)
+}
@@ -0,0 +1,31 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Priority", func() {
+	It("should validate priorities", func() {
+		Expect(ValidPriority(PriorityHigh)).To(BeTrue())
+		Expect(ValidPriority(PriorityNormal)).To(BeTrue())
+		Expect(ValidPriority(PriorityLow)).To(BeTrue())
+		Expect(ValidPriority("")).To(BeFalse())
+		Expect(ValidPriority("urgent")).To(BeFalse())
+	})
+
+	It("should return the queue of the priority", func() {
+		Expect(PriorityQueue("webhooks", PriorityHigh)).To(Equal("webhooks:priority:high"))
+		Expect(PriorityQueue("webhooks", PriorityLow)).To(Equal("webhooks:priority:low"))
+		Expect(PriorityQueue("webhooks", PriorityNormal)).To(Equal("webhooks"))
+		Expect(PriorityQueue("webhooks", "")).To(Equal("webhooks"))
+		Expect(PriorityQueue(TenantQueue("webhooks", "tenant-a"), PriorityHigh)).To(Equal("webhooks:tenant:tenant-a:priority:high"))
+	})
+})
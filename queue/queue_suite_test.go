@@ -0,0 +1,44 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Santiago Queue Suite")
+}
+
+//getTestRedisConn returns a connection to the test redis server
+func getTestRedisConn() (*redis.Client, error) {
+	redisPort := 57575
+	redisPortEnv := os.Getenv("REDIS_PORT")
+	if redisPortEnv != "" {
+		res, err := strconv.ParseInt(redisPortEnv, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		redisPort = int(res)
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("localhost:%d", redisPort),
+		Password: "", // no password set
+		DB:       0,  // use default DB
+	})
+	return client, nil
+}
@@ -0,0 +1,34 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"fmt"
+
+	"gopkg.in/redis.v4"
+)
+
+//SignalFunction is the Lua function scripts use to signal the ready list after pushing hooks to the queues.
+//The list keeps a single element, since each worker woken by it signals it again while there are hooks left
+const SignalFunction = `
+local function signal(ready)
+	redis.call("RPUSH", ready, 1)
+	redis.call("LTRIM", ready, 0, 0)
+end
+`
+
+//ReadyKey returns the list workers in reliable mode block on while the queues are empty, since Redis can only
+//block moving messages from a single list. It is signaled whenever hooks are pushed to any queue of every priority and tenant
+func ReadyKey(queue string) string {
+	return fmt.Sprintf("%s:ready", queue)
+}
+
+//Signal signals the ready list of the queue in the given pipeline, after the hooks are pushed
+func Signal(pipe *redis.Pipeline, queue string) {
+	pipe.RPush(ReadyKey(queue), 1)
+	pipe.LTrim(ReadyKey(queue), 0, 0)
+}
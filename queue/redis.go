@@ -0,0 +1,152 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/redis.v4"
+)
+
+//Redis deployments the queue can be kept in
+const (
+	RedisSingle   = "single"
+	RedisSentinel = "sentinel"
+	RedisCluster  = "cluster"
+)
+
+//RedisModes are the valid Redis deployments
+var RedisModes = []string{RedisSingle, RedisSentinel, RedisCluster}
+
+//connectRetryInterval is the time to wait between failed attempts to connect to Redis, times the number of attempts
+const connectRetryInterval = 250 * time.Millisecond
+
+//RedisOptions configure the connection to Redis. Zero timeouts, pool size and cluster redirects keep the defaults of the client
+type RedisOptions struct {
+	Mode          string
+	Host          string
+	Port          int
+	Password      string
+	DB            int
+	MasterName    string
+	SentinelAddrs []string
+	ClusterAddrs  []string
+	MaxRetries    int
+	MaxRedirects  int
+	DialTimeout   time.Duration
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	PoolSize      int
+	PoolTimeout   time.Duration
+	IdleTimeout   time.Duration
+}
+
+//Addrs returns the addresses the client connects to first: the node, the sentinels or the cluster nodes
+func (o *RedisOptions) Addrs() []string {
+	switch o.Mode {
+	case RedisSentinel:
+		return o.SentinelAddrs
+	case RedisCluster:
+		return o.ClusterAddrs
+	}
+	return []string{fmt.Sprintf("%s:%d", o.Host, o.Port)}
+}
+
+//Client returns a client of the configured Redis deployment without connecting to it. Sentinel clients follow
+//the master across failovers and cluster clients route each command to the node with its keys
+func (o *RedisOptions) Client() (redis.Cmdable, error) {
+	switch o.Mode {
+	case "", RedisSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:         fmt.Sprintf("%s:%d", o.Host, o.Port),
+			Password:     o.Password,
+			DB:           o.DB,
+			MaxRetries:   o.MaxRetries,
+			DialTimeout:  o.DialTimeout,
+			ReadTimeout:  o.ReadTimeout,
+			WriteTimeout: o.WriteTimeout,
+			PoolSize:     o.PoolSize,
+			PoolTimeout:  o.PoolTimeout,
+			IdleTimeout:  o.IdleTimeout,
+		}), nil
+	case RedisSentinel:
+		if o.MasterName == "" || len(o.SentinelAddrs) == 0 {
+			return nil, fmt.Errorf("sentinel mode requires the master name and the addresses of the sentinels")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    o.MasterName,
+			SentinelAddrs: o.SentinelAddrs,
+			Password:      o.Password,
+			DB:            o.DB,
+			MaxRetries:    o.MaxRetries,
+			DialTimeout:   o.DialTimeout,
+			ReadTimeout:   o.ReadTimeout,
+			WriteTimeout:  o.WriteTimeout,
+			PoolSize:      o.PoolSize,
+			PoolTimeout:   o.PoolTimeout,
+			IdleTimeout:   o.IdleTimeout,
+		}), nil
+	case RedisCluster:
+		if len(o.ClusterAddrs) == 0 {
+			return nil, fmt.Errorf("cluster mode requires the addresses of the cluster nodes")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        o.ClusterAddrs,
+			MaxRedirects: o.MaxRedirects,
+			Password:     o.Password,
+			DialTimeout:  o.DialTimeout,
+			ReadTimeout:  o.ReadTimeout,
+			WriteTimeout: o.WriteTimeout,
+			PoolSize:     o.PoolSize,
+			PoolTimeout:  o.PoolTimeout,
+			IdleTimeout:  o.IdleTimeout,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown redis mode %s", o.Mode)
+}
+
+//Connect returns a client of the configured Redis deployment once it answers a ping. Failed pings are retried
+//MaxRetries times, waiting a little longer after each one, so a failover in progress does not stop the API or a worker
+func (o *RedisOptions) Connect() (redis.Cmdable, error) {
+	client, err := o.Client()
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		err = client.Ping().Err()
+		if err == nil || attempt >= o.MaxRetries {
+			break
+		}
+		time.Sleep(time.Duration(attempt+1) * connectRetryInterval)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+//QueueName returns the name of the keys of the queue in the configured Redis deployment. In a cluster the name is
+//hash tagged, so every key of the queue is kept in the same slot and multi-key commands and scripts remain valid
+func (o *RedisOptions) QueueName(queue string) string {
+	if o.Mode == RedisCluster {
+		return HashTag(queue)
+	}
+	return queue
+}
+
+//HashTag returns the name wrapped in braces, so Redis Cluster hashes every key starting with it to the same slot.
+//Names that already have a hash tag are returned as they are
+func HashTag(name string) string {
+	if start := strings.Index(name, "{"); start >= 0 {
+		if end := strings.Index(name[start+1:], "}"); end > 0 {
+			return name
+		}
+	}
+	return fmt.Sprintf("{%s}", name)
+}
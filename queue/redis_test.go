@@ -0,0 +1,79 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"os"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Redis", func() {
+	It("should hash tag queue names", func() {
+		Expect(HashTag("webhooks")).To(Equal("{webhooks}"))
+		Expect(HashTag("{webhooks}")).To(Equal("{webhooks}"))
+		Expect(HashTag("app:{webhooks}")).To(Equal("app:{webhooks}"))
+		Expect(HashTag("web{}hooks")).To(Equal("{web{}hooks}"))
+	})
+
+	It("should hash tag the queue only in cluster mode", func() {
+		Expect((&RedisOptions{Mode: RedisSingle}).QueueName("webhooks")).To(Equal("webhooks"))
+		Expect((&RedisOptions{Mode: RedisSentinel}).QueueName("webhooks")).To(Equal("webhooks"))
+
+		options := &RedisOptions{Mode: RedisCluster}
+		Expect(options.QueueName("webhooks")).To(Equal("{webhooks}"))
+		Expect(TenantQueue(options.QueueName("webhooks"), "tenant-a")).To(Equal("{webhooks}:tenant:tenant-a"))
+	})
+
+	It("should return the addresses of the deployment", func() {
+		options := &RedisOptions{
+			Mode:          RedisSingle,
+			Host:          "localhost",
+			Port:          6379,
+			SentinelAddrs: []string{"sentinel-1:26379", "sentinel-2:26379"},
+			ClusterAddrs:  []string{"node-1:7000"},
+		}
+		Expect(options.Addrs()).To(Equal([]string{"localhost:6379"}))
+		options.Mode = RedisSentinel
+		Expect(options.Addrs()).To(Equal([]string{"sentinel-1:26379", "sentinel-2:26379"}))
+		options.Mode = RedisCluster
+		Expect(options.Addrs()).To(Equal([]string{"node-1:7000"}))
+	})
+
+	It("should fail to create clients of incomplete deployments", func() {
+		_, err := (&RedisOptions{Mode: RedisSentinel, SentinelAddrs: []string{"sentinel-1:26379"}}).Client()
+		Expect(err).To(HaveOccurred())
+
+		_, err = (&RedisOptions{Mode: RedisCluster}).Client()
+		Expect(err).To(HaveOccurred())
+
+		_, err = (&RedisOptions{Mode: "replicated"}).Client()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("unknown redis mode replicated"))
+	})
+
+	It("should connect to a single node", func() {
+		port := 57575
+		if portEnv := os.Getenv("REDIS_PORT"); portEnv != "" {
+			p, err := strconv.Atoi(portEnv)
+			Expect(err).NotTo(HaveOccurred())
+			port = p
+		}
+
+		client, err := (&RedisOptions{Mode: RedisSingle, Host: "localhost", Port: port, MaxRetries: 1}).Connect()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Ping().Err()).NotTo(HaveOccurred())
+	})
+
+	It("should retry and fail to connect to an unreachable node", func() {
+		_, err := (&RedisOptions{Mode: RedisSingle, Host: "localhost", Port: 1, MaxRetries: 1}).Connect()
+		Expect(err).To(HaveOccurred())
+	})
+})
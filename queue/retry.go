@@ -0,0 +1,176 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+//Retry policies
+const (
+	RetryExponential = "exponential"
+	RetryLinear      = "linear"
+	RetryFixed       = "fixed"
+)
+
+//Jitter strategies of the exponential retry policy
+const (
+	JitterNone         = "none"
+	JitterFull         = "full"
+	JitterDecorrelated = "decorrelated"
+)
+
+//RetryPolicy computes how long a failed hook waits before being sent again
+type RetryPolicy interface {
+	//Delay returns the delay before the given retry (the first retry is 1), given the delay before the previous one
+	Delay(retry int, previous time.Duration) time.Duration
+}
+
+//ExponentialPolicy waits Base * 2^retry, capped at MaxDelay if it is set.
+//Full jitter waits a random time up to that delay, while decorrelated jitter waits a random time
+//between Base and three times the previous delay, so retries of hooks that failed together spread out
+type ExponentialPolicy struct {
+	Base     time.Duration
+	MaxDelay time.Duration
+	Jitter   string
+}
+
+//Delay returns the delay before the given retry
+func (p *ExponentialPolicy) Delay(retry int, previous time.Duration) time.Duration {
+	switch p.Jitter {
+	case JitterFull:
+		return randomDuration(0, capDelay(exponentialDelay(p.Base, retry), p.MaxDelay))
+	case JitterDecorrelated:
+		if previous < p.Base {
+			previous = p.Base
+		}
+		return capDelay(randomDuration(p.Base, previous*3), p.MaxDelay)
+	}
+	return capDelay(exponentialDelay(p.Base, retry), p.MaxDelay)
+}
+
+//LinearPolicy waits Base * retry, capped at MaxDelay if it is set
+type LinearPolicy struct {
+	Base     time.Duration
+	MaxDelay time.Duration
+}
+
+//Delay returns the delay before the given retry
+func (p *LinearPolicy) Delay(retry int, previous time.Duration) time.Duration {
+	return capDelay(p.Base*time.Duration(retry), p.MaxDelay)
+}
+
+//FixedPolicy waits the delays in Schedule in order, repeating the last one once the schedule is over
+type FixedPolicy struct {
+	Schedule []time.Duration
+}
+
+//Delay returns the delay before the given retry
+func (p *FixedPolicy) Delay(retry int, previous time.Duration) time.Duration {
+	if len(p.Schedule) == 0 {
+		return 0
+	}
+	if retry < 1 {
+		retry = 1
+	}
+	if retry > len(p.Schedule) {
+		retry = len(p.Schedule)
+	}
+	return p.Schedule[retry-1]
+}
+
+func exponentialDelay(base time.Duration, retry int) time.Duration {
+	delay := float64(base) * math.Pow(2, float64(retry))
+	if delay >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
+
+func capDelay(delay, maxDelay time.Duration) time.Duration {
+	if maxDelay > 0 && delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+func randomDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
+
+//RetryConfig describes a retry policy in configuration files and hooks
+type RetryConfig struct {
+	Policy     string  `mapstructure:"policy" json:"policy"`
+	BaseMs     int64   `mapstructure:"baseMs" json:"baseMs,omitempty"`
+	MaxDelayMs int64   `mapstructure:"maxDelayMs" json:"maxDelayMs,omitempty"`
+	Jitter     string  `mapstructure:"jitter" json:"jitter,omitempty"`
+	ScheduleMs []int64 `mapstructure:"scheduleMs" json:"scheduleMs,omitempty"`
+}
+
+//Validate returns an error describing the first invalid field of the retry policy
+func (c *RetryConfig) Validate() error {
+	switch c.Policy {
+	case RetryExponential, RetryLinear, RetryFixed:
+	default:
+		return fmt.Errorf("'policy' must be one of exponential, linear or fixed")
+	}
+
+	if c.BaseMs < 0 {
+		return fmt.Errorf("'baseMs' must not be negative")
+	}
+	if c.MaxDelayMs < 0 {
+		return fmt.Errorf("'maxDelayMs' must not be negative")
+	}
+
+	switch c.Jitter {
+	case "", JitterNone, JitterFull, JitterDecorrelated:
+	default:
+		return fmt.Errorf("'jitter' must be one of none, full or decorrelated")
+	}
+
+	if c.Policy == RetryFixed && len(c.ScheduleMs) == 0 {
+		return fmt.Errorf("'scheduleMs' must have at least one delay for fixed policies")
+	}
+	for _, delay := range c.ScheduleMs {
+		if delay < 0 {
+			return fmt.Errorf("'scheduleMs' must not have negative delays")
+		}
+	}
+	return nil
+}
+
+//NewRetryPolicy returns the retry policy described by the given config. Policies without a base delay use defaultBase
+func NewRetryPolicy(config *RetryConfig, defaultBase time.Duration) (RetryPolicy, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	base := time.Duration(config.BaseMs) * time.Millisecond
+	if base == 0 {
+		base = defaultBase
+	}
+	maxDelay := time.Duration(config.MaxDelayMs) * time.Millisecond
+
+	switch config.Policy {
+	case RetryLinear:
+		return &LinearPolicy{Base: base, MaxDelay: maxDelay}, nil
+	case RetryFixed:
+		schedule := make([]time.Duration, len(config.ScheduleMs))
+		for i, delay := range config.ScheduleMs {
+			schedule[i] = time.Duration(delay) * time.Millisecond
+		}
+		return &FixedPolicy{Schedule: schedule}, nil
+	}
+	return &ExponentialPolicy{Base: base, MaxDelay: maxDelay, Jitter: config.Jitter}, nil
+}
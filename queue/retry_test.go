@@ -0,0 +1,102 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Retry policies", func() {
+	Describe("Exponential", func() {
+		It("should double the delay on every retry", func() {
+			policy := &ExponentialPolicy{Base: time.Second}
+			Expect(policy.Delay(1, 0)).To(Equal(2 * time.Second))
+			Expect(policy.Delay(2, 0)).To(Equal(4 * time.Second))
+			Expect(policy.Delay(10, 0)).To(Equal(1024 * time.Second))
+		})
+
+		It("should cap the delay", func() {
+			policy := &ExponentialPolicy{Base: time.Second, MaxDelay: time.Minute}
+			Expect(policy.Delay(5, 0)).To(Equal(32 * time.Second))
+			Expect(policy.Delay(6, 0)).To(Equal(time.Minute))
+			Expect(policy.Delay(100, 0)).To(Equal(time.Minute))
+		})
+
+		It("should wait up to the delay with full jitter", func() {
+			policy := &ExponentialPolicy{Base: time.Second, MaxDelay: time.Minute, Jitter: JitterFull}
+			for i := 0; i < 100; i++ {
+				delay := policy.Delay(3, 0)
+				Expect(delay).To(BeNumerically(">=", 0))
+				Expect(delay).To(BeNumerically("<", 8*time.Second))
+			}
+		})
+
+		It("should wait up to three times the previous delay with decorrelated jitter", func() {
+			policy := &ExponentialPolicy{Base: time.Second, MaxDelay: time.Minute, Jitter: JitterDecorrelated}
+			for i := 0; i < 100; i++ {
+				delay := policy.Delay(3, 10*time.Second)
+				Expect(delay).To(BeNumerically(">=", time.Second))
+				Expect(delay).To(BeNumerically("<", 30*time.Second))
+
+				delay = policy.Delay(10, 50*time.Second)
+				Expect(delay).To(BeNumerically("<=", time.Minute))
+			}
+		})
+	})
+
+	Describe("Linear", func() {
+		It("should increase the delay on every retry", func() {
+			policy := &LinearPolicy{Base: 10 * time.Second, MaxDelay: time.Minute}
+			Expect(policy.Delay(1, 0)).To(Equal(10 * time.Second))
+			Expect(policy.Delay(3, 0)).To(Equal(30 * time.Second))
+			Expect(policy.Delay(10, 0)).To(Equal(time.Minute))
+		})
+	})
+
+	Describe("Fixed", func() {
+		It("should follow the schedule and repeat its last delay", func() {
+			policy := &FixedPolicy{Schedule: []time.Duration{time.Second, time.Minute}}
+			Expect(policy.Delay(1, 0)).To(Equal(time.Second))
+			Expect(policy.Delay(2, 0)).To(Equal(time.Minute))
+			Expect(policy.Delay(5, 0)).To(Equal(time.Minute))
+		})
+	})
+
+	Describe("NewRetryPolicy", func() {
+		It("should build policies using the default base delay", func() {
+			policy, err := NewRetryPolicy(&RetryConfig{Policy: RetryExponential, MaxDelayMs: 60000}, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(Equal(&ExponentialPolicy{Base: time.Second, MaxDelay: time.Minute}))
+
+			policy, err = NewRetryPolicy(&RetryConfig{Policy: RetryLinear, BaseMs: 500}, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(Equal(&LinearPolicy{Base: 500 * time.Millisecond}))
+
+			policy, err = NewRetryPolicy(&RetryConfig{Policy: RetryFixed, ScheduleMs: []int64{1000, 5000}}, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(Equal(&FixedPolicy{Schedule: []time.Duration{time.Second, 5 * time.Second}}))
+		})
+
+		It("should fail with invalid config", func() {
+			_, err := NewRetryPolicy(&RetryConfig{Policy: "random"}, time.Second)
+			Expect(err).To(MatchError(ContainSubstring("'policy'")))
+
+			_, err = NewRetryPolicy(&RetryConfig{Policy: RetryExponential, Jitter: "some"}, time.Second)
+			Expect(err).To(MatchError(ContainSubstring("'jitter'")))
+
+			_, err = NewRetryPolicy(&RetryConfig{Policy: RetryLinear, MaxDelayMs: -1}, time.Second)
+			Expect(err).To(MatchError(ContainSubstring("'maxDelayMs'")))
+
+			_, err = NewRetryPolicy(&RetryConfig{Policy: RetryFixed, ScheduleMs: []int64{1000, -1}}, time.Second)
+			Expect(err).To(MatchError(ContainSubstring("'scheduleMs'")))
+		})
+	})
+})
@@ -0,0 +1,292 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"gopkg.in/redis.v4"
+)
+
+//MaxTenantLength is the maximum length of tenant names
+const MaxTenantLength = 64
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+//quotaScript atomically checks the queue depth and rate quotas of a tenant for ARGV[2] new hooks and, if both allow them,
+//takes as many tokens from the bucket in KEYS[1]. The queue depth is the sum of the lengths of the other keys, the tenant queues.
+//It returns 0 if allowed, -1 if over the depth quota, -2 if more hooks than the burst were sent at once or the time in ms
+//until enough tokens are available if over the rate quota
+var quotaScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local count = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local burst = tonumber(ARGV[4])
+local maxDepth = tonumber(ARGV[5])
+
+if maxDepth > 0 then
+	local depth = 0
+	for i = 2, #KEYS do
+		depth = depth + redis.call("LLEN", KEYS[i])
+	end
+	if depth + count > maxDepth then
+		return -1
+	end
+end
+
+if rate > 0 then
+	if count > burst then
+		return -2
+	end
+	local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+	local tokens = tonumber(bucket[1]) or burst
+	local ts = tonumber(bucket[2]) or now
+	tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+	if tokens < count then
+		return math.ceil((count - tokens) * 1000 / rate)
+	end
+	redis.call("HMSET", KEYS[1], "tokens", tokens - count, "ts", now)
+	redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+end
+return 0
+`)
+
+//RouteFunction is the Lua function scripts use to find the queue a message goes back to, like the API publishes hooks:
+//the queue of its priority within the queue of its tenant if the tenant has its own queue, or else within the queue itself.
+//Redis Cluster rejects keys scripts are not given, so scripts call route_keys with the index of the first of the keys
+//returned by RouteKeys and messages are only routed to those keys
+const RouteFunction = `
+local routes = {}
+local function route_keys(first)
+	for i = first, #KEYS do
+		routes[KEYS[i]] = true
+	end
+end
+local function route(queue, msg)
+	local target = queue
+	local ok, data = pcall(cjson.decode, msg)
+	if not ok or type(data) ~= "table" then
+		return target
+	end
+	if type(data.tenant) == "string" and data.tenant ~= "" then
+		if routes[target .. ":tenant:" .. data.tenant] then
+			target = target .. ":tenant:" .. data.tenant
+		end
+	end
+	if data.priority == "high" or data.priority == "low" then
+		if routes[target .. ":priority:" .. data.priority] then
+			target = target .. ":priority:" .. data.priority
+		end
+	end
+	return target
+end
+`
+
+//RouteKeys returns the queues of every priority of the queue and of the tenants with their own queue,
+//which scripts using RouteFunction must be given. They share the hash tag of the queue in cluster mode
+func RouteKeys(client redis.Cmdable, queue string) ([]string, error) {
+	tenants := NewTenants(client, queue)
+	names, err := tenants.List()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := tenants.queuesFor("")
+	for _, tenant := range names {
+		keys = append(keys, tenants.queuesFor(tenant)...)
+	}
+	return keys, nil
+}
+
+//requeueScript pushes the messages in ARGV to the queues they are routed to, signaling the ready list in KEYS[2]
+var requeueScript = redis.NewScript(RouteFunction + SignalFunction + `
+route_keys(3)
+for i = 1, #ARGV do
+	redis.call("RPUSH", route(KEYS[1], ARGV[i]), ARGV[i])
+end
+signal(KEYS[2])
+return #ARGV
+`)
+
+//Requeue pushes the given messages back to the queue of their priority, in the queue of their tenant if it has its own queue
+func Requeue(client redis.Cmdable, queue string, msgs ...string) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	routes, err := RouteKeys(client, queue)
+	if err != nil {
+		return err
+	}
+	args := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		args[i] = msg
+	}
+	return requeueScript.Run(client, append([]string{queue, ReadyKey(queue)}, routes...), args...).Err()
+}
+
+//ValidTenant returns whether the given tenant name may be used. Tenants are part of Redis keys, so only
+//letters, digits, dots, dashes and underscores are allowed
+func ValidTenant(tenant string) bool {
+	return len(tenant) <= MaxTenantLength && tenantPattern.MatchString(tenant)
+}
+
+//TenantQueue returns the queue holding the hooks of the tenant.
+//The promotion of scheduled hooks by workers builds the same name
+func TenantQueue(queue, tenant string) string {
+	return fmt.Sprintf("%s:tenant:%s", queue, tenant)
+}
+
+//TenantsKey returns the set of tenants with their own queue
+func TenantsKey(queue string) string {
+	return fmt.Sprintf("%s:tenants", queue)
+}
+
+//TenantQuota caps the rate hooks of a tenant are enqueued at, allowing up to Burst hooks at once (defaults to Rate),
+//and the number of hooks waiting in its queue. Zero means no limit
+type TenantQuota struct {
+	Tenant   string  `mapstructure:"tenant"`
+	Rate     float64 `mapstructure:"rate"`
+	Burst    int     `mapstructure:"burst"`
+	MaxDepth int64   `mapstructure:"maxDepth"`
+}
+
+//GetBurst returns the number of hooks allowed at once by the rate quota, defaulting to one second worth of hooks
+func (q *TenantQuota) GetBurst() int {
+	if q.Burst > 0 {
+		return q.Burst
+	}
+	return int(math.Max(1, math.Ceil(q.Rate)))
+}
+
+//QuotaError is returned when enqueueing hooks would exceed the quota of their tenant
+type QuotaError struct {
+	Tenant     string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("Quota of tenant %s exceeded: %s", e.Tenant, e.Reason)
+}
+
+//Tenants keeps track of the tenants with their own queue and enforces their quotas across all API instances using Redis
+type Tenants struct {
+	Client       redis.Cmdable
+	Queue        string
+	DefaultQuota *TenantQuota
+	Quotas       []*TenantQuota
+}
+
+//NewTenants returns the tenants of the given queue, without quotas
+func NewTenants(client redis.Cmdable, queue string) *Tenants {
+	return &Tenants{
+		Client:       client,
+		Queue:        queue,
+		DefaultQuota: &TenantQuota{},
+		Quotas:       []*TenantQuota{},
+	}
+}
+
+//Key returns the set of tenants with their own queue
+func (t *Tenants) Key() string {
+	return TenantsKey(t.Queue)
+}
+
+func (t *Tenants) bucketKey(tenant string) string {
+	return fmt.Sprintf("%s:quota", TenantQueue(t.Queue, tenant))
+}
+
+//QueueFor returns the queue holding the hooks of the tenant, or the queue itself for hooks without tenant
+func (t *Tenants) QueueFor(tenant string) string {
+	if tenant == "" {
+		return t.Queue
+	}
+	return TenantQueue(t.Queue, tenant)
+}
+
+//Register adds the tenant to the tenants with their own queue in the given pipeline
+func (t *Tenants) Register(pipe *redis.Pipeline, tenant string) {
+	pipe.SAdd(t.Key(), tenant)
+}
+
+//List returns the tenants with their own queue, sorted by name
+func (t *Tenants) List() ([]string, error) {
+	tenants, err := t.Client.SMembers(t.Key()).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+//queuesFor returns the queues of every priority of the tenant
+func (t *Tenants) queuesFor(tenant string) []string {
+	queues := make([]string, len(Priorities))
+	for i, priority := range Priorities {
+		queues[i] = PriorityQueue(t.QueueFor(tenant), priority)
+	}
+	return queues
+}
+
+//Depth returns the number of hooks waiting in the queues of every priority of the tenant
+func (t *Tenants) Depth(tenant string) (int64, error) {
+	var depth int64
+	for _, queue := range t.queuesFor(tenant) {
+		total, err := t.Client.LLen(queue).Result()
+		if err != nil {
+			return 0, err
+		}
+		depth += total
+	}
+	return depth, nil
+}
+
+//QuotaFor returns the quota of the tenant
+func (t *Tenants) QuotaFor(tenant string) *TenantQuota {
+	for _, quota := range t.Quotas {
+		if quota.Tenant == tenant {
+			return quota
+		}
+	}
+	return t.DefaultQuota
+}
+
+//Reserve checks whether count new hooks of the tenant are allowed by its quota, counting them against its rate quota if they are.
+//It returns a QuotaError if they are not
+func (t *Tenants) Reserve(tenant string, count int) error {
+	quota := t.QuotaFor(tenant)
+	if tenant == "" || quota == nil || (quota.Rate <= 0 && quota.MaxDepth <= 0) {
+		return nil
+	}
+
+	res, err := quotaScript.Run(
+		t.Client,
+		append([]string{t.bucketKey(tenant)}, t.queuesFor(tenant)...),
+		time.Now().UnixNano()/int64(time.Millisecond), count, quota.Rate, quota.GetBurst(), quota.MaxDepth,
+	).Result()
+	if err != nil {
+		return err
+	}
+
+	switch result := res.(int64); {
+	case result == -1:
+		return &QuotaError{Tenant: tenant, Reason: fmt.Sprintf("at most %d hooks may be waiting in its queue", quota.MaxDepth)}
+	case result == -2:
+		return &QuotaError{Tenant: tenant, Reason: fmt.Sprintf("at most %d hooks may be sent at once", quota.GetBurst())}
+	case result > 0:
+		return &QuotaError{
+			Tenant:     tenant,
+			Reason:     fmt.Sprintf("at most %g hooks may be sent per second", quota.Rate),
+			RetryAfter: time.Duration(result) * time.Millisecond,
+		}
+	}
+	return nil
+}
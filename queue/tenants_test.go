@@ -0,0 +1,149 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package queue_test
+
+import (
+	"strings"
+
+	"gopkg.in/redis.v4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	. "github.com/topfreegames/santiago/queue"
+)
+
+var _ = Describe("Tenants", func() {
+	var testClient *redis.Client
+	var tenants *Tenants
+
+	BeforeEach(func() {
+		cli, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+		tenants = NewTenants(testClient, uuid.NewV4().String())
+	})
+
+	It("should validate tenant names", func() {
+		Expect(ValidTenant("tenant-a.b_c1")).To(BeTrue())
+		Expect(ValidTenant("")).To(BeFalse())
+		Expect(ValidTenant("tenant:a")).To(BeFalse())
+		Expect(ValidTenant("tenant a")).To(BeFalse())
+		Expect(ValidTenant(strings.Repeat("a", MaxTenantLength+1))).To(BeFalse())
+	})
+
+	It("should return the queue of the tenant", func() {
+		Expect(tenants.QueueFor("")).To(Equal(tenants.Queue))
+		Expect(tenants.QueueFor("tenant-a")).To(Equal(tenants.Queue + ":tenant:tenant-a"))
+	})
+
+	It("should register and list tenants", func() {
+		pipe := testClient.Pipeline()
+		tenants.Register(pipe, "tenant-b")
+		tenants.Register(pipe, "tenant-a")
+		tenants.Register(pipe, "tenant-b")
+		_, err := pipe.Exec()
+		Expect(err).NotTo(HaveOccurred())
+
+		list, err := tenants.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(Equal([]string{"tenant-a", "tenant-b"}))
+	})
+
+	It("should give scripts the queues of every priority of the queue and its tenants sharing its hash tag", func() {
+		queue := HashTag(uuid.NewV4().String())
+		tenants = NewTenants(testClient, queue)
+		pipe := testClient.Pipeline()
+		tenants.Register(pipe, "tenant-a")
+		tenants.Register(pipe, "tenant-b")
+		_, err := pipe.Exec()
+		Expect(err).NotTo(HaveOccurred())
+
+		keys, err := RouteKeys(testClient, queue)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(ConsistOf(
+			queue+":priority:high", queue, queue+":priority:low",
+			queue+":tenant:tenant-a:priority:high", queue+":tenant:tenant-a", queue+":tenant:tenant-a:priority:low",
+			queue+":tenant:tenant-b:priority:high", queue+":tenant:tenant-b", queue+":tenant:tenant-b:priority:low",
+		))
+
+		//Redis Cluster hashes only the part of keys within the first braces
+		tag := queue[strings.Index(queue, "{") : strings.Index(queue, "}")+1]
+		for _, key := range keys {
+			Expect(key[strings.Index(key, "{"):strings.Index(key, "}")+1]).To(Equal(tag), key)
+		}
+	})
+
+	It("should requeue hooks to the queues of their tenants and priorities", func() {
+		pipe := testClient.Pipeline()
+		tenants.Register(pipe, "tenant-a")
+		_, err := pipe.Exec()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = Requeue(
+			testClient, tenants.Queue,
+			`{"id":"1","tenant":"tenant-a","priority":"high"}`,
+			`{"id":"2","tenant":"tenant-b","priority":"low"}`,
+			`{"id":"3"}`,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		tenantHigh := PriorityQueue(TenantQueue(tenants.Queue, "tenant-a"), PriorityHigh)
+		low := PriorityQueue(tenants.Queue, PriorityLow)
+		for target, id := range map[string]string{tenantHigh: "1", low: "2", tenants.Queue: "3"} {
+			msgs, err := testClient.LRange(target, 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgs).To(HaveLen(1), target)
+			Expect(msgs[0]).To(ContainSubstring(`"id":"` + id + `"`))
+		}
+	})
+
+	It("should allow any number of hooks without quota", func() {
+		err := tenants.Reserve("tenant-a", 1000)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should enforce the rate quota of the tenant", func() {
+		tenants.Quotas = []*TenantQuota{{Tenant: "tenant-a", Rate: 1, Burst: 2}}
+
+		err := tenants.Reserve("tenant-a", 2)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = tenants.Reserve("tenant-a", 1)
+		Expect(err).To(HaveOccurred())
+		quotaErr, ok := err.(*QuotaError)
+		Expect(ok).To(BeTrue())
+		Expect(quotaErr.Tenant).To(Equal("tenant-a"))
+		Expect(quotaErr.RetryAfter).To(BeNumerically(">", 0))
+
+		err = tenants.Reserve("tenant-a", 3)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("at most 2 hooks may be sent at once"))
+
+		err = tenants.Reserve("tenant-b", 3)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should enforce the depth quota of the tenant", func() {
+		tenants.DefaultQuota = &TenantQuota{MaxDepth: 2}
+		err := testClient.RPush(tenants.QueueFor("tenant-a"), "hook-1").Err()
+		Expect(err).NotTo(HaveOccurred())
+		err = testClient.RPush(PriorityQueue(tenants.QueueFor("tenant-a"), PriorityHigh), "hook-2").Err()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = tenants.Reserve("tenant-a", 1)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("at most 2 hooks may be waiting in its queue"))
+
+		depth, err := tenants.Depth("tenant-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(depth).To(BeEquivalentTo(2))
+
+		err = tenants.Reserve("tenant-b", 2)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,53 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/topfreegames/santiago/config"
+	"github.com/topfreegames/santiago/worker/handler"
+)
+
+//configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "manages the configuration",
+	Long:  `Checks the configuration of Santiago workers.`,
+}
+
+//checkConfigCmd represents the config check command
+var checkConfigCmd = &cobra.Command{
+	Use:   "check",
+	Short: "checks the configuration",
+	Long: `Loads the configuration file, overridden by the SNT_ environment variables,
+and reports every invalid setting. It does not connect to Redis.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings, err := loadConfig()
+		if err != nil {
+			log.Fatalf("Could not load worker configuration: %s", err)
+		}
+		err = checkConfig(settings)
+		if err == nil {
+			err = configureWorker(settings, &worker.Worker{
+				Queue:             config.Queue(settings),
+				BackoffIntervalMs: settings.GetInt64("worker.backoffMs"),
+			})
+		}
+		if err != nil {
+			log.Fatalf("Invalid worker configuration: %s", err)
+		}
+		fmt.Println("Worker configuration is valid.")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(checkConfigCmd)
+}
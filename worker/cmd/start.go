@@ -7,23 +7,45 @@
 package cmd
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"golang.org/x/net/context"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/topfreegames/santiago/config"
+	"github.com/topfreegames/santiago/queue"
 	"github.com/topfreegames/santiago/worker/handler"
 	"github.com/uber-go/zap"
 )
 
-var redisHost string
-var redisPort int
-var redisPass string
-var redisDB int
-var sentryURL string
-var backoff int64
-var maxAttempts int
 var debug bool
 var quiet bool
 
+//flagKeys maps the flags of the start command to the settings they override
+var flagKeys = map[string]string{
+	"queue":                 "queue",
+	"redis-host":            "redis.host",
+	"redis-port":            "redis.port",
+	"redis-pass":            "redis.password",
+	"redis-db":              "redis.db",
+	"sentry-url":            "sentry.url",
+	"max-attempts":          "worker.maxAttempts",
+	"backoff-ms":            "worker.backoffMs",
+	"reliable":              "worker.reliable",
+	"visibility-timeout-ms": "worker.visibilityTimeoutMs",
+	"journal-retention-ms":  "worker.journalRetentionMs",
+	"pool-size":             "worker.poolSize",
+	"block-timeout-ms":      "worker.blockTimeoutMs",
+	"pop-batch-size":        "worker.popBatchSize",
+	"drain-timeout-ms":      "worker.drainTimeoutMs",
+}
+
 // startCmd represents the start command
 var startCmd = &cobra.Command{
 	Use:   "start",
@@ -42,25 +64,332 @@ var startCmd = &cobra.Command{
 			level,
 		)
 
-		w := worker.New(
-			"webhooks",
-			redisHost,
-			redisPort,
-			redisPass,
-			redisDB,
-			maxAttempts,
+		settings, err := loadConfig()
+		if err != nil {
+			log.Fatalf("Could not load worker configuration: %s", err)
+		}
+		for flag, key := range flagKeys {
+			settings.BindPFlag(key, cmd.Flags().Lookup(flag))
+		}
+		err = checkConfig(settings)
+		if err != nil {
+			log.Fatalf("Invalid worker configuration: %s", err)
+		}
+
+		w := worker.NewWithRedis(
+			config.Queue(settings),
+			config.Redis(settings),
+			settings.GetInt("worker.maxAttempts"),
 			logger,
 			debug,
-			30*time.Second,
-			sentryURL,
-			backoff,
+			time.Duration(settings.GetInt64("worker.blockTimeoutMs"))*time.Millisecond,
+			settings.GetString("sentry.url"),
+			settings.GetInt64("worker.backoffMs"),
 			&worker.RealClock{},
 		)
+		err = configureWorker(settings, w)
+		if err != nil {
+			log.Fatalf("Invalid worker configuration: %s", err)
+		}
+
+		go w.Start()
 
-		w.Start()
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		logger.Info("Received signal, draining worker...", zap.String("signal", sig.String()))
+
+		drainTimeout := time.Duration(settings.GetInt64("worker.drainTimeoutMs")) * time.Millisecond
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		err = w.Stop(ctx)
+		cancel()
+		if err != nil && err != context.DeadlineExceeded {
+			log.Fatalf("Could not drain worker: %s", err)
+		}
 	},
 }
 
+//workerDefaults returns the values of the worker settings that are not configured
+func workerDefaults() map[string]interface{} {
+	client := worker.DefaultClientOptions()
+	defaults := map[string]interface{}{
+		"worker.maxAttempts":                     15,
+		"worker.backoffMs":                       5000,
+		"worker.reliable":                        false,
+		"worker.visibilityTimeoutMs":             30000,
+		"worker.journalRetentionMs":              0,
+		"worker.maxDeadLetters":                  100000,
+		"worker.poolSize":                        100,
+		"worker.blockTimeoutMs":                  5000,
+		"worker.popBatchSize":                    1,
+		"worker.drainTimeoutMs":                  30000,
+		"worker.statusInterval":                  "1m",
+		"worker.circuitBreaker.failureThreshold": 0,
+		"worker.circuitBreaker.openTimeout":      "30s",
+		"worker.tenants.refreshInterval":         "5s",
+		"worker.statusPolicy.retryAfter":         true,
+		"worker.statusPolicy.maxRetryAfter":      "1h",
+		"worker.http.timeout":                    client.Timeout.String(),
+		"worker.http.connectTimeout":             client.ConnectTimeout.String(),
+		"worker.http.readTimeout":                "0s",
+		"worker.http.writeTimeout":               "0s",
+		"worker.http.maxConnsPerHost":            client.MaxConnsPerHost,
+		"worker.http.maxIdleConnDuration":        client.MaxIdleConnDuration.String(),
+		"worker.tls.reloadInterval":              "30s",
+	}
+	for priority, weight := range worker.DefaultPriorityWeights() {
+		defaults[fmt.Sprintf("worker.priorities.weights.%s", priority)] = weight
+	}
+	return defaults
+}
+
+func loadConfig() (*viper.Viper, error) {
+	return config.Load(cfgFile, workerDefaults())
+}
+
+//checkConfig reports every invalid shared or worker setting that is not checked while configuring the worker
+func checkConfig(settings *viper.Viper) error {
+	c := config.NewChecker(settings)
+	config.Check(c)
+	c.Int("worker.maxAttempts", 1)
+	c.Int("worker.backoffMs", 0)
+	c.Int("worker.visibilityTimeoutMs", 1)
+	c.Int("worker.journalRetentionMs", 0)
+	c.Int("worker.maxDeadLetters", 0)
+	c.Int("worker.poolSize", 1)
+	c.Int("worker.blockTimeoutMs", 1)
+	c.Int("worker.popBatchSize", 1)
+	c.Int("worker.drainTimeoutMs", 0)
+	c.Int("worker.circuitBreaker.failureThreshold", 0)
+	for _, key := range []string{
+		"worker.statusInterval",
+		"worker.circuitBreaker.openTimeout",
+		"worker.tenants.refreshInterval",
+		"worker.statusPolicy.maxRetryAfter",
+		"worker.http.timeout",
+		"worker.http.connectTimeout",
+		"worker.http.readTimeout",
+		"worker.http.writeTimeout",
+		"worker.http.maxIdleConnDuration",
+		"worker.tls.reloadInterval",
+	} {
+		c.Duration(key)
+	}
+	return c.Err()
+}
+
+//configureWorker sets the options of the worker from the configuration
+func configureWorker(config *viper.Viper, w *worker.Worker) error {
+	var err error
+	w.Reliable = config.GetBool("worker.reliable")
+	w.VisibilityTimeout = time.Duration(config.GetInt64("worker.visibilityTimeoutMs")) * time.Millisecond
+	w.JournalRetention = time.Duration(config.GetInt64("worker.journalRetentionMs")) * time.Millisecond
+	w.MaxDeadLetters = config.GetInt64("worker.maxDeadLetters")
+	w.PoolSize = config.GetInt("worker.poolSize")
+	w.PopBatchSize = config.GetInt("worker.popBatchSize")
+	w.StatusInterval = config.GetDuration("worker.statusInterval")
+
+	w.Signer = getSigner(config)
+	w.Limiter, err = getLimiter(config, w)
+	if err != nil {
+		return fmt.Errorf("invalid destination limits: %s", err)
+	}
+	w.CircuitBreaker = getCircuitBreaker(config, w)
+	err = setRetryPolicies(config, w)
+	if err != nil {
+		return fmt.Errorf("invalid retry policies: %s", err)
+	}
+	w.StatusPolicy, err = getStatusPolicy(config)
+	if err != nil {
+		return fmt.Errorf("invalid status policy: %s", err)
+	}
+	w.ClientOptions, err = getClientOptions(config)
+	if err != nil {
+		return fmt.Errorf("invalid HTTP client configuration: %s", err)
+	}
+	w.TLS, err = getTLSConfigs(config)
+	if err != nil {
+		return fmt.Errorf("invalid TLS configuration: %s", err)
+	}
+	err = setTenants(config, w)
+	if err != nil {
+		return fmt.Errorf("invalid tenants configuration: %s", err)
+	}
+	w.PriorityWeights, err = getPriorityWeights(config)
+	if err != nil {
+		return fmt.Errorf("invalid priorities configuration: %s", err)
+	}
+	return nil
+}
+
+func getSigner(config *viper.Viper) *worker.Signer {
+	secrets := config.GetStringSlice("worker.signing.secrets")
+	tenantSecrets := config.GetStringMapStringSlice("worker.signing.tenants")
+	if len(secrets) == 0 && len(tenantSecrets) == 0 {
+		return nil
+	}
+	return worker.NewSigner(secrets, tenantSecrets)
+}
+
+func getLimiter(config *viper.Viper, w *worker.Worker) (*worker.Limiter, error) {
+	rules := []*worker.LimitRule{}
+	err := config.UnmarshalKey("worker.limits", &rules)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	for _, rule := range rules {
+		if rule.Host == "" && rule.Prefix == "" {
+			return nil, fmt.Errorf("every limit must have either a host or a prefix")
+		}
+	}
+	return worker.NewLimiter(w.Client, w.Queue, rules), nil
+}
+
+func getCircuitBreaker(config *viper.Viper, w *worker.Worker) *queue.CircuitBreaker {
+	threshold := config.GetInt("worker.circuitBreaker.failureThreshold")
+	if threshold <= 0 {
+		return nil
+	}
+	return queue.NewCircuitBreaker(w.Client, w.Queue, threshold, config.GetDuration("worker.circuitBreaker.openTimeout"))
+}
+
+func setRetryPolicies(config *viper.Viper, w *worker.Worker) error {
+	backoffInterval := time.Duration(w.BackoffIntervalMs) * time.Millisecond
+
+	if config.IsSet("worker.retry.policy") {
+		retry := &queue.RetryConfig{}
+		err := config.UnmarshalKey("worker.retry", retry)
+		if err != nil {
+			return err
+		}
+		w.RetryPolicy, err = queue.NewRetryPolicy(retry, backoffInterval)
+		if err != nil {
+			return err
+		}
+	}
+
+	rules := []*worker.RetryRule{}
+	err := config.UnmarshalKey("worker.retry.destinations", &rules)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.Host == "" && rule.Prefix == "" {
+			return fmt.Errorf("every destination retry policy must have either a host or a prefix")
+		}
+		rule.Policy, err = queue.NewRetryPolicy(&rule.RetryConfig, backoffInterval)
+		if err != nil {
+			return fmt.Errorf("retry policy of %s%s: %s", rule.Host, rule.Prefix, err)
+		}
+	}
+	w.RetryRules = rules
+	return nil
+}
+
+func setTenants(config *viper.Viper, w *worker.Worker) error {
+	//tenants are a list instead of a map since viper lowercases map keys
+	var tenantWeights []struct {
+		Tenant string `mapstructure:"tenant"`
+		Weight int    `mapstructure:"weight"`
+	}
+	err := config.UnmarshalKey("worker.tenants.weights", &tenantWeights)
+	if err != nil {
+		return err
+	}
+	weights := map[string]int{}
+	for _, tenantWeight := range tenantWeights {
+		if !queue.ValidTenant(tenantWeight.Tenant) {
+			return fmt.Errorf("'%s' is not a valid tenant", tenantWeight.Tenant)
+		}
+		if tenantWeight.Weight <= 0 {
+			return fmt.Errorf("the weight of tenant %s must be greater than zero", tenantWeight.Tenant)
+		}
+		weights[tenantWeight.Tenant] = tenantWeight.Weight
+	}
+	w.TenantWeights = weights
+	w.TenantRefreshInterval = config.GetDuration("worker.tenants.refreshInterval")
+	return nil
+}
+
+func getPriorityWeights(config *viper.Viper) (map[string]int, error) {
+	weights := map[string]int{}
+	for _, priority := range queue.Priorities {
+		weight := config.GetInt(fmt.Sprintf("worker.priorities.weights.%s", priority))
+		if weight <= 0 {
+			return nil, fmt.Errorf("the weight of priority %s must be greater than zero", priority)
+		}
+		weights[priority] = weight
+	}
+	return weights, nil
+}
+
+func getStatusPolicy(config *viper.Viper) (*worker.StatusPolicy, error) {
+	policy, err := worker.NewStatusPolicy(
+		config.GetStringSlice("worker.statusPolicy.retryable"),
+		config.GetStringSlice("worker.statusPolicy.permanent"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	policy.RetryAfter = config.GetBool("worker.statusPolicy.retryAfter")
+	policy.MaxRetryAfter = config.GetDuration("worker.statusPolicy.maxRetryAfter")
+	return policy, nil
+}
+
+func getClientOptions(config *viper.Viper) (*worker.ClientOptions, error) {
+	options := &worker.ClientOptions{
+		Timeout:             config.GetDuration("worker.http.timeout"),
+		ConnectTimeout:      config.GetDuration("worker.http.connectTimeout"),
+		ReadTimeout:         config.GetDuration("worker.http.readTimeout"),
+		WriteTimeout:        config.GetDuration("worker.http.writeTimeout"),
+		MaxConnsPerHost:     config.GetInt("worker.http.maxConnsPerHost"),
+		MaxIdleConnDuration: config.GetDuration("worker.http.maxIdleConnDuration"),
+	}
+
+	if proxy := config.GetString("worker.http.proxy"); proxy != "" {
+		proxyURL, err := worker.ParseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		options.Proxy = proxyURL
+	}
+
+	if config.IsSet("worker.egress") {
+		egressConfig := &queue.EgressConfig{}
+		err := config.UnmarshalKey("worker.egress", egressConfig)
+		if err != nil {
+			return nil, err
+		}
+		options.Egress, err = queue.NewEgressPolicy(egressConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+func getTLSConfigs(config *viper.Viper) (*worker.TLSConfigs, error) {
+	rules := []*worker.TLSRule{}
+	err := config.UnmarshalKey("worker.tls.destinations", &rules)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	tlsConfigs, err := worker.NewTLSConfigs(rules)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfigs.ReloadInterval = config.GetDuration("worker.tls.reloadInterval")
+	return tlsConfigs, nil
+}
+
 func init() {
 	RootCmd.AddCommand(startCmd)
 
@@ -72,13 +401,21 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	startCmd.Flags().StringVarP(&redisHost, "redis-host", "r", "127.0.0.1", "Queue Redis Host")
-	startCmd.Flags().IntVarP(&redisPort, "redis-port", "p", 6379, "Queue Redis Port")
-	startCmd.Flags().StringVarP(&redisPass, "redis-pass", "s", "", "Queue Redis Password")
-	startCmd.Flags().IntVarP(&redisDB, "redis-db", "b", 0, "Queue Redis DB")
-	startCmd.Flags().StringVarP(&sentryURL, "sentry-url", "u", "", "Sentry URL to send errors to")
-	startCmd.Flags().IntVarP(&maxAttempts, "max-attempts", "m", 15, "Max attempts before giving up on a hook")
-	startCmd.Flags().Int64VarP(&backoff, "backoff-ms", "o", 5000, "Exponential backoff before retrying in ms")
+	startCmd.Flags().String("queue", config.DefaultQueue, "Queue to take hooks from")
+	startCmd.Flags().StringP("redis-host", "r", "localhost", "Queue Redis Host")
+	startCmd.Flags().IntP("redis-port", "p", 6379, "Queue Redis Port")
+	startCmd.Flags().StringP("redis-pass", "s", "", "Queue Redis Password")
+	startCmd.Flags().IntP("redis-db", "b", 0, "Queue Redis DB")
+	startCmd.Flags().StringP("sentry-url", "u", "", "Sentry URL to send errors to")
+	startCmd.Flags().IntP("max-attempts", "m", 15, "Max attempts before giving up on a hook")
+	startCmd.Flags().Int64P("backoff-ms", "o", 5000, "Exponential backoff before retrying in ms")
+	startCmd.Flags().BoolP("reliable", "l", false, "Keeps in-flight hooks in a processing list so they survive worker crashes")
+	startCmd.Flags().Int64P("visibility-timeout-ms", "t", 30000, "Time in ms before in-flight hooks of an unresponsive worker are returned to the queue")
+	startCmd.Flags().Int64P("journal-retention-ms", "j", 0, "Time in ms dispatched hooks are kept in the delivery journal for replays (0 disables the journal)")
+	startCmd.Flags().Int("pool-size", 100, "Max requests in flight in this worker. No more hooks are taken from the queue while all of them are in flight")
+	startCmd.Flags().Int64("block-timeout-ms", 5000, "Time in ms to wait for hooks when the queue is empty. Redis only blocks for whole seconds, so shorter timeouts poll the queue instead")
+	startCmd.Flags().Int("pop-batch-size", 1, "Max hooks taken from the queue in a single round trip")
+	startCmd.Flags().Int64("drain-timeout-ms", 30000, "Time in ms to wait for in-flight hooks on SIGTERM/SIGINT before returning them to the queue")
 	startCmd.Flags().BoolVarP(&debug, "debug", "d", false, "Starts the worker in debug mode")
 	startCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Starts the worker in quiet mode (LOGLEVEL=Error)")
 }
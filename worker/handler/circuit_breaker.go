@@ -0,0 +1,76 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+//checkCircuit parks the hook in the scheduled set without counting an attempt if the circuit of its host is open
+func (w *Worker) checkCircuit(msg map[string]interface{}, url string, raw string) (bool, error) {
+	if w.CircuitBreaker == nil {
+		return false, nil
+	}
+
+	host := queue.HostFor(url)
+	wait, err := w.CircuitBreaker.Allow(host)
+	if err != nil {
+		return false, err
+	}
+	if wait == 0 {
+		return false, nil
+	}
+
+	err = w.scheduleMessage(msg, w.Clock.Now()+int64(wait))
+	if err != nil {
+		return false, err
+	}
+	w.ack(raw)
+
+	log.D(w.Logger, "Hook parked since the circuit of its host is open.", func(cm log.CM) {
+		cm.Write(
+			zap.String("operation", "checkCircuit"),
+			zap.String("queue", w.Queue),
+			zap.String("host", host),
+			zap.Duration("parkedFor", wait),
+		)
+	})
+	return true, nil
+}
+
+//recordCircuitResult updates the circuit of the hook host. Only errors and 5xx responses count as failures,
+//since other responses mean the host is up
+func (w *Worker) recordCircuitResult(url string, status int, reqErr error) {
+	if w.CircuitBreaker == nil {
+		return
+	}
+
+	l := w.Logger.With(
+		zap.String("operation", "recordCircuitResult"),
+		zap.String("queue", w.Queue),
+		zap.String("host", queue.HostFor(url)),
+	)
+
+	if reqErr == nil && status < 500 {
+		err := w.CircuitBreaker.RecordSuccess(queue.HostFor(url))
+		if err != nil {
+			l.Error("Failed to close circuit.", zap.Error(err))
+		}
+		return
+	}
+
+	opened, err := w.CircuitBreaker.RecordFailure(queue.HostFor(url))
+	if err != nil {
+		l.Error("Failed to record failure in circuit.", zap.Error(err))
+		return
+	}
+	if opened {
+		l.Warn("Circuit opened, hooks to the host will be parked.", zap.Duration("openTimeout", w.CircuitBreaker.OpenTimeout))
+	}
+}
@@ -9,14 +9,18 @@ package worker
 import (
 	"encoding/json"
 	"fmt"
-	"math"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/redis.v4"
 
 	"github.com/getsentry/raven-go"
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/config"
 	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
 	"github.com/uber-go/zap"
 	"github.com/valyala/fasthttp"
 )
@@ -34,46 +38,201 @@ func (r *RealClock) Now() int64 {
 	return time.Now().UnixNano()
 }
 
+//claimScript atomically removes the next message from the first non-empty queue in KEYS[3..]. If ARGV[1] is 1 it moves it
+//to the worker processing list in KEYS[1] and signals the ready list in KEYS[2] if messages are left, so other workers
+//blocked on it wake up, or clears the ready list if all queues are empty, so workers only block until the next push
+var claimScript = redis.NewScript(queue.SignalFunction + `
+for i = 3, #KEYS do
+	local msg = redis.call("LPOP", KEYS[i])
+	if msg then
+		if ARGV[1] == "1" then
+			redis.call("RPUSH", KEYS[1], msg)
+			for j = i, #KEYS do
+				if redis.call("LLEN", KEYS[j]) > 0 then
+					signal(KEYS[2])
+					break
+				end
+			end
+		end
+		return msg
+	end
+end
+if ARGV[1] == "1" then
+	redis.call("DEL", KEYS[2])
+end
+return false
+`)
+
+//popBatchScript atomically removes up to ARGV[1] messages from the first non-empty queue in KEYS, moving them to the worker
+//processing list, the last key, if ARGV[2] is 1
+var popBatchScript = redis.NewScript(`
+local queues = #KEYS
+if ARGV[2] == "1" then
+	queues = queues - 1
+end
+for i = 1, queues do
+	local msgs = redis.call("LRANGE", KEYS[i], 0, tonumber(ARGV[1]) - 1)
+	if #msgs > 0 then
+		redis.call("LTRIM", KEYS[i], #msgs, -1)
+		if ARGV[2] == "1" then
+			redis.call("RPUSH", KEYS[#KEYS], unpack(msgs))
+		end
+		return msgs
+	end
+end
+return {}
+`)
+
+//reapScript returns all messages in a dead worker processing list to the head of the queue of their priority,
+//in the queue of their tenant if it has its own queue (see queue.RouteFunction), signaling the ready list in KEYS[5]
+var reapScript = redis.NewScript(queue.RouteFunction + queue.SignalFunction + `
+route_keys(6)
+if redis.call("EXISTS", KEYS[3]) == 1 then
+	return 0
+end
+local count = 0
+local msg = redis.call("RPOP", KEYS[1])
+while msg do
+	redis.call("LPUSH", route(KEYS[2], msg), msg)
+	count = count + 1
+	msg = redis.call("RPOP", KEYS[1])
+end
+if count > 0 then
+	signal(KEYS[5])
+end
+redis.call("SREM", KEYS[4], ARGV[1])
+return count
+`)
+
+//promoteScript atomically moves up to ARGV[2] due hooks from the scheduled set to the queue of their priority,
+//in the queue of their tenant if it has its own queue (see queue.RouteFunction), signaling the ready list in KEYS[3]
+var promoteScript = redis.NewScript(queue.RouteFunction + queue.SignalFunction + `
+route_keys(4)
+local msgs = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, msg in ipairs(msgs) do
+	redis.call("ZREM", KEYS[1], msg)
+	redis.call("RPUSH", route(KEYS[2], msg), msg)
+end
+if #msgs > 0 then
+	signal(KEYS[3])
+end
+return #msgs
+`)
+
+//DefaultTimeout is the request timeout of hooks that do not set their own, unless the worker client options set another one
+const DefaultTimeout = 5 * time.Second
+
 //Worker is a worker implementation that keeps processing webhooks
 type Worker struct {
-	Debug             bool
-	Queue             string
-	Logger            zap.Logger
-	MaxAttempts       int
-	Client            *redis.Client
-	BlockTimeout      time.Duration
-	SentryURL         string
-	BackoffIntervalMs int64
-	Clock             Clock
+	ID                    string
+	Debug                 bool
+	Queue                 string
+	Logger                zap.Logger
+	MaxAttempts           int
+	Client                redis.Cmdable
+	BlockTimeout          time.Duration
+	SentryURL             string
+	BackoffIntervalMs     int64
+	Clock                 Clock
+	Reliable              bool
+	VisibilityTimeout     time.Duration
+	PromoteInterval       time.Duration
+	PromoteBatchSize      int
+	JournalRetention      time.Duration
+	DeliveryRetention     time.Duration
+	MaxDeadLetters        int64
+	Signer                *Signer
+	PoolSize              int
+	StatusInterval        time.Duration
+	PopBatchSize          int
+	RetryPolicy           queue.RetryPolicy
+	RetryRules            []*RetryRule
+	StatusPolicy          *StatusPolicy
+	ClientOptions         *ClientOptions
+	TLS                   *TLSConfigs
+	client                *fasthttp.Client
+	clientOnce            sync.Once
+	Limiter               *Limiter
+	CircuitBreaker        *queue.CircuitBreaker
+	TenantWeights         map[string]int
+	TenantRefreshInterval time.Duration
+	PriorityWeights       map[string]int
+	pool                  *Pool
+	poolOnce              sync.Once
+	stopped               int32
+	running               sync.WaitGroup
+	dispatches            sync.WaitGroup
+	inFlight              map[string]string
+	inFlightMu            sync.Mutex
+	tenantQueues          []string
+	tenantsRefreshedAt    time.Time
+	tenantTurns           map[string]int
+	queuesMu              sync.Mutex
+	priorityTurns         map[string]int
+	keepAliveStop         chan struct{}
+	keepAliveDone         chan struct{}
+	keepAliveMu           sync.Mutex
 }
 
 //NewDefault returns a new worker with default options
 func NewDefault(redisHost string, redisPort int, redisPassword string, redisDB int, logger zap.Logger) *Worker {
 	return New(
-		"webhook",
+		config.DefaultQueue,
 		redisHost, redisPort, redisPassword, redisDB,
 		15, logger, false, 5*time.Second, "", 5000,
 		&RealClock{},
 	)
 }
 
-//New creates a new worker instance
+//New creates a new worker instance connected to a single Redis node
 func New(
-	queue string, redisHost string, redisPort int, redisPassword string, redisDB int,
+	queueName string, redisHost string, redisPort int, redisPassword string, redisDB int,
+	maxAttempts int, logger zap.Logger, debug bool, blockTimeout time.Duration,
+	sentryURL string, backoffIntervalMs int64, clock Clock,
+) *Worker {
+	redisOptions := &queue.RedisOptions{
+		Mode:     queue.RedisSingle,
+		Host:     redisHost,
+		Port:     redisPort,
+		Password: redisPassword,
+		DB:       redisDB,
+	}
+	return NewWithRedis(
+		queueName, redisOptions, maxAttempts, logger, debug, blockTimeout, sentryURL, backoffIntervalMs, clock,
+	)
+}
+
+//NewWithRedis creates a new worker instance connected to the given Redis deployment. The queue name is used as is,
+//so in Redis Cluster it must be hash tagged like the RedisOptions QueueName does
+func NewWithRedis(
+	queueName string, redisOptions *queue.RedisOptions,
 	maxAttempts int, logger zap.Logger, debug bool, blockTimeout time.Duration,
 	sentryURL string, backoffIntervalMs int64, clock Clock,
 ) *Worker {
 	w := &Worker{
-		Debug:             debug,
-		Logger:            logger,
-		Queue:             queue,
-		MaxAttempts:       maxAttempts,
-		BlockTimeout:      blockTimeout,
-		SentryURL:         sentryURL,
-		BackoffIntervalMs: backoffIntervalMs,
-		Clock:             clock,
-	}
-	err := w.connectToRedis(redisHost, redisPort, redisPassword, redisDB)
+		ID:                    uuid.NewV4().String(),
+		Debug:                 debug,
+		Logger:                logger,
+		Queue:                 queueName,
+		MaxAttempts:           maxAttempts,
+		BlockTimeout:          blockTimeout,
+		SentryURL:             sentryURL,
+		BackoffIntervalMs:     backoffIntervalMs,
+		Clock:                 clock,
+		Reliable:              false,
+		VisibilityTimeout:     30 * time.Second,
+		PromoteInterval:       500 * time.Millisecond,
+		PromoteBatchSize:      1000,
+		DeliveryRetention:     7 * 24 * time.Hour,
+		MaxDeadLetters:        100000,
+		PoolSize:              100,
+		StatusInterval:        time.Minute,
+		PopBatchSize:          1,
+		ClientOptions:         DefaultClientOptions(),
+		TenantRefreshInterval: 5 * time.Second,
+		PriorityWeights:       DefaultPriorityWeights(),
+	}
+	err := w.connectToRedis(redisOptions)
 	if err != nil {
 		logger.Panic("Could not start worker due to error connecting to Redis...", zap.Error(err))
 	}
@@ -85,24 +244,18 @@ func (w *Worker) connectRaven() {
 	raven.SetDSN(w.SentryURL)
 }
 
-func (w *Worker) connectToRedis(redisHost string, redisPort int, redisPassword string, redisDB int) error {
+func (w *Worker) connectToRedis(options *queue.RedisOptions) error {
 	l := w.Logger.With(
 		zap.String("operation", "connectToRedis"),
-		zap.String("redisHost", redisHost),
-		zap.Int("redisPort", redisPort),
-		zap.Int("redisDB", redisDB),
-		zap.Bool("hasPassword", redisPassword != ""),
+		zap.String("redisMode", options.Mode),
+		zap.String("redisAddrs", strings.Join(options.Addrs(), ",")),
+		zap.Int("redisDB", options.DB),
+		zap.Bool("hasPassword", options.Password != ""),
 	)
 
 	log.D(l, "Connecting to Redis...")
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", redisHost, redisPort),
-		Password: redisPassword,
-		DB:       redisDB,
-	})
-
 	start := time.Now()
-	_, err := client.Ping().Result()
+	client, err := options.Connect()
 	if err != nil {
 		l.Error("Could not connect to redis.", zap.Error(err))
 		return err
@@ -115,8 +268,15 @@ func (w *Worker) connectToRedis(redisHost string, redisPort int, redisPassword s
 	return nil
 }
 
+//Response is the answer of a webhook endpoint to a hook request
+type Response struct {
+	StatusCode int
+	Body       string
+	RetryAfter string
+}
+
 //DoRequest to some webhook endpoint
-func (w *Worker) DoRequest(method, url, payload string) (int, string, error) {
+func (w *Worker) DoRequest(method, url, payload string, headers map[string]string, timeout time.Duration) (*Response, error) {
 	l := w.Logger.With(
 		zap.String("operation", "DoRequest"),
 		zap.String("method", method),
@@ -124,28 +284,30 @@ func (w *Worker) DoRequest(method, url, payload string) (int, string, error) {
 		zap.String("payload", payload),
 	)
 
-	client := fasthttp.Client{
-		Name: "santiago",
-	}
-
 	start := time.Now()
 	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
 	req.Header.SetMethod(method)
 	req.SetRequestURI(url)
-	if method != "GET" && payload != "" && payload != "NULL" {
-		req.AppendBody([]byte(payload))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if body := getRequestBody(method, payload); body != "" {
+		req.AppendBody([]byte(body))
 	}
 	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
 
-	timeout := time.Duration(5) * time.Second
-
-	err := client.DoTimeout(req, resp, timeout)
+	client, done := w.httpClientFor(url)
+	err := client.DoTimeout(req, resp, w.requestTimeout(timeout))
+	done()
 	if err != nil {
-		return 0, "", err
+		return nil, err
 	}
 
 	status := resp.StatusCode()
 	body := string(resp.Body())
+	retryAfter := string(resp.Header.Peek("Retry-After"))
 	log.I(l,
 		"Request hook finished without error.",
 		func(cm log.CM) {
@@ -157,84 +319,503 @@ func (w *Worker) DoRequest(method, url, payload string) (int, string, error) {
 		},
 	)
 
-	return status, body, nil
+	return &Response{
+		StatusCode: status,
+		Body:       body,
+		RetryAfter: retryAfter,
+	}, nil
 }
 
-func (w *Worker) requeueMessage(method, url, payload string, attempts int, incrementAttempts bool) error {
+//requeueMessage schedules the hook to be retried after the delay of its retry policy or after retryAfter if set,
+//or fails it if it reached its max attempts
+func (w *Worker) requeueMessage(msg map[string]interface{}, attempts int, statusCode int, response string, reqErr error, retryAfter time.Duration) error {
+	method := msg["method"].(string)
+	url := msg["url"].(string)
+
 	l := w.Logger.With(
 		zap.String("operation", "requeueMessage"),
 		zap.String("method", method),
 		zap.String("url", url),
 	)
 
-	if attempts > w.MaxAttempts {
-		msg := "Max attempts reached for message. Message will be discarded."
-		l.Warn(msg)
-		err := fmt.Errorf(msg)
+	maxAttempts := w.MaxAttempts
+	if hookMaxAttempts, ok := msg["maxAttempts"].(float64); ok && hookMaxAttempts > 0 {
+		maxAttempts = int(hookMaxAttempts)
+	}
 
-		tags := map[string]string{
-			"method":  method,
-			"url":     url,
-			"payload": payload,
-		}
-		raven.CaptureError(err, tags)
+	if attempts > maxAttempts {
+		return w.failMessage(msg, attempts, statusCode, response, reqErr, "Max attempts reached for message. Message will be moved to the dead letter queue.")
+	}
 
-		return nil
+	attempts++
+	w.trackDelivery(msg, queue.DeliveryPending, attempts, statusCode, response, reqErr)
+
+	delay := retryAfter
+	if delay <= 0 {
+		delay = w.retryPolicyFor(msg).Delay(attempts, getRetryDelay(msg))
 	}
+	backoffTimestamp := w.Clock.Now() + int64(delay)
 
-	if incrementAttempts {
-		attempts++
+	data := map[string]interface{}{}
+	for key, value := range msg {
+		data[key] = value
 	}
+	data["attempts"] = attempts
+	data["backoff"] = backoffTimestamp
+	data["retryDelayMs"] = int64(delay / time.Millisecond)
 
-	millisecond := int64(1000000)
-	power := int64(math.Pow(2, float64(attempts)))
-	backoffTimestamp := w.Clock.Now() + (int64(w.BackoffIntervalMs) * power * millisecond)
+	start := time.Now()
 
-	data := map[string]interface{}{
-		"method":   method,
-		"url":      url,
-		"payload":  payload,
-		"attempts": attempts,
-		"backoff":  backoffTimestamp,
+	log.D(l, "Re-enqueueing hook...")
+	err := w.scheduleMessage(data, backoffTimestamp)
+	if err != nil {
+		l.Error("Re-enqueueing hook failed.", zap.Error(err))
+		return err
 	}
-	dataJSON, _ := json.Marshal(data)
+	log.I(l, "Hook re-enqueue succeeded.", func(cm log.CM) {
+		cm.Write(zap.Duration("ReEnqueueDuration", time.Now().Sub(start)))
+	})
 
-	start := time.Now()
+	return nil
+}
+
+//failMessage gives up on the hook, moving it to the dead letter queue
+func (w *Worker) failMessage(msg map[string]interface{}, attempts int, statusCode int, response string, reqErr error, warning string) error {
+	method := msg["method"].(string)
+	url := msg["url"].(string)
+
+	w.Logger.Warn(
+		warning,
+		zap.String("operation", "failMessage"),
+		zap.String("method", method),
+		zap.String("url", url),
+	)
+	err := fmt.Errorf(warning)
+
+	tags := getTags(msg)
+	tags["method"] = method
+	tags["url"] = url
+	tags["payload"] = fmt.Sprintf("%v", msg["payload"])
+	raven.CaptureError(err, tags)
+
+	w.trackDelivery(msg, queue.DeliveryFailed, attempts+1, statusCode, response, reqErr)
+	return w.deadLetter(msg, attempts, statusCode, reqErr)
+}
+
+func (w *Worker) deadLetter(msg map[string]interface{}, attempts int, statusCode int, reqErr error) error {
+	l := w.Logger.With(
+		zap.String("operation", "deadLetter"),
+		zap.String("queue", w.Queue),
+	)
 
-	if incrementAttempts {
-		log.D(l, "Re-enqueueing hook...")
-	} else {
-		log.D(l, "Ignoring hook...")
+	letter := &queue.DeadLetter{
+		ID:             getHookID(msg),
+		Method:         msg["method"].(string),
+		URL:            msg["url"].(string),
+		Attempts:       attempts,
+		LastStatusCode: statusCode,
+		FailedAt:       time.Now().Unix(),
 	}
-	_, err := w.Client.RPush(w.Queue, dataJSON).Result()
+	if payload, ok := msg["payload"].(string); ok {
+		letter.Payload = payload
+	}
+	if headers := getHeaders(msg); len(headers) > 0 {
+		letter.Headers = headers
+	}
+	letter.Tenant, _ = msg["tenant"].(string)
+	letter.Options = queue.MessageOptions(msg)
+	if createdAt, ok := msg["createdAt"].(float64); ok {
+		letter.CreatedAt = int64(createdAt)
+	}
+	if reqErr != nil {
+		letter.LastError = reqErr.Error()
+	}
+
+	dlq := queue.NewDeadLetterQueue(w.Client, w.Queue)
+	dlq.MaxLength = w.MaxDeadLetters
+	err := dlq.Add(letter)
 	if err != nil {
-		if incrementAttempts {
-			l.Error("Re-enqueueing hook failed.", zap.Error(err))
-		} else {
-			l.Error("Ignoring hook failed.", zap.Error(err))
-		}
+		l.Error("Failed to add hook to dead letter queue.", zap.Error(err))
 		return err
 	}
-	if incrementAttempts {
-		log.I(l, "Hook re-enqueue succeeded.", func(cm log.CM) {
-			cm.Write(zap.Duration("ReEnqueueDuration", time.Now().Sub(start)))
-		})
-	} else {
-		log.D(l, "Hook ignore succeeded.", func(cm log.CM) {
-			cm.Write(zap.Duration("IgnoreDuration", time.Now().Sub(start)))
+
+	log.I(l, "Hook added to dead letter queue.", func(cm log.CM) {
+		cm.Write(zap.String("deadLetterID", letter.ID))
+	})
+	return nil
+}
+
+func (w *Worker) trackDelivery(msg map[string]interface{}, status string, attempts, statusCode int, response string, reqErr error) {
+	id, ok := msg["id"].(string)
+	if !ok || id == "" || w.DeliveryRetention <= 0 {
+		return
+	}
+
+	delivery := &queue.Delivery{
+		ID:             id,
+		Method:         msg["method"].(string),
+		URL:            msg["url"].(string),
+		Status:         status,
+		Attempts:       attempts,
+		LastStatusCode: statusCode,
+		LastResponse:   response,
+	}
+	delivery.Tenant, _ = msg["tenant"].(string)
+	if createdAt, ok := msg["createdAt"].(float64); ok {
+		delivery.CreatedAt = int64(createdAt)
+	}
+	if reqErr != nil {
+		delivery.LastError = reqErr.Error()
+	}
+
+	err := queue.NewDeliveries(w.Client, w.Queue, w.DeliveryRetention).Save(delivery)
+	if err != nil {
+		w.Logger.Error(
+			"Failed to update hook delivery.",
+			zap.String("operation", "trackDelivery"),
+			zap.String("queue", w.Queue),
+			zap.String("hookID", id),
+			zap.Error(err),
+		)
+	}
+}
+
+func (w *Worker) recordInJournal(msg map[string]interface{}) {
+	if w.JournalRetention <= 0 {
+		return
+	}
+
+	entry := &queue.JournalEntry{
+		ID:     getHookID(msg),
+		Method: msg["method"].(string),
+		URL:    msg["url"].(string),
+		SentAt: time.Now().Unix(),
+	}
+	if payload, ok := msg["payload"].(string); ok {
+		entry.Payload = payload
+	}
+	if headers := getHeaders(msg); len(headers) > 0 {
+		entry.Headers = headers
+	}
+	entry.Tenant, _ = msg["tenant"].(string)
+	entry.Options = queue.MessageOptions(msg)
+	if createdAt, ok := msg["createdAt"].(float64); ok {
+		entry.CreatedAt = int64(createdAt)
+	}
+
+	err := queue.NewJournal(w.Client, w.Queue, w.JournalRetention).Record(entry)
+	if err != nil {
+		w.Logger.Error(
+			"Failed to record hook in delivery journal.",
+			zap.String("operation", "recordInJournal"),
+			zap.String("queue", w.Queue),
+			zap.Error(err),
+		)
+	}
+}
+
+//ScheduledQueue returns the name of the sorted set holding hooks waiting for their backoff, scored by due time
+func (w *Worker) ScheduledQueue() string {
+	return fmt.Sprintf("%s:scheduled", w.Queue)
+}
+
+func (w *Worker) scheduleMessage(data map[string]interface{}, dueTimestamp int64) error {
+	dataJSON, _ := json.Marshal(data)
+	_, err := w.Client.ZAdd(w.ScheduledQueue(), redis.Z{
+		Score:  float64(dueTimestamp),
+		Member: string(dataJSON),
+	}).Result()
+	return err
+}
+
+//PromoteScheduled moves scheduled hooks whose backoff is due back to the queue
+func (w *Worker) PromoteScheduled() (int, error) {
+	l := w.Logger.With(
+		zap.String("operation", "PromoteScheduled"),
+		zap.String("queue", w.Queue),
+	)
+
+	routes, err := queue.RouteKeys(w.Client, w.Queue)
+	if err != nil {
+		l.Error("Failed to retrieve queues of tenants.", zap.Error(err))
+		return 0, err
+	}
+	res, err := promoteScript.Run(
+		w.Client,
+		append([]string{w.ScheduledQueue(), w.Queue, queue.ReadyKey(w.Queue)}, routes...),
+		strconv.FormatInt(w.Clock.Now(), 10), w.PromoteBatchSize,
+	).Result()
+	if err != nil {
+		l.Error("Failed to promote scheduled hooks.", zap.Error(err))
+		return 0, err
+	}
+
+	count := int(res.(int64))
+	if count > 0 {
+		log.D(l, "Scheduled hooks promoted to queue.", func(cm log.CM) {
+			cm.Write(zap.Int("hooks", count))
 		})
 	}
+	return count, nil
+}
+
+//ProcessingQueue returns the name of the list holding the messages this worker is dispatching
+func (w *Worker) ProcessingQueue() string {
+	return fmt.Sprintf("%s:processing:%s", w.Queue, w.ID)
+}
+
+func (w *Worker) leaseKey(workerID string) string {
+	return fmt.Sprintf("%s:lease:%s", w.Queue, workerID)
+}
+
+func (w *Worker) workersKey() string {
+	return fmt.Sprintf("%s:workers", w.Queue)
+}
+
+//Heartbeat registers this worker and renews its lease over the processing list
+func (w *Worker) Heartbeat() error {
+	l := w.Logger.With(
+		zap.String("operation", "Heartbeat"),
+		zap.String("workerID", w.ID),
+	)
+
+	_, err := w.Client.SAdd(w.workersKey(), w.ID).Result()
+	if err != nil {
+		l.Error("Failed to register worker.", zap.Error(err))
+		return err
+	}
 
+	_, err = w.Client.Set(w.leaseKey(w.ID), w.ID, w.VisibilityTimeout).Result()
+	if err != nil {
+		l.Error("Failed to renew worker lease.", zap.Error(err))
+		return err
+	}
+
+	log.D(l, "Worker lease renewed.")
 	return nil
 }
 
+//ReapExpired returns the in-flight hooks of workers with expired leases to the queue
+func (w *Worker) ReapExpired() (int, error) {
+	l := w.Logger.With(
+		zap.String("operation", "ReapExpired"),
+		zap.String("queue", w.Queue),
+	)
+
+	workers, err := w.Client.SMembers(w.workersKey()).Result()
+	if err != nil {
+		l.Error("Failed to retrieve registered workers.", zap.Error(err))
+		return 0, err
+	}
+
+	routes, err := queue.RouteKeys(w.Client, w.Queue)
+	if err != nil {
+		l.Error("Failed to retrieve queues of tenants.", zap.Error(err))
+		return 0, err
+	}
+
+	total := 0
+	for _, workerID := range workers {
+		processingQueue := fmt.Sprintf("%s:processing:%s", w.Queue, workerID)
+		res, err := reapScript.Run(
+			w.Client,
+			append([]string{processingQueue, w.Queue, w.leaseKey(workerID), w.workersKey(), queue.ReadyKey(w.Queue)}, routes...),
+			workerID,
+		).Result()
+		if err != nil {
+			l.Error("Failed to reap worker in-flight hooks.", zap.String("workerID", workerID), zap.Error(err))
+			return total, err
+		}
+
+		count := int(res.(int64))
+		if count > 0 {
+			l.Warn(
+				"Returned in-flight hooks of expired worker to queue.",
+				zap.String("workerID", workerID),
+				zap.Int("hooks", count),
+			)
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+//blocking returns whether pops block waiting for messages. Redis only supports blocking for whole seconds,
+//so workers with shorter block timeouts poll the queue instead
+func (w *Worker) blocking() bool {
+	return w.BlockTimeout >= time.Second
+}
+
+//reliableArg returns the script argument telling whether messages are claimed in the processing list
+func (w *Worker) reliableArg() string {
+	if w.Reliable {
+		return "1"
+	}
+	return "0"
+}
+
+//Dequeue removes the next message from Queue or the queues of the tenants, whichever has its turn, claiming it in the
+//processing list when in reliable mode. It waits up to BlockTimeout for a message if all queues are empty
+func (w *Worker) Dequeue() (string, error) {
+	return w.dequeue(w.queues())
+}
+
+func (w *Worker) dequeue(queues []string) (string, error) {
+	if !w.Reliable && w.blocking() {
+		res, err := w.Client.BLPop(w.BlockTimeout, queues...).Result()
+		if err != nil {
+			return "", err
+		}
+		return res[1], nil
+	}
+
+	keys := append([]string{w.ProcessingQueue(), queue.ReadyKey(w.Queue)}, queues...)
+	deadline := time.Now().Add(w.BlockTimeout)
+	for {
+		res, err := claimScript.Run(w.Client, keys, w.reliableArg()).Result()
+		if err != nil && err.Error() == "redis: nil" && w.Reliable && w.blocking() {
+			//BRPOPLPUSH can only wait on a single queue and pops its newest hook, so the worker waits on the ready list,
+			//signaled whenever hooks are pushed to any queue, and then claims the oldest hook of the queue with the turn.
+			//It waits a second at a time, so hooks pushed without signaling the ready list are found as well
+			timeout := deadline.Sub(time.Now())
+			if timeout < time.Second {
+				return "", err
+			}
+			if timeout > time.Second {
+				timeout = time.Second
+			}
+			_, err = w.Client.BLPop(timeout, queue.ReadyKey(w.Queue)).Result()
+			if err != nil && err.Error() != "redis: nil" {
+				return "", err
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return res.(string), nil
+	}
+}
+
+//DequeueBatch removes up to size messages from Queue or the queues of the tenants, whichever has its turn, in a single
+//round trip, claiming them in the processing list when in reliable mode. If all queues are empty it waits for the next
+//message like Dequeue
+func (w *Worker) DequeueBatch(size int) ([]string, error) {
+	queues := w.queues()
+	if size > 1 {
+		keys := queues
+		if w.Reliable {
+			keys = append(keys, w.ProcessingQueue())
+		}
+		res, err := popBatchScript.Run(w.Client, keys, size, w.reliableArg()).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		msgs := []string{}
+		for _, msg := range res.([]interface{}) {
+			msgs = append(msgs, msg.(string))
+		}
+		if len(msgs) > 0 {
+			return msgs, nil
+		}
+	}
+
+	msg, err := w.dequeue(queues)
+	if err != nil {
+		return nil, err
+	}
+	return []string{msg}, nil
+}
+
+func (w *Worker) ack(raw string) {
+	if !w.Reliable || raw == "" {
+		return
+	}
+
+	_, err := w.Client.LRem(w.ProcessingQueue(), 1, raw).Result()
+	if err != nil {
+		w.Logger.Error(
+			"Failed to remove hook from processing list.",
+			zap.String("operation", "ack"),
+			zap.String("processingQueue", w.ProcessingQueue()),
+			zap.Error(err),
+		)
+	}
+}
+
+func getStringMap(msg map[string]interface{}, field string) map[string]string {
+	result := map[string]string{}
+	if items, ok := msg[field].(map[string]interface{}); ok {
+		for key, value := range items {
+			result[key] = fmt.Sprintf("%v", value)
+		}
+	}
+	if items, ok := msg[field].(map[string]string); ok {
+		for key, value := range items {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+//IdempotencyKeyHeader is the header holding the idempotency key of the hook sent to the webhook endpoint
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+//getHeaders returns the headers to send with the hook, including its idempotency key so endpoints can dedupe it
+func getHeaders(msg map[string]interface{}) map[string]string {
+	headers := getStringMap(msg, "headers")
+	if key, ok := msg["idempotencyKey"].(string); ok && key != "" {
+		if _, ok := headers[IdempotencyKeyHeader]; !ok {
+			headers[IdempotencyKeyHeader] = key
+		}
+	}
+	return headers
+}
+
+func getTags(msg map[string]interface{}) map[string]string {
+	return getStringMap(msg, "tags")
+}
+
+//getRequestBody returns the body actually sent to the webhook endpoint for the given payload
+func getRequestBody(method, payload string) string {
+	if method == "GET" || payload == "NULL" {
+		return ""
+	}
+	return payload
+}
+
+func (w *Worker) signRequest(msg map[string]interface{}, method, payload string, headers map[string]string) {
+	if w.Signer == nil {
+		return
+	}
+	tenant, _ := msg["tenant"].(string)
+	for key, value := range w.Signer.Sign(tenant, getRequestBody(method, payload), time.Now().Unix()) {
+		headers[key] = value
+	}
+}
+
+//getHookID returns the ID the API assigned to the hook, or a new one for hooks enqueued without it
+func getHookID(msg map[string]interface{}) string {
+	if id, ok := msg["id"].(string); ok && id != "" {
+		return id
+	}
+	return uuid.NewV4().String()
+}
+
 //Handle a single message from Queue
 func (w *Worker) Handle(msg map[string]interface{}) error {
+	return w.handle(msg, "")
+}
+
+func (w *Worker) handle(msg map[string]interface{}, raw string) error {
 	l := w.Logger.With(
 		zap.String("operation", "Handle"),
 	)
 
 	if msg["method"] == nil || msg["url"] == nil {
+		w.ack(raw)
 		l.Warn("Web Hook must contain both method and URL to be processed.")
 		return fmt.Errorf("Web Hook must contain both method(%s) and URL(%s) to be processed.", msg["url"], msg["method"])
 	}
@@ -243,20 +824,17 @@ func (w *Worker) Handle(msg map[string]interface{}) error {
 		zap.String("method", msg["method"].(string)),
 		zap.String("url", msg["url"].(string)),
 	)
+	if tags := getTags(msg); len(tags) > 0 {
+		l = l.With(zap.Object("tags", tags))
+	}
 
 	method := msg["method"].(string)
 	url := msg["url"].(string)
-
-	if att, ok := msg["expires"]; ok {
-		dt := int64(att.(float64))
-		expiration := time.Unix(dt, 0)
-
-		l = l.With(zap.Time("expires", expiration))
-
-		if expiration.Before(time.Now()) {
-			l.Warn("Failed to send message since it's expired.")
-			return nil
-		}
+	if id, ok := msg["id"].(string); ok {
+		l = l.With(zap.String("hookID", id))
+	}
+	if tenant, ok := msg["tenant"].(string); ok {
+		l = l.With(zap.String("tenant", tenant))
 	}
 
 	attempts := 0
@@ -271,65 +849,170 @@ func (w *Worker) Handle(msg map[string]interface{}) error {
 			attempts = int(attr)
 		}
 	}
+
+	if att, ok := msg["expires"]; ok {
+		dt := int64(att.(float64))
+		expiration := time.Unix(dt, 0)
+
+		l = l.With(zap.Time("expires", expiration))
+
+		if expiration.Before(time.Now()) {
+			w.ack(raw)
+			l.Warn("Failed to send message since it's expired.")
+			w.trackDelivery(msg, queue.DeliveryFailed, attempts, 0, "", fmt.Errorf("Hook expired before being sent."))
+			return nil
+		}
+	}
+
 	payload := ""
 	if msg["payload"] != nil {
 		payload = msg["payload"].(string)
 	}
+	headers := getHeaders(msg)
+	timeout := time.Duration(0)
+	if timeoutMs, ok := msg["timeoutMs"].(float64); ok {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
 
 	timestamp := w.Clock.Now()
 	if msg["backoff"] != nil {
-		if int64(msg["backoff"].(float64)) > timestamp {
+		backoff := int64(msg["backoff"].(float64))
+		if backoff > timestamp {
 			bkl := l.With(
 				zap.Int("attempts", attempts),
-				zap.Int64("backoff", int64(msg["backoff"].(float64))),
+				zap.Int64("backoff", backoff),
 				zap.Int64("timestamp", timestamp),
 			)
-			log.D(bkl, "Re-enqueueing message with backoff.")
-			err := w.requeueMessage(method, url, payload, attempts, false)
+			log.D(bkl, "Scheduling message with backoff.")
+			err := w.scheduleMessage(msg, backoff)
 			if err != nil {
-				bkl.Error("Could not re-enqueue hook with backoff.", zap.Error(err))
+				bkl.Error("Could not schedule hook with backoff.", zap.Error(err))
+				w.giveBack(raw)
 				return err
 			}
-			log.D(bkl, "Message re-enqueued successfully.")
+			w.ack(raw)
+			log.D(bkl, "Message scheduled successfully.")
 			return nil
 		}
 	}
 
+	if err := w.checkEgress(url); err != nil {
+		w.ack(raw)
+		return w.failMessage(msg, attempts, 0, "", err, "Hook destination is not allowed. Message will be moved to the dead letter queue.")
+	}
+
+	//limits are checked first, so hooks deferred by them do not take the probe of half-open circuits
+	lease, deferred, err := w.acquireLimit(msg, url, timeout, raw)
+	if err != nil {
+		l.Error("Could not check destination limits.", zap.Error(err))
+		w.giveBack(raw)
+		return err
+	}
+	if deferred {
+		return nil
+	}
+
+	parked, err := w.checkCircuit(msg, url, raw)
+	if err != nil {
+		l.Error("Could not check circuit of destination host.", zap.Error(err))
+		w.releaseLimit(lease)
+		w.giveBack(raw)
+		return err
+	}
+	if parked {
+		w.releaseLimit(lease)
+		return nil
+	}
+
 	log.D(l, "Performing request...", func(cm log.CM) {
 		cm.Write(zap.String("payload", payload), zap.Int("attempts", attempts))
 	})
 
+	if attempts == 0 {
+		w.recordInJournal(msg)
+	}
+
+	token := w.startDispatch(msg, raw)
+	w.acquireSlot()
 	go func() {
-		status, _, err := w.DoRequest(method, url, payload)
+		defer w.dispatches.Done()
+		defer w.releaseSlot()
+		defer w.releaseLimit(lease)
+
+		w.trackDelivery(msg, queue.DeliveryInFlight, attempts+1, 0, "", nil)
+		w.signRequest(msg, method, payload, headers)
+		resp, err := w.DoRequest(method, url, payload, headers, timeout)
+		if !w.finishDispatch(token) {
+			l.Warn("Hook finished after being returned to the queue by worker drain. Discarding its result.")
+			return
+		}
+		defer w.ack(raw)
+
+		if err != nil && isEgressError(err) {
+			err2 := w.failMessage(msg, attempts, 0, "", err, "Hook destination is not allowed. Message will be moved to the dead letter queue.")
+			if err2 != nil {
+				l.Error("Could not fail hook.", zap.Error(err2))
+			}
+			return
+		}
 		if err != nil {
+			w.recordCircuitResult(url, 0, err)
 			l.Error("Could not process hook, trying again later.", zap.Error(err), zap.Int("attempts", attempts))
-			err2 := w.requeueMessage(method, url, payload, attempts, true)
+			err2 := w.requeueMessage(msg, attempts, 0, "", err, 0)
 			if err2 != nil {
 				l.Error("Could not re-enqueue hook.", zap.Error(err2))
 			}
 			return
 		}
-		if status > 399 {
+
+		status := resp.StatusCode
+		w.recordCircuitResult(url, status, nil)
+		statusPolicy := w.getStatusPolicy()
+		switch statusPolicy.Classify(status) {
+		case StatusPermanent:
+			err := fmt.Errorf("Error requesting webhook. Status code: %d", status)
+			err2 := w.failMessage(msg, attempts, status, resp.Body, err, "Hook failed with a permanent status code. Message will be moved to the dead letter queue.")
+			if err2 != nil {
+				l.Error("Could not fail hook.", zap.Error(err2))
+			}
+			return
+		case StatusRetryable:
 			err := fmt.Errorf("Error requesting webhook. Status code: %d", status)
+			retryAfter := statusPolicy.RetryAfterDelay(status, resp.RetryAfter, time.Unix(0, w.Clock.Now()))
 			l.Error(
 				"Could not process hook, trying again later.",
 				zap.Int("statusCode", status),
 				zap.Error(err),
 				zap.Int("attempts", attempts),
+				zap.Duration("retryAfter", retryAfter),
 			)
-			err2 := w.requeueMessage(method, url, payload, attempts, true)
+			err2 := w.requeueMessage(msg, attempts, status, resp.Body, err, retryAfter)
 			if err2 != nil {
 				l.Error("Could not re-enqueue hook.", zap.Error(err2))
 			}
 			return
 		}
 
+		w.trackDelivery(msg, queue.DeliveryDelivered, attempts+1, status, resp.Body, nil)
 		log.I(l, "Webhook processed successfully.")
 	}()
 
 	return nil
 }
 
+//popSize returns how many messages to take from Queue at once, never more than the free slots in the dispatcher pool
+func (w *Worker) popSize() int {
+	pool := w.getPool()
+	size := w.PopBatchSize
+	if free := pool.Size - pool.Len(); size > free {
+		size = free
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
 //ProcessSubscription to messages from Queue
 func (w *Worker) ProcessSubscription() error {
 	l := w.Logger.With(
@@ -338,56 +1021,173 @@ func (w *Worker) ProcessSubscription() error {
 		zap.Int("maxAttempts", w.MaxAttempts),
 	)
 
-	res, err := w.Client.LPop(w.Queue).Result()
+	w.waitForSlot()
+	if w.stopping() {
+		return nil
+	}
+
+	msgs, err := w.DequeueBatch(w.popSize())
 	if err != nil {
 		if err.Error() == "redis: nil" {
 			log.D(l, "No hooks to be processed.")
+			if !w.blocking() {
+				time.Sleep(w.BlockTimeout)
+			}
 			return nil
 		}
 		l.Error("Worker failed to consume message from queue.", zap.Error(err))
 		return err
 	}
 
-	var msg map[string]interface{}
-	err = json.Unmarshal([]byte(res), &msg)
-	if err != nil {
-		l.Error("Worker failed to deserialize message from queue.", zap.Error(err))
+	if w.stopping() {
+		//the worker was stopped while waiting for messages, so they are given back to be sent by other workers
+		_, err = w.returnToQueue(msgs)
 		return err
 	}
 
-	err = w.Handle(msg)
-	if err != nil {
-		return err
+	var firstErr error
+	for _, res := range msgs {
+		var msg map[string]interface{}
+		err = json.Unmarshal([]byte(res), &msg)
+		if err != nil {
+			w.ack(res)
+			l.Error("Worker failed to deserialize message from queue.", zap.Error(err))
+		} else {
+			err = w.handle(msg, res)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
 	}
 
-	log.D(l, "Worker consumed message successfully.")
+	log.D(l, "Worker consumed messages successfully.", func(cm log.CM) {
+		cm.Write(zap.Int("messages", len(msgs)))
+	})
 	return nil
 }
 
-//Start a new worker with the given params
+func (w *Worker) promoteScheduled() {
+	l := w.Logger.With(
+		zap.String("operation", "promoteScheduled"),
+		zap.String("queue", w.Queue),
+	)
+
+	for !w.stopping() {
+		raven.CapturePanic(func() {
+			_, err := w.PromoteScheduled()
+			if err != nil {
+				l.Warn("Failed to promote scheduled hooks.", zap.Error(err))
+			}
+		}, nil)
+		time.Sleep(w.PromoteInterval)
+	}
+}
+
+func (w *Worker) keepAlive(stop <-chan struct{}, done chan<- struct{}) {
+	l := w.Logger.With(
+		zap.String("operation", "keepAlive"),
+		zap.String("queue", w.Queue),
+		zap.String("workerID", w.ID),
+	)
+
+	//the lease is renewed until Stop drains the hooks in flight, so other workers do not reap and send them again
+	defer close(done)
+	for {
+		raven.CapturePanic(func() {
+			err := w.Heartbeat()
+			if err != nil {
+				l.Warn("Failed to renew worker lease.", zap.Error(err))
+			}
+			_, err = w.ReapExpired()
+			if err != nil {
+				l.Warn("Failed to reap expired in-flight hooks.", zap.Error(err))
+			}
+		}, nil)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(w.VisibilityTimeout / 3):
+		}
+	}
+}
+
+//startKeepAlive registers the lease of the worker and keeps renewing it, unless the worker is already stopping
+func (w *Worker) startKeepAlive(l zap.Logger) {
+	w.keepAliveMu.Lock()
+	defer w.keepAliveMu.Unlock()
+	if w.stopping() {
+		return
+	}
+
+	err := w.Heartbeat()
+	if err != nil {
+		l.Panic("Could not register worker lease.", zap.Error(err))
+	}
+	w.keepAliveStop = make(chan struct{})
+	w.keepAliveDone = make(chan struct{})
+	go w.keepAlive(w.keepAliveStop, w.keepAliveDone)
+}
+
+//stopKeepAlive stops renewing the lease of the worker, waiting for the renewal in progress to finish
+func (w *Worker) stopKeepAlive() {
+	w.keepAliveMu.Lock()
+	stop, done := w.keepAliveStop, w.keepAliveDone
+	w.keepAliveStop = nil
+	w.keepAliveMu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+//Start a new worker with the given params. It returns once Stop is called
 func (w *Worker) Start() {
+	w.running.Add(1)
+	defer w.running.Done()
+
 	l := w.Logger.With(
 		zap.String("operation", "Subscribe"),
 		zap.String("queue", w.Queue),
 		zap.Int("maxAttempts", w.MaxAttempts),
+		zap.Int("poolSize", w.PoolSize),
+		zap.Int("popBatchSize", w.PopBatchSize),
+		zap.Duration("blockTimeout", w.BlockTimeout),
 	)
 
-	for {
+	if w.Reliable {
+		w.startKeepAlive(l)
+	}
+	go w.promoteScheduled()
+	if w.StatusInterval > 0 {
+		go w.reportStatus()
+	}
+	if w.TLS != nil && w.TLS.ReloadInterval > 0 {
+		go w.reloadTLS()
+	}
+
+	for !w.stopping() {
 		log.D(l, "Subscribing to next message...")
 
-		for i := 0; i < 50; i++ {
+		for i := 0; i < 50 && !w.stopping(); i++ {
 			raven.CapturePanic(func() {
 				err := w.ProcessSubscription()
 				if err != nil {
 					l.Warn("Failed to retrieve messages from queue.", zap.Error(err))
 					tags := map[string]string{
 						"queue":       w.Queue,
-						"maxAttempts": string(w.MaxAttempts),
+						"maxAttempts": strconv.Itoa(w.MaxAttempts),
 					}
 					raven.CaptureError(err, tags)
+					time.Sleep(50 * time.Millisecond)
 				}
-				time.Sleep(50 * time.Millisecond)
 			}, nil)
 		}
 	}
+
+	l.Info("Worker stopped taking hooks from the queue.")
 }
@@ -12,13 +12,16 @@ import (
 	"io/ioutil"
 	"math"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"time"
 
+	"golang.org/x/net/context"
 	"gopkg.in/redis.v4"
 
 	"github.com/satori/go.uuid"
+	santiagoQueue "github.com/topfreegames/santiago/queue"
 	"github.com/topfreegames/santiago/testing"
 	. "github.com/topfreegames/santiago/worker/handler"
 
@@ -148,6 +151,248 @@ var _ = Describe("Santiago Worker", func() {
 		})
 	})
 
+	Describe("Delivery Tracking", func() {
+		It("should mark hook as delivered", func() {
+			queue := uuid.NewV4().String()
+			startRouteHandler([]string{"/webhook-delivered"}, 52525)
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+
+			hookID := uuid.NewV4().String()
+			msg := map[string]interface{}{
+				"id":        hookID,
+				"method":    "POST",
+				"url":       "http://localhost:52525/webhook-delivered",
+				"payload":   "{\"qwe\":123}",
+				"attempts":  0,
+				"createdAt": float64(1478401023),
+			}
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			delivery, err := santiagoQueue.NewDeliveries(testClient, queue, time.Minute).Get(hookID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delivery).NotTo(BeNil())
+			Expect(delivery.Status).To(Equal(santiagoQueue.DeliveryDelivered))
+			Expect(delivery.Attempts).To(Equal(1))
+			Expect(delivery.LastStatusCode).To(Equal(200))
+			Expect(delivery.CreatedAt).To(BeEquivalentTo(1478401023))
+		})
+
+		It("should keep hook pending with last error while it is retried", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+
+			hookID := uuid.NewV4().String()
+			msg := map[string]interface{}{
+				"id":       hookID,
+				"method":   "POST",
+				"url":      "http://localhost:52526/webhook-unreachable",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 0,
+			}
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			delivery, err := santiagoQueue.NewDeliveries(testClient, queue, time.Minute).Get(hookID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delivery).NotTo(BeNil())
+			Expect(delivery.Status).To(Equal(santiagoQueue.DeliveryPending))
+			Expect(delivery.Attempts).To(Equal(1))
+			Expect(delivery.LastError).NotTo(BeEmpty())
+
+			scheduled, err := testClient.ZRange(worker.ScheduledQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled).To(HaveLen(1))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(scheduled[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["id"]).To(Equal(hookID))
+		})
+	})
+
+	Describe("Message Headers", func() {
+		It("should send webhook with headers", func() {
+			responses := startRouteHandler([]string{"/webhook-headers"}, 52525)
+
+			worker := NewDefault("127.0.0.1", 57575, "", 0, logger)
+			msg := map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-headers",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 0,
+				"headers": map[string]interface{}{
+					"Content-Type":    "application/json",
+					"Idempotency-Key": "some-key",
+				},
+			}
+
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			Expect(*responses).To(HaveLen(1))
+			req := (*responses)[0]["request"].(*http.Request)
+			Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(req.Header.Get("Idempotency-Key")).To(Equal("some-key"))
+		})
+
+		It("should send idempotency key of the hook as header", func() {
+			responses := startRouteHandler([]string{"/webhook-idempotency-key"}, 52525)
+
+			worker := NewDefault("127.0.0.1", 57575, "", 0, logger)
+			msg := map[string]interface{}{
+				"method":         "POST",
+				"url":            "http://localhost:52525/webhook-idempotency-key",
+				"payload":        "{\"qwe\":123}",
+				"attempts":       0,
+				"idempotencyKey": "order-123",
+			}
+
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			Expect(*responses).To(HaveLen(1))
+			req := (*responses)[0]["request"].(*http.Request)
+			Expect(req.Header.Get("Idempotency-Key")).To(Equal("order-123"))
+		})
+
+		It("should sign webhook with tenant secret", func() {
+			responses := startRouteHandler([]string{"/webhook-signed"}, 52525)
+
+			worker := NewDefault("127.0.0.1", 57575, "", 0, logger)
+			worker.Signer = NewSigner([]string{"global-secret"}, map[string][]string{
+				"tenant-a": []string{"tenant-secret"},
+			})
+			msg := map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-signed",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 0,
+				"tenant":   "tenant-a",
+			}
+
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			Expect(*responses).To(HaveLen(1))
+			req := (*responses)[0]["request"].(*http.Request)
+			timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(req.Header.Get(SignatureHeader)).To(Equal(
+				"sha256=" + ComputeSignature("tenant-secret", timestamp, "{\"qwe\":123}"),
+			))
+		})
+
+		It("should sign replayed dead letter with tenant secret", func() {
+			queue := uuid.NewV4().String()
+			startRouteHandler([]string{}, 52525)
+			requests := []*http.Request{}
+			http.HandleFunc("/webhook-replay-signed", func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r)
+				if len(requests) == 1 {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			})
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.Signer = NewSigner([]string{"global-secret"}, map[string][]string{
+				"tenant-a": []string{"tenant-secret"},
+			})
+			err := worker.Handle(map[string]interface{}{
+				"method":      "POST",
+				"url":         "http://localhost:52525/webhook-replay-signed",
+				"payload":     "{\"qwe\":123}",
+				"attempts":    1,
+				"maxAttempts": float64(1),
+				"tenant":      "tenant-a",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			dlq := santiagoQueue.NewDeadLetterQueue(testClient, queue)
+			letters, err := dlq.List(0, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(letters).To(HaveLen(1))
+			Expect(letters[0].Tenant).To(Equal("tenant-a"))
+
+			found, err := dlq.Replay(letters[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+
+			err = worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			Expect(requests).To(HaveLen(2))
+			req := requests[1]
+			timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(req.Header.Get(SignatureHeader)).To(Equal(
+				"sha256=" + ComputeSignature("tenant-secret", timestamp, "{\"qwe\":123}"),
+			))
+		})
+
+		It("should keep headers when hook is re-enqueued", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			msg := map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-headers-retry",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 0,
+				"headers": map[string]interface{}{
+					"Content-Type": "application/json",
+				},
+			}
+
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			res, err := testClient.ZRange(worker.ScheduledQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(res[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["attempts"]).To(BeEquivalentTo(1))
+			Expect(hook["headers"]).To(HaveKeyWithValue("Content-Type", "application/json"))
+		})
+	})
+
 	Describe("Message subscription", func() {
 		It("should subscribe to webhook", func() {
 			queue := uuid.NewV4().String()
@@ -204,7 +449,7 @@ var _ = Describe("Santiago Worker", func() {
 
 			time.Sleep(50 * time.Millisecond)
 
-			res, err := testClient.LRange(queue, 0, 1).Result()
+			res, err := testClient.ZRange(worker.ScheduledQueue(), 0, -1).Result()
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(res).To(HaveLen(1))
@@ -224,6 +469,10 @@ var _ = Describe("Santiago Worker", func() {
 
 			time.Sleep(50 * time.Millisecond)
 
+			promoted, err := worker.PromoteScheduled()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(promoted).To(Equal(1))
+
 			err = worker.ProcessSubscription()
 			Expect(err).NotTo(HaveOccurred())
 
@@ -258,7 +507,7 @@ var _ = Describe("Santiago Worker", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			time.Sleep(50 * time.Millisecond)
-			res, err := testClient.LRange(queue, 0, 1).Result()
+			res, err := testClient.ZRange(worker.ScheduledQueue(), 0, -1).Result()
 			Expect(err).NotTo(HaveOccurred())
 
 			var hook map[string]interface{}
@@ -281,11 +530,15 @@ var _ = Describe("Santiago Worker", func() {
 				By(fmt.Sprintf("Backoff %d", i))
 				power := int64(math.Pow(2, float64(i)))
 				clock.currentTime = 10 * int64(power) * ms
+				promoted, err := worker.PromoteScheduled()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(promoted).To(Equal(1))
+
 				err = worker.ProcessSubscription()
 				Expect(err).NotTo(HaveOccurred())
 				time.Sleep(10 * time.Millisecond)
 
-				res, err = testClient.LRange(queue, 0, 1).Result()
+				res, err = testClient.ZRange(worker.ScheduledQueue(), 0, -1).Result()
 				Expect(err).NotTo(HaveOccurred())
 
 				err = json.Unmarshal([]byte(res[0]), &hook)
@@ -295,6 +548,142 @@ var _ = Describe("Santiago Worker", func() {
 			}
 		})
 
+		It("should move hook to dead letter queue after max attempts", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				1, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+
+			msg := map[string]interface{}{
+				"method":    "POST",
+				"url":       "http://localhost:52525/webhook-dead-letter",
+				"payload":   "{\"qwe\":123}",
+				"attempts":  2,
+				"createdAt": 1478401023,
+			}
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			total, err := testClient.ZCard(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+
+			letters, err := santiagoQueue.NewDeadLetterQueue(testClient, queue).List(0, 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(letters).To(HaveLen(1))
+			Expect(letters[0].ID).NotTo(BeEmpty())
+			Expect(letters[0].Method).To(Equal("POST"))
+			Expect(letters[0].URL).To(Equal("http://localhost:52525/webhook-dead-letter"))
+			Expect(letters[0].Payload).To(Equal("{\"qwe\":123}"))
+			Expect(letters[0].Attempts).To(Equal(2))
+			Expect(letters[0].LastError).NotTo(BeEmpty())
+			Expect(letters[0].CreatedAt).To(BeEquivalentTo(1478401023))
+			Expect(letters[0].FailedAt).To(BeNumerically(">", 0))
+		})
+
+		It("should honor max attempts set in the hook", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+
+			msg := map[string]interface{}{
+				"method":      "POST",
+				"url":         "http://localhost:52525/webhook-hook-max-attempts",
+				"payload":     "{\"qwe\":123}",
+				"attempts":    1,
+				"maxAttempts": float64(1),
+				"createdAt":   1478401023,
+			}
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			total, err := testClient.ZCard(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+
+			count, err := santiagoQueue.NewDeadLetterQueue(testClient, queue).Count()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(1))
+		})
+
+		It("should record dispatched hook in delivery journal", func() {
+			queue := uuid.NewV4().String()
+			startRouteHandler([]string{"/webhook-journal"}, 52525)
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.JournalRetention = time.Hour
+
+			err := pushHook(
+				testClient, queue, "POST",
+				"http://localhost:52525/webhook-journal",
+				map[string]interface{}{
+					"qwe": 123,
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(10 * time.Millisecond)
+
+			journal := santiagoQueue.NewJournal(testClient, queue, worker.JournalRetention)
+			entries, err := journal.Find(time.Now().Add(-time.Minute), time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Method).To(Equal("POST"))
+			Expect(entries[0].URL).To(Equal("http://localhost:52525/webhook-journal"))
+			Expect(entries[0].Payload).To(Equal("{\"qwe\":123}"))
+		})
+
+		It("should not record dispatched hook if delivery journal is disabled", func() {
+			queue := uuid.NewV4().String()
+			startRouteHandler([]string{"/webhook-no-journal"}, 52525)
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			Expect(worker.JournalRetention).To(BeEquivalentTo(0))
+
+			err := pushHook(
+				testClient, queue, "POST",
+				"http://localhost:52525/webhook-no-journal",
+				map[string]interface{}{
+					"qwe": 123,
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(10 * time.Millisecond)
+
+			journal := santiagoQueue.NewJournal(testClient, queue, time.Hour)
+			entries, err := journal.Find(time.Now().Add(-time.Minute), time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
 		It("should subscribe to webhook if message has expiration but not expired", func() {
 			queue := uuid.NewV4().String()
 			responses := startRouteHandler([]string{"/webhook-subscribed-not-expired"}, 52525)
@@ -398,7 +787,1343 @@ var _ = Describe("Santiago Worker", func() {
 			Expect(*responses).To(HaveLen(1))
 			resp := (*responses)[0]["payload"].(map[string]interface{})
 			Expect(int(resp["qwe"].(float64))).To(Equal(123))
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
 		})
 
+		It("should only promote scheduled hooks that are due", func() {
+			queue := uuid.NewV4().String()
+			clock := &mockClock{currentTime: 0}
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, clock,
+			)
+
+			for i := 1; i <= 3; i++ {
+				msg := map[string]interface{}{
+					"attempts": i,
+					"backoff":  i * 1000,
+					"method":   "POST",
+					"payload":  "{\"qwe\": 123}",
+					"url":      "http://localhost:52525/webhook-scheduled",
+				}
+				err := worker.Handle(msg)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			total, err := testClient.ZCard(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(3))
+
+			clock.currentTime = 2000
+			promoted, err := worker.PromoteScheduled()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(promoted).To(Equal(2))
+
+			res, err := testClient.LRange(queue, 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(2))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(res[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["attempts"]).To(BeEquivalentTo(1))
+
+			total, err = testClient.ZCard(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+		})
+
+	})
+
+	Describe("Dispatcher pool", func() {
+		It("should not take hooks from queue while pool is full", func() {
+			queue := uuid.NewV4().String()
+			startRouteHandler([]string{}, 52525)
+			http.HandleFunc("/webhook-slow", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+			})
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.PoolSize = 1
+
+			for i := 0; i < 2; i++ {
+				hookJSON, _ := json.Marshal(map[string]interface{}{
+					"method":   "POST",
+					"url":      "http://localhost:52525/webhook-slow",
+					"payload":  "{}",
+					"attempts": 0,
+				})
+				_, err := testClient.RPush(queue, hookJSON).Result()
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			err := worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			go worker.ProcessSubscription()
+			time.Sleep(50 * time.Millisecond)
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+
+			time.Sleep(300 * time.Millisecond)
+
+			total, err = testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+		})
+	})
+
+	Describe("Destination limits", func() {
+		It("should defer hook over the limit without counting an attempt", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.Limiter = NewLimiter(testClient, queue, []*LimitRule{
+				{Host: "localhost", MaxConcurrency: 1},
+			})
+			_, wait, err := worker.Limiter.Acquire("http://localhost:52525/webhook-limited", time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(wait).To(BeZero())
+
+			msg := map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-limited",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 2,
+			}
+			err = worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			scheduled, err := testClient.ZRangeWithScores(worker.ScheduledQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled).To(HaveLen(1))
+			Expect(scheduled[0].Score).To(BeNumerically(">", time.Now().UnixNano()))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(scheduled[0].Member.(string)), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["attempts"]).To(BeEquivalentTo(2))
+		})
+	})
+
+	Describe("Circuit breaker", func() {
+		It("should park hook while circuit of its host is open", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.CircuitBreaker = santiagoQueue.NewCircuitBreaker(testClient, queue, 1, time.Minute)
+
+			msg := map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52527/webhook-circuit",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 0,
+			}
+			err := worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			circuit, err := worker.CircuitBreaker.Get("localhost:52527")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(circuit.State).To(Equal(santiagoQueue.CircuitOpen))
+
+			_, err = testClient.Del(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			scheduled, err := testClient.ZRangeWithScores(worker.ScheduledQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled).To(HaveLen(1))
+			Expect(scheduled[0].Score).To(BeNumerically(">", time.Now().Add(50*time.Second).UnixNano()))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(scheduled[0].Member.(string)), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hook["attempts"]).To(BeEquivalentTo(0))
+		})
+		It("should not take the probe of a half-open circuit with hooks deferred by destination limits", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.CircuitBreaker = santiagoQueue.NewCircuitBreaker(testClient, queue, 1, 10*time.Millisecond)
+			worker.Limiter = NewLimiter(testClient, queue, []*LimitRule{
+				{Host: "localhost", MaxConcurrency: 1},
+			})
+
+			opened, err := worker.CircuitBreaker.RecordFailure("localhost:52527")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(opened).To(BeTrue())
+			_, wait, err := worker.Limiter.Acquire("http://localhost:52527/webhook-circuit-limited", time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(wait).To(BeZero())
+
+			time.Sleep(20 * time.Millisecond)
+
+			msg := map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52527/webhook-circuit-limited",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 0,
+			}
+			err = worker.Handle(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			scheduled, err := testClient.ZCard(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled).To(BeEquivalentTo(1))
+
+			circuit, err := worker.CircuitBreaker.Get("localhost:52527")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(circuit.State).To(Equal(santiagoQueue.CircuitOpen))
+
+			probeWait, err := worker.CircuitBreaker.Allow("localhost:52527")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(probeWait).To(BeZero())
+		})
+	})
+
+	Describe("Retry policies", func() {
+		var getScheduledHook = func(worker *Worker) map[string]interface{} {
+			res, err := testClient.ZRange(worker.ScheduledQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(res[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			return hook
+		}
+
+		var failHook = func(worker *Worker, hook map[string]interface{}) {
+			hookJSON, _ := json.Marshal(hook)
+			_, err := testClient.RPush(worker.Queue, hookJSON).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		It("should use the hook retry policy", func() {
+			worker := New(
+				uuid.NewV4().String(),
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &mockClock{},
+			)
+			worker.RetryPolicy = &santiagoQueue.LinearPolicy{Base: time.Minute}
+
+			failHook(worker, map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-retry-policy",
+				"payload":  "{}",
+				"attempts": 0,
+				"retry": map[string]interface{}{
+					"policy":     "fixed",
+					"scheduleMs": []int{50000, 100000},
+				},
+			})
+
+			hook := getScheduledHook(worker)
+			Expect(hook["attempts"]).To(BeEquivalentTo(1))
+			Expect(hook["backoff"]).To(BeEquivalentTo(50 * time.Second))
+			Expect(hook["retryDelayMs"]).To(BeEquivalentTo(50000))
+		})
+
+		It("should use the destination retry policy", func() {
+			worker := New(
+				uuid.NewV4().String(),
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &mockClock{},
+			)
+			worker.RetryPolicy = &santiagoQueue.LinearPolicy{Base: time.Minute}
+			worker.RetryRules = []*RetryRule{
+				{Host: "other.com", Policy: &santiagoQueue.LinearPolicy{Base: time.Hour}},
+				{Prefix: "http://localhost:52525/webhook-retry", Policy: &santiagoQueue.LinearPolicy{Base: 30 * time.Second}},
+			}
+
+			failHook(worker, map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-retry-destination",
+				"payload":  "{}",
+				"attempts": 0,
+			})
+
+			hook := getScheduledHook(worker)
+			Expect(hook["backoff"]).To(BeEquivalentTo(30 * time.Second))
+		})
+
+		It("should use the worker retry policy", func() {
+			worker := New(
+				uuid.NewV4().String(),
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &mockClock{},
+			)
+			worker.RetryPolicy = &santiagoQueue.ExponentialPolicy{Base: time.Second, MaxDelay: 5 * time.Second}
+
+			failHook(worker, map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-retry-worker",
+				"payload":  "{}",
+				"attempts": 3,
+			})
+
+			hook := getScheduledHook(worker)
+			Expect(hook["attempts"]).To(BeEquivalentTo(4))
+			Expect(hook["backoff"]).To(BeEquivalentTo(5 * time.Second))
+		})
+	})
+
+	Describe("Status policy", func() {
+		var newReceiver = func(status int, retryAfter string) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+		}
+
+		var newWorker = func(clock Clock) *Worker {
+			worker := New(
+				uuid.NewV4().String(),
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, clock,
+			)
+			policy, err := NewStatusPolicy(nil, []string{"400", "410"})
+			Expect(err).NotTo(HaveOccurred())
+			worker.StatusPolicy = policy
+			return worker
+		}
+
+		var getScheduledHook = func(worker *Worker) map[string]interface{} {
+			res, err := testClient.ZRange(worker.ScheduledQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+
+			var hook map[string]interface{}
+			err = json.Unmarshal([]byte(res[0]), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			return hook
+		}
+
+		It("should not retry hooks with permanent status codes", func() {
+			receiver := newReceiver(http.StatusGone, "")
+			defer receiver.Close()
+			worker := newWorker(&RealClock{})
+
+			err := worker.Handle(map[string]interface{}{
+				"method":   "POST",
+				"url":      receiver.URL,
+				"payload":  "{}",
+				"attempts": 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(50 * time.Millisecond)
+
+			total, err := testClient.ZCard(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+
+			letters, err := santiagoQueue.NewDeadLetterQueue(testClient, worker.Queue).List(0, 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(letters).To(HaveLen(1))
+			Expect(letters[0].LastStatusCode).To(Equal(http.StatusGone))
+			Expect(letters[0].Attempts).To(Equal(0))
+		})
+
+		It("should retry hooks after Retry-After seconds", func() {
+			receiver := newReceiver(http.StatusTooManyRequests, "120")
+			defer receiver.Close()
+			worker := newWorker(&mockClock{})
+
+			err := worker.Handle(map[string]interface{}{
+				"method":   "POST",
+				"url":      receiver.URL,
+				"payload":  "{}",
+				"attempts": 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(50 * time.Millisecond)
+
+			hook := getScheduledHook(worker)
+			Expect(hook["attempts"]).To(BeEquivalentTo(1))
+			Expect(hook["backoff"]).To(BeEquivalentTo(2 * time.Minute))
+		})
+
+		It("should retry hooks after Retry-After date", func() {
+			now := time.Date(2016, 11, 1, 10, 0, 0, 0, time.UTC)
+			receiver := newReceiver(http.StatusServiceUnavailable, now.Add(time.Minute).Format(http.TimeFormat))
+			defer receiver.Close()
+			worker := newWorker(&mockClock{currentTime: now.UnixNano()})
+
+			err := worker.Handle(map[string]interface{}{
+				"method":   "POST",
+				"url":      receiver.URL,
+				"payload":  "{}",
+				"attempts": 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(50 * time.Millisecond)
+
+			hook := getScheduledHook(worker)
+			Expect(hook["backoff"]).To(BeEquivalentTo(now.Add(time.Minute).UnixNano()))
+		})
+
+		It("should use the retry policy for retryable status codes without Retry-After", func() {
+			receiver := newReceiver(http.StatusInternalServerError, "")
+			defer receiver.Close()
+			worker := newWorker(&mockClock{})
+
+			err := worker.Handle(map[string]interface{}{
+				"method":   "POST",
+				"url":      receiver.URL,
+				"payload":  "{}",
+				"attempts": 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(50 * time.Millisecond)
+
+			hook := getScheduledHook(worker)
+			Expect(hook["backoff"]).To(BeEquivalentTo(20 * time.Millisecond))
+		})
+	})
+
+	Describe("Blocking pop", func() {
+		var pushHooks = func(queue string, count int) {
+			hooks := make([]interface{}, count)
+			for i := 0; i < count; i++ {
+				hookJSON, _ := json.Marshal(map[string]interface{}{
+					"method":   "POST",
+					"url":      "http://localhost:52525/webhook-batch",
+					"payload":  strconv.Itoa(i),
+					"attempts": 0,
+				})
+				hooks[i] = string(hookJSON)
+			}
+			_, err := testClient.RPush(queue, hooks...).Result()
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var getPayload = func(raw string) string {
+			var hook map[string]interface{}
+			err := json.Unmarshal([]byte(raw), &hook)
+			Expect(err).NotTo(HaveOccurred())
+			return hook["payload"].(string)
+		}
+
+		It("should block until a hook is pushed", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 2*time.Second, "", 10, &RealClock{},
+			)
+
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				pushHooks(queue, 1)
+			}()
+
+			start := time.Now()
+			raw, err := worker.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getPayload(raw)).To(Equal("0"))
+			Expect(time.Now().Sub(start)).To(BeNumerically(">=", 100*time.Millisecond))
+			Expect(time.Now().Sub(start)).To(BeNumerically("<", time.Second))
+		})
+
+		It("should give up after block timeout", func() {
+			worker := New(
+				uuid.NewV4().String(),
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Second, "", 10, &RealClock{},
+			)
+
+			start := time.Now()
+			err := worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Now().Sub(start)).To(BeNumerically(">=", 900*time.Millisecond))
+		})
+
+		It("should block until a hook is pushed in reliable mode", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 2*time.Second, "", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				pushHooks(queue, 1)
+			}()
+
+			raw, err := worker.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getPayload(raw)).To(Equal("0"))
+
+			processing, err := testClient.LRange(worker.ProcessingQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(processing).To(Equal([]string{raw}))
+		})
+
+		It("should block until a hook is pushed to any queue in reliable mode, taking the oldest one", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 3*time.Second, "", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			hooks := []string{}
+			for i := 0; i < 2; i++ {
+				hookJSON, _ := json.Marshal(map[string]interface{}{
+					"method":   "POST",
+					"url":      "http://localhost:52525/webhook-batch",
+					"payload":  strconv.Itoa(i),
+					"priority": santiagoQueue.PriorityHigh,
+					"attempts": 0,
+				})
+				hooks = append(hooks, string(hookJSON))
+			}
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				err := santiagoQueue.Requeue(testClient, queue, hooks...)
+				Expect(err).NotTo(HaveOccurred())
+			}()
+
+			start := time.Now()
+			raw, err := worker.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getPayload(raw)).To(Equal("0"))
+			Expect(time.Now().Sub(start)).To(BeNumerically("<", 500*time.Millisecond))
+
+			raw, err = worker.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getPayload(raw)).To(Equal("1"))
+
+			processing, err := testClient.LRange(worker.ProcessingQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(processing).To(Equal(hooks))
+		})
+
+		It("should dequeue hooks in batches", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.Reliable = true
+			pushHooks(queue, 5)
+
+			raws, err := worker.DequeueBatch(3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(raws).To(HaveLen(3))
+			for i, raw := range raws {
+				Expect(getPayload(raw)).To(Equal(strconv.Itoa(i)))
+			}
+
+			processing, err := testClient.LRange(worker.ProcessingQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(processing).To(Equal(raws))
+
+			raws, err = worker.DequeueBatch(3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(raws).To(HaveLen(2))
+
+			_, err = worker.DequeueBatch(3)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("redis: nil"))
+		})
+
+		It("should dispatch a batch of hooks per subscription", func() {
+			queue := uuid.NewV4().String()
+			responses := startRouteHandler([]string{"/webhook-batch"}, 52525)
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.PopBatchSize = 10
+			pushHooks(queue, 5)
+
+			err := worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+
+			time.Sleep(50 * time.Millisecond)
+			Expect(len(*responses)).To(BeNumerically(">=", 5))
+		})
+
+		It("should not take more hooks than free pool slots", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.PoolSize = 2
+			worker.PopBatchSize = 10
+			worker.Reliable = true
+			pushHooks(queue, 5)
+
+			err := worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(3))
+		})
+
+		Measure("it should dequeue hooks", func(b Benchmarker) {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			pushHooks(queue, 100)
+
+			runtime := b.Time("runtime", func() {
+				for i := 0; i < 100; i++ {
+					_, err := worker.Dequeue()
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+			b.RecordValue("hooks per second", 100/runtime.Seconds())
+
+			Expect(runtime.Seconds()).Should(BeNumerically("<", 0.5), "Dequeue shouldn't take too long.")
+		}, 20)
+
+		Measure("it should dequeue batches of hooks", func(b Benchmarker) {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			pushHooks(queue, 100)
+
+			runtime := b.Time("runtime", func() {
+				for i := 0; i < 10; i++ {
+					raws, err := worker.DequeueBatch(10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(raws).To(HaveLen(10))
+				}
+			})
+			b.RecordValue("hooks per second", 100/runtime.Seconds())
+
+			Expect(runtime.Seconds()).Should(BeNumerically("<", 0.1), "Batch dequeue shouldn't take too long.")
+		}, 20)
+	})
+
+	Describe("Graceful shutdown", func() {
+		var slowHook = func(queue, url string) {
+			hookJSON, _ := json.Marshal(map[string]interface{}{
+				"method":   "POST",
+				"url":      url,
+				"payload":  "{}",
+				"attempts": 0,
+			})
+			_, err := testClient.RPush(queue, hookJSON).Result()
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("should wait for in-flight hooks when stopping", func() {
+			queue := uuid.NewV4().String()
+			startRouteHandler([]string{}, 52525)
+			sent := 0
+			http.HandleFunc("/webhook-drain", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(100 * time.Millisecond)
+				sent++
+			})
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			slowHook(queue, "http://localhost:52525/webhook-drain")
+
+			err := worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(worker.InFlight()).To(Equal(1))
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err = worker.Stop(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(Equal(1))
+			Expect(worker.InFlight()).To(Equal(0))
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+		})
+
+		It("should return unfinished hooks to the queue when drain times out", func() {
+			queue := uuid.NewV4().String()
+			startRouteHandler([]string{}, 52525)
+			http.HandleFunc("/webhook-drain-timeout", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+			})
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.Reliable = true
+			slowHook(queue, "http://localhost:52525/webhook-drain-timeout")
+
+			err := worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err = worker.Stop(ctx)
+			Expect(err).To(Equal(context.DeadlineExceeded))
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+
+			processing, err := testClient.LLen(worker.ProcessingQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(processing).To(BeEquivalentTo(0))
+
+			time.Sleep(350 * time.Millisecond)
+			scheduled, err := testClient.ZCard(worker.ScheduledQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scheduled).To(BeEquivalentTo(0))
+		})
+
+		It("should not take hooks from queue once stopped", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			slowHook(queue, "http://localhost:52525/webhook-drain")
+
+			err := worker.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			worker.Start()
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+		})
+	})
+
+	Describe("Reliable dequeue", func() {
+		It("should claim hook into processing list", func() {
+			queue := uuid.NewV4().String()
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			err := pushHook(
+				testClient, queue, "POST",
+				"http://localhost:52525/webhook-reliable",
+				map[string]interface{}{
+					"qwe": 123,
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			raw, err := worker.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+
+			inFlight, err := testClient.LRange(worker.ProcessingQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inFlight).To(HaveLen(1))
+			Expect(inFlight[0]).To(Equal(raw))
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+		})
+
+		It("should remove hook from processing list once dispatched", func() {
+			queue := uuid.NewV4().String()
+			responses := startRouteHandler([]string{"/webhook-reliable"}, 52525)
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			err := pushHook(
+				testClient, queue, "POST",
+				"http://localhost:52525/webhook-reliable",
+				map[string]interface{}{
+					"qwe": 123,
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			Expect(*responses).To(HaveLen(1))
+			inFlight, err := testClient.LRange(worker.ProcessingQueue(), 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inFlight).To(BeEmpty())
+		})
+
+		It("should deliver hook claimed by a worker killed mid-dispatch", func() {
+			queue := uuid.NewV4().String()
+			responses := startRouteHandler([]string{"/webhook-reliable-killed"}, 52525)
+
+			killed := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			killed.Reliable = true
+			killed.VisibilityTimeout = 50 * time.Millisecond
+
+			err := killed.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = pushHook(
+				testClient, queue, "POST",
+				"http://localhost:52525/webhook-reliable-killed",
+				map[string]interface{}{
+					"qwe": 123,
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			//the hook is claimed, but the worker dies before dispatching it
+			_, err = killed.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+			worker.VisibilityTimeout = 50 * time.Millisecond
+			err = worker.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			reaped, err := worker.ReapExpired()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reaped).To(Equal(0))
+
+			time.Sleep(100 * time.Millisecond)
+			err = worker.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			reaped, err = worker.ReapExpired()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reaped).To(Equal(1))
+
+			inFlight, err := testClient.LLen(killed.ProcessingQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inFlight).To(BeEquivalentTo(0))
+
+			err = worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(50 * time.Millisecond)
+
+			Expect(*responses).To(HaveLen(1))
+			resp := (*responses)[0]["payload"].(map[string]interface{})
+			Expect(int(resp["qwe"].(float64))).To(Equal(123))
+		})
+
+		It("should release lease when stopped so its claimed hooks are reaped at once", func() {
+			queue := uuid.NewV4().String()
+			err := pushHook(
+				testClient, queue, "POST",
+				"http://localhost:52525/webhook-reliable-stopped",
+				map[string]interface{}{
+					"qwe": 123,
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			stopped := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			stopped.Reliable = true
+			stopped.VisibilityTimeout = time.Minute
+			err = stopped.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = stopped.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = stopped.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+			worker.VisibilityTimeout = time.Minute
+
+			reaped, err := worker.ReapExpired()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reaped).To(Equal(1))
+
+			total, err := testClient.LLen(queue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+		})
+
+		It("should not renew lease after releasing it when stopped", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+			worker.VisibilityTimeout = time.Minute
+			go worker.Start()
+
+			leaseKey := fmt.Sprintf("%s:lease:%s", queue, worker.ID)
+			Eventually(func() bool {
+				exists, err := testClient.Exists(leaseKey).Result()
+				Expect(err).NotTo(HaveOccurred())
+				return exists
+			}).Should(BeTrue())
+
+			//the lease renewal is waiting for its next turn, which Stop does not wait for
+			start := time.Now()
+			err := worker.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Now().Sub(start)).To(BeNumerically("<", time.Second))
+
+			time.Sleep(50 * time.Millisecond)
+			exists, err := testClient.Exists(leaseKey).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("should return claimed hook to the queue when it can not be handled", func() {
+			queue := uuid.NewV4().String()
+			worker := New(
+				queue,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			//scheduling the hook fails since its scheduled set is not a sorted set
+			_, err := testClient.Set(worker.ScheduledQueue(), "qwe", 0).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			hookJSON, _ := json.Marshal(map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-reliable-error",
+				"payload":  "{\"qwe\":123}",
+				"attempts": 1,
+				"backoff":  time.Now().Add(time.Hour).UnixNano(),
+			})
+			_, err = testClient.RPush(queue, string(hookJSON)).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = worker.ProcessSubscription()
+			Expect(err).To(HaveOccurred())
+
+			inFlight, err := testClient.LLen(worker.ProcessingQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inFlight).To(BeEquivalentTo(0))
+
+			hooks, err := testClient.LRange(queue, 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hooks).To(Equal([]string{string(hookJSON)}))
+		})
+	})
+
+	Describe("Tenants", func() {
+		var pushHook = func(key, payload string) {
+			hookJSON, _ := json.Marshal(map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-tenant",
+				"payload":  payload,
+				"attempts": 0,
+			})
+			_, err := testClient.RPush(key, string(hookJSON)).Result()
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var registerTenant = func(queueName, tenant string) {
+			_, err := testClient.SAdd(santiagoQueue.TenantsKey(queueName), tenant).Result()
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("should take turns between the queue and the queues of the tenants", func() {
+			queueName := uuid.NewV4().String()
+			registerTenant(queueName, "tenant-a")
+			for i := 0; i < 4; i++ {
+				pushHook(santiagoQueue.TenantQueue(queueName, "tenant-a"), "tenant-a")
+			}
+			for i := 0; i < 2; i++ {
+				pushHook(queueName, "none")
+			}
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			payloads := []string{}
+			for i := 0; i < 6; i++ {
+				raw, err := worker.Dequeue()
+				Expect(err).NotTo(HaveOccurred())
+				var hook map[string]interface{}
+				err = json.Unmarshal([]byte(raw), &hook)
+				Expect(err).NotTo(HaveOccurred())
+				payloads = append(payloads, hook["payload"].(string))
+			}
+			Expect(payloads).To(Equal([]string{"none", "tenant-a", "none", "tenant-a", "tenant-a", "tenant-a"}))
+
+			processing, err := testClient.LLen(worker.ProcessingQueue()).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(processing).To(BeEquivalentTo(6))
+
+			_, err = worker.Dequeue()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("redis: nil"))
+		})
+
+		It("should promote scheduled hooks to the queue of their tenant", func() {
+			queueName := uuid.NewV4().String()
+			registerTenant(queueName, "tenant-a")
+			clock := &mockClock{currentTime: 0}
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, clock,
+			)
+
+			for _, tenant := range []string{"tenant-a", "tenant-b", ""} {
+				err := worker.Handle(map[string]interface{}{
+					"attempts": 1,
+					"backoff":  1000,
+					"method":   "POST",
+					"payload":  "{\"qwe\": 123}",
+					"url":      "http://localhost:52525/webhook-tenant",
+					"tenant":   tenant,
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			clock.currentTime = 2000
+			promoted, err := worker.PromoteScheduled()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(promoted).To(Equal(3))
+
+			total, err := testClient.LLen(santiagoQueue.TenantQueue(queueName, "tenant-a")).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+
+			total, err = testClient.LLen(queueName).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(2))
+		})
+
+		It("should return reaped hooks to the queue of their tenant", func() {
+			queueName := uuid.NewV4().String()
+			registerTenant(queueName, "tenant-a")
+			tenantQueue := santiagoQueue.TenantQueue(queueName, "tenant-a")
+
+			killed := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			killed.Reliable = true
+			killed.VisibilityTimeout = 50 * time.Millisecond
+			err := killed.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			hookJSON, _ := json.Marshal(map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-tenant",
+				"payload":  "tenant-a",
+				"tenant":   "tenant-a",
+				"attempts": 0,
+			})
+			_, err = testClient.RPush(tenantQueue, string(hookJSON)).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			//the hook is claimed, but the worker dies before dispatching it
+			_, err = killed.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+			worker.VisibilityTimeout = 50 * time.Millisecond
+
+			time.Sleep(100 * time.Millisecond)
+			err = worker.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			reaped, err := worker.ReapExpired()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reaped).To(Equal(1))
+
+			hooks, err := testClient.LRange(tenantQueue, 0, -1).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hooks).To(Equal([]string{string(hookJSON)}))
+
+			total, err := testClient.LLen(queueName).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+		})
+	})
+
+	Describe("Priorities", func() {
+		var pushHooks = func(key, priority string, count int) {
+			for i := 0; i < count; i++ {
+				hookJSON, _ := json.Marshal(map[string]interface{}{
+					"method":   "POST",
+					"url":      "http://localhost:52525/webhook-priority",
+					"payload":  priority,
+					"priority": priority,
+					"attempts": 0,
+				})
+				_, err := testClient.RPush(key, string(hookJSON)).Result()
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+
+		It("should prefer higher priorities without starving lower ones", func() {
+			queueName := uuid.NewV4().String()
+			for _, priority := range santiagoQueue.Priorities {
+				pushHooks(santiagoQueue.PriorityQueue(queueName, priority), priority, 10)
+			}
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+
+			counts := map[string]int{}
+			for i := 0; i < 7; i++ {
+				raw, err := worker.Dequeue()
+				Expect(err).NotTo(HaveOccurred())
+				var hook map[string]interface{}
+				err = json.Unmarshal([]byte(raw), &hook)
+				Expect(err).NotTo(HaveOccurred())
+				counts[hook["payload"].(string)]++
+			}
+			Expect(counts).To(Equal(map[string]int{"high": 4, "normal": 2, "low": 1}))
+		})
+
+		It("should take hooks of lower priorities while higher ones are empty", func() {
+			queueName := uuid.NewV4().String()
+			pushHooks(santiagoQueue.PriorityQueue(queueName, santiagoQueue.PriorityLow), "low", 3)
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			raws, err := worker.DequeueBatch(5)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(raws).To(HaveLen(3))
+		})
+
+		It("should promote scheduled hooks to the queue of their priority", func() {
+			queueName := uuid.NewV4().String()
+			clock := &mockClock{currentTime: 0}
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, clock,
+			)
+
+			for _, priority := range []string{"high", "low", ""} {
+				err := worker.Handle(map[string]interface{}{
+					"attempts": 1,
+					"backoff":  1000,
+					"method":   "POST",
+					"payload":  "{\"qwe\": 123}",
+					"url":      "http://localhost:52525/webhook-priority",
+					"priority": priority,
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			clock.currentTime = 2000
+			promoted, err := worker.PromoteScheduled()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(promoted).To(Equal(3))
+
+			for _, priority := range santiagoQueue.Priorities {
+				total, err := testClient.LLen(santiagoQueue.PriorityQueue(queueName, priority)).Result()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(total).To(BeEquivalentTo(1), priority)
+			}
+		})
+
+		It("should return reaped hooks to the queue of their priority", func() {
+			queueName := uuid.NewV4().String()
+			highQueue := santiagoQueue.PriorityQueue(queueName, santiagoQueue.PriorityHigh)
+			pushHooks(highQueue, santiagoQueue.PriorityHigh, 1)
+
+			killed := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			killed.Reliable = true
+			killed.VisibilityTimeout = 50 * time.Millisecond
+			err := killed.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = killed.Dequeue()
+			Expect(err).NotTo(HaveOccurred())
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, 10*time.Millisecond,
+				"", 10, &RealClock{},
+			)
+			worker.Reliable = true
+			worker.VisibilityTimeout = 50 * time.Millisecond
+
+			time.Sleep(100 * time.Millisecond)
+			err = worker.Heartbeat()
+			Expect(err).NotTo(HaveOccurred())
+
+			reaped, err := worker.ReapExpired()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reaped).To(Equal(1))
+
+			total, err := testClient.LLen(highQueue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+
+			total, err = testClient.LLen(queueName).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+		})
+
+		It("should return unfinished hooks to the queue of their priority when drain times out", func() {
+			queueName := uuid.NewV4().String()
+			startRouteHandler([]string{}, 52525)
+			http.HandleFunc("/webhook-drain-priority", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(300 * time.Millisecond)
+			})
+
+			lowQueue := santiagoQueue.PriorityQueue(queueName, santiagoQueue.PriorityLow)
+			hookJSON, _ := json.Marshal(map[string]interface{}{
+				"method":   "POST",
+				"url":      "http://localhost:52525/webhook-drain-priority",
+				"payload":  "{\"qwe\":123}",
+				"priority": santiagoQueue.PriorityLow,
+				"attempts": 0,
+			})
+			_, err := testClient.RPush(lowQueue, string(hookJSON)).Result()
+			Expect(err).NotTo(HaveOccurred())
+
+			worker := New(
+				queueName,
+				"127.0.0.1", 57575, "", 0,
+				10, logger, true, time.Millisecond, "", 10, &RealClock{},
+			)
+			worker.Reliable = true
+
+			err = worker.ProcessSubscription()
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err = worker.Stop(ctx)
+			Expect(err).To(Equal(context.DeadlineExceeded))
+
+			total, err := testClient.LLen(lowQueue).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(1))
+
+			total, err = testClient.LLen(queueName).Result()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(BeEquivalentTo(0))
+		})
 	})
 })
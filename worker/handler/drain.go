@@ -0,0 +1,186 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+	"gopkg.in/redis.v4"
+
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+//returnScript returns the messages in ARGV[2..] in order to the head of the queue of their priority, in the queue of their tenant
+//if it has its own queue (see queue.RouteFunction), removing them from the processing list in KEYS[2] if ARGV[1] is 1
+//and signaling the ready list in KEYS[3]
+var returnScript = redis.NewScript(queue.RouteFunction + queue.SignalFunction + `
+route_keys(4)
+for i = #ARGV, 2, -1 do
+	if ARGV[1] == "1" then
+		redis.call("LREM", KEYS[2], 1, ARGV[i])
+	end
+	redis.call("LPUSH", route(KEYS[1], ARGV[i]), ARGV[i])
+end
+signal(KEYS[3])
+return #ARGV - 1
+`)
+
+//stopping returns whether Stop was called, so no more hooks should be taken from the queue
+func (w *Worker) stopping() bool {
+	return atomic.LoadInt32(&w.stopped) == 1
+}
+
+//startDispatch registers a hook about to be sent, so it can be returned to the queue if the worker is stopped before it finishes
+func (w *Worker) startDispatch(msg map[string]interface{}, raw string) string {
+	if raw == "" {
+		msgJSON, _ := json.Marshal(msg)
+		raw = string(msgJSON)
+	}
+
+	token := uuid.NewV4().String()
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	if w.inFlight == nil {
+		w.inFlight = map[string]string{}
+	}
+	w.inFlight[token] = raw
+	w.dispatches.Add(1)
+	return token
+}
+
+//finishDispatch unregisters a sent hook. It returns false if the hook was already returned to the queue by Stop,
+//in which case its result must be discarded
+func (w *Worker) finishDispatch(token string) bool {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	if _, ok := w.inFlight[token]; !ok {
+		return false
+	}
+	delete(w.inFlight, token)
+	return true
+}
+
+//InFlight returns the number of hooks being sent by this worker
+func (w *Worker) InFlight() int {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	return len(w.inFlight)
+}
+
+//returnToQueue returns the given messages to the head of the queue of their priority and tenant
+func (w *Worker) returnToQueue(raws []string) (int, error) {
+	if len(raws) == 0 {
+		return 0, nil
+	}
+
+	routes, err := queue.RouteKeys(w.Client, w.Queue)
+	if err != nil {
+		return 0, err
+	}
+	args := []interface{}{w.reliableArg()}
+	for _, raw := range raws {
+		args = append(args, raw)
+	}
+
+	_, err = returnScript.Run(w.Client, append([]string{w.Queue, w.ProcessingQueue(), queue.ReadyKey(w.Queue)}, routes...), args...).Result()
+	if err != nil {
+		return 0, err
+	}
+	return len(raws), nil
+}
+
+//giveBack returns a claimed message that could not be handled due to an error to the head of its queue,
+//so it is not left in the processing list while this worker keeps renewing its lease
+func (w *Worker) giveBack(raw string) {
+	if !w.Reliable || raw == "" {
+		return
+	}
+	_, err := w.returnToQueue([]string{raw})
+	if err != nil {
+		w.Logger.Error(
+			"Failed to return hook to the queue.",
+			zap.String("operation", "giveBack"),
+			zap.String("queue", w.Queue),
+			zap.Error(err),
+		)
+	}
+}
+
+//returnInFlight returns all unfinished hooks to the head of the queue
+func (w *Worker) returnInFlight() (int, error) {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+
+	raws := []string{}
+	for _, raw := range w.inFlight {
+		raws = append(raws, raw)
+	}
+	count, err := w.returnToQueue(raws)
+	if err != nil {
+		return 0, err
+	}
+	w.inFlight = map[string]string{}
+	return count, nil
+}
+
+//Stop makes the worker stop taking hooks from the queue and waits for the in-flight ones to finish, releasing its lease.
+//If ctx is done first, the unfinished hooks are returned to the head of the queue so other workers send them
+//and ctx error is returned
+func (w *Worker) Stop(ctx context.Context) error {
+	l := w.Logger.With(
+		zap.String("operation", "Stop"),
+		zap.String("queue", w.Queue),
+		zap.String("workerID", w.ID),
+	)
+
+	atomic.StoreInt32(&w.stopped, 1)
+	l.Info("Draining worker...", zap.Int("inFlight", w.InFlight()))
+
+	drained := make(chan struct{})
+	go func() {
+		w.running.Wait()
+		w.dispatches.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		l.Info("Worker drained successfully.")
+		return w.releaseLease(l)
+	case <-ctx.Done():
+	}
+
+	count, err := w.returnInFlight()
+	if err != nil {
+		l.Error("Failed to return unfinished hooks to the queue.", zap.Error(err))
+		return err
+	}
+	l.Warn("Worker drain timed out. Unfinished hooks returned to the queue.", zap.Int("hooks", count))
+	err = w.releaseLease(l)
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+//releaseLease stops renewing the lease of this worker and deletes it once it is stopped, so other workers reap its
+//processing list at once
+func (w *Worker) releaseLease(l zap.Logger) error {
+	if !w.Reliable {
+		return nil
+	}
+	w.stopKeepAlive()
+	err := w.Client.Del(w.leaseKey(w.ID)).Err()
+	if err != nil {
+		l.Error("Failed to release worker lease.", zap.Error(err))
+	}
+	return err
+}
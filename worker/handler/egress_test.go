@@ -0,0 +1,172 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	"github.com/satori/go.uuid"
+	santiagoQueue "github.com/topfreegames/santiago/queue"
+	"github.com/topfreegames/santiago/testing"
+	. "github.com/topfreegames/santiago/worker/handler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testProxy struct {
+	*httptest.Server
+	lock           sync.Mutex
+	targets        []string
+	authorizations []string
+}
+
+//newTestProxy starts an HTTP CONNECT proxy that records the addresses it tunnels to
+func newTestProxy() *testProxy {
+	proxy := &testProxy{}
+	proxy.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		proxy.lock.Lock()
+		proxy.targets = append(proxy.targets, r.Host)
+		proxy.authorizations = append(proxy.authorizations, r.Header.Get("Proxy-Authorization"))
+		proxy.lock.Unlock()
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(target, conn)
+			target.Close()
+		}()
+		go func() {
+			io.Copy(conn, target)
+			conn.Close()
+		}()
+	}))
+	return proxy
+}
+
+var _ = Describe("Egress", func() {
+	var logger *testing.MockLogger
+	var testClient *redis.Client
+	var worker *Worker
+	var receiver *httptest.Server
+
+	var newPolicy = func(config *santiagoQueue.EgressConfig) *santiagoQueue.EgressPolicy {
+		policy, err := santiagoQueue.NewEgressPolicy(config)
+		Expect(err).NotTo(HaveOccurred())
+		return policy
+	}
+
+	BeforeEach(func() {
+		logger = testing.NewMockLogger()
+		cli, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = cli
+		worker = New(
+			uuid.NewV4().String(),
+			"127.0.0.1", 57575, "", 0,
+			10, logger, true, time.Millisecond, "", 10, &RealClock{},
+		)
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	})
+
+	AfterEach(func() {
+		receiver.Close()
+	})
+
+	It("should deny hosts that resolve to denied addresses", func() {
+		worker.ClientOptions.Egress = newPolicy(&santiagoQueue.EgressConfig{DenyPrivateNetworks: true})
+		url := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+
+		_, err := worker.DoRequest("POST", url, "{}", map[string]string{}, 0)
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(*santiagoQueue.EgressError)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should send hooks to allowed addresses", func() {
+		worker.ClientOptions.Egress = newPolicy(&santiagoQueue.EgressConfig{
+			DenyPrivateNetworks: true,
+			Allow:               []string{"127.0.0.1"},
+		})
+		url := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+
+		resp, err := worker.DoRequest("POST", url, "{}", map[string]string{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should move hooks to denied destinations to the dead letter queue without retrying", func() {
+		worker.ClientOptions.Egress = newPolicy(&santiagoQueue.EgressConfig{DenyPrivateNetworks: true})
+
+		for _, url := range []string{receiver.URL, strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)} {
+			err := worker.Handle(map[string]interface{}{
+				"method":   "POST",
+				"url":      url,
+				"payload":  "{}",
+				"attempts": 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		total, err := testClient.ZCard(worker.ScheduledQueue()).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(BeEquivalentTo(0))
+
+		count, err := santiagoQueue.NewDeadLetterQueue(testClient, worker.Queue).Count()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(BeEquivalentTo(2))
+	})
+
+	It("should tunnel requests through proxy", func() {
+		proxy := newTestProxy()
+		defer proxy.Close()
+
+		proxyURL, err := ParseProxy(strings.Replace(proxy.URL, "http://", "http://user:secret@", 1))
+		Expect(err).NotTo(HaveOccurred())
+		worker.ClientOptions.Proxy = proxyURL
+
+		resp, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		proxy.lock.Lock()
+		defer proxy.lock.Unlock()
+		Expect(proxy.targets).To(Equal([]string{strings.TrimPrefix(receiver.URL, "http://")}))
+		Expect(proxy.authorizations).To(Equal([]string{"Basic dXNlcjpzZWNyZXQ="}))
+	})
+
+	It("should fail to parse invalid proxies", func() {
+		_, err := ParseProxy("socks5://localhost:1080")
+		Expect(err).To(HaveOccurred())
+
+		proxyURL, err := ParseProxy("http://proxy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxyURL.Host).To(Equal("proxy:80"))
+	})
+})
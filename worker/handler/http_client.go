@@ -0,0 +1,82 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/topfreegames/santiago/queue"
+	"github.com/valyala/fasthttp"
+)
+
+//ClientOptions tunes the HTTP client shared by all requests of a worker.
+//Timeout is the total time allowed for requests of hooks that do not set their own timeout,
+//while ConnectTimeout, ReadTimeout and WriteTimeout bound each step of the request (zero means no bound other than Timeout).
+//Egress restricts the destinations requests may be sent to and Proxy, if set, tunnels them through an HTTP CONNECT proxy
+type ClientOptions struct {
+	Timeout             time.Duration
+	ConnectTimeout      time.Duration
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	MaxConnsPerHost     int
+	MaxIdleConnDuration time.Duration
+	Egress              *queue.EgressPolicy
+	Proxy               *url.URL
+}
+
+//DefaultClientOptions returns the options of the HTTP client used by workers by default
+func DefaultClientOptions() *ClientOptions {
+	return &ClientOptions{
+		Timeout:             DefaultTimeout,
+		ConnectTimeout:      3 * time.Second,
+		MaxConnsPerHost:     fasthttp.DefaultMaxConnsPerHost,
+		MaxIdleConnDuration: fasthttp.DefaultMaxIdleConnDuration,
+	}
+}
+
+//NewHTTPClient returns a HTTP client with the given options, that keeps connections to each host open to be reused
+func NewHTTPClient(options *ClientOptions) *fasthttp.Client {
+	if options == nil {
+		options = DefaultClientOptions()
+	}
+
+	client := &fasthttp.Client{
+		Name:                "santiago",
+		ReadTimeout:         options.ReadTimeout,
+		WriteTimeout:        options.WriteTimeout,
+		MaxConnsPerHost:     options.MaxConnsPerHost,
+		MaxIdleConnDuration: options.MaxIdleConnDuration,
+	}
+	if options.ConnectTimeout > 0 || options.Egress != nil || options.Proxy != nil {
+		d := &dialer{
+			connectTimeout: options.ConnectTimeout,
+			egress:         options.Egress,
+			proxy:          options.Proxy,
+		}
+		client.Dial = d.Dial
+	}
+	return client
+}
+
+func (w *Worker) getHTTPClient() *fasthttp.Client {
+	w.clientOnce.Do(func() {
+		w.client = NewHTTPClient(w.ClientOptions)
+	})
+	return w.client
+}
+
+//requestTimeout returns the total time allowed for a request with the given hook timeout
+func (w *Worker) requestTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	if w.ClientOptions != nil && w.ClientOptions.Timeout > 0 {
+		return w.ClientOptions.Timeout
+	}
+	return DefaultTimeout
+}
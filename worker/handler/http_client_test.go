@@ -0,0 +1,94 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/testing"
+	. "github.com/topfreegames/santiago/worker/handler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP client", func() {
+	var logger *testing.MockLogger
+	var worker *Worker
+
+	BeforeEach(func() {
+		logger = testing.NewMockLogger()
+		worker = New(
+			uuid.NewV4().String(),
+			"127.0.0.1", 57575, "", 0,
+			10, logger, true, time.Millisecond, "", 10, &RealClock{},
+		)
+	})
+
+	It("should create client with options", func() {
+		client := NewHTTPClient(&ClientOptions{
+			ReadTimeout:         time.Second,
+			WriteTimeout:        2 * time.Second,
+			ConnectTimeout:      time.Second,
+			MaxConnsPerHost:     10,
+			MaxIdleConnDuration: time.Minute,
+		})
+		Expect(client.Name).To(Equal("santiago"))
+		Expect(client.ReadTimeout).To(Equal(time.Second))
+		Expect(client.WriteTimeout).To(Equal(2 * time.Second))
+		Expect(client.MaxConnsPerHost).To(Equal(10))
+		Expect(client.MaxIdleConnDuration).To(Equal(time.Minute))
+		Expect(client.Dial).NotTo(BeNil())
+	})
+
+	It("should reuse connections between requests", func() {
+		var lock sync.Mutex
+		remotes := map[string]bool{}
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			remotes[r.RemoteAddr] = true
+		}))
+		defer receiver.Close()
+
+		for i := 0; i < 3; i++ {
+			resp, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		}
+		Expect(remotes).To(HaveLen(1))
+	})
+
+	It("should time out requests after the worker timeout", func() {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer receiver.Close()
+		worker.ClientOptions.Timeout = 50 * time.Millisecond
+
+		start := time.Now()
+		_, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).To(HaveOccurred())
+		Expect(time.Now().Sub(start)).To(BeNumerically("<", 150*time.Millisecond))
+	})
+
+	It("should honor hook timeout over the worker timeout", func() {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer receiver.Close()
+		worker.ClientOptions.Timeout = 50 * time.Millisecond
+
+		resp, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 500*time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+})
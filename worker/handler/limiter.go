@@ -0,0 +1,225 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/log"
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+//limitLeaseMargin is added to the request timeout to get how long a concurrency lease is held if it is not released
+const limitLeaseMargin = 30 * time.Second
+
+//limitScript atomically checks the concurrency and rate limits of a destination and, if both allow it,
+//takes a concurrency lease and a token. It returns 0 if allowed, -1 if over the concurrency limit or
+//the time in ms until a token is available if over the rate limit
+var limitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local maxConcurrency = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local burst = tonumber(ARGV[4])
+
+if maxConcurrency > 0 then
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+	if redis.call("ZCARD", KEYS[1]) >= maxConcurrency then
+		return -1
+	end
+end
+
+if rate > 0 then
+	local bucket = redis.call("HMGET", KEYS[2], "tokens", "ts")
+	local tokens = tonumber(bucket[1]) or burst
+	local ts = tonumber(bucket[2]) or now
+	tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+	if tokens < 1 then
+		return math.ceil((1 - tokens) * 1000 / rate)
+	end
+	redis.call("HMSET", KEYS[2], "tokens", tokens - 1, "ts", now)
+	redis.call("PEXPIRE", KEYS[2], math.ceil(burst * 1000 / rate) + 1000)
+end
+
+if maxConcurrency > 0 then
+	redis.call("ZADD", KEYS[1], ARGV[6], ARGV[5])
+	if redis.call("PTTL", KEYS[1]) < ARGV[6] - now then
+		redis.call("PEXPIRE", KEYS[1], ARGV[6] - now)
+	end
+end
+return 0
+`)
+
+//LimitRule caps the concurrent requests and the request rate to the destinations matching its host or URL prefix
+type LimitRule struct {
+	Host           string  `mapstructure:"host"`
+	Prefix         string  `mapstructure:"prefix"`
+	MaxConcurrency int     `mapstructure:"maxConcurrency"`
+	Rate           float64 `mapstructure:"rate"`
+	Burst          int     `mapstructure:"burst"`
+}
+
+//Name returns the host or prefix that identifies the rule
+func (r *LimitRule) Name() string {
+	if r.Prefix != "" {
+		return r.Prefix
+	}
+	return r.Host
+}
+
+//Matches returns whether the rule applies to the given URL
+func (r *LimitRule) Matches(url string) bool {
+	if r.Host == "" && r.Prefix == "" {
+		return false
+	}
+	return queue.MatchURL(url, r.Host, r.Prefix)
+}
+
+//GetBurst returns the number of requests allowed at once by the rate limit, defaulting to one second worth of requests
+func (r *LimitRule) GetBurst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return int(math.Max(1, math.Ceil(r.Rate)))
+}
+
+//LimitLease is a request allowed by a limit rule, that must be released once it finishes
+type LimitLease struct {
+	Rule  *LimitRule
+	Token string
+}
+
+//Limiter enforces limit rules across all workers of a queue using Redis
+type Limiter struct {
+	Client           redis.Cmdable
+	Queue            string
+	Rules            []*LimitRule
+	ConcurrencyDelay time.Duration
+}
+
+//NewLimiter returns a limiter for the given rules. The first rule matching a URL applies to it
+func NewLimiter(client redis.Cmdable, queue string, rules []*LimitRule) *Limiter {
+	return &Limiter{
+		Client:           client,
+		Queue:            queue,
+		Rules:            rules,
+		ConcurrencyDelay: time.Second,
+	}
+}
+
+func (l *Limiter) concurrencyKey(rule *LimitRule) string {
+	return fmt.Sprintf("%s:limits:%s:concurrency", l.Queue, rule.Name())
+}
+
+func (l *Limiter) bucketKey(rule *LimitRule) string {
+	return fmt.Sprintf("%s:limits:%s:bucket", l.Queue, rule.Name())
+}
+
+//RuleFor returns the rule that applies to the given URL or nil if none does
+func (l *Limiter) RuleFor(url string) *LimitRule {
+	for _, rule := range l.Rules {
+		if rule.Matches(url) {
+			return rule
+		}
+	}
+	return nil
+}
+
+//Acquire checks whether a request to the given URL is allowed now. If it is not, it returns for how long it should be deferred:
+//until a token is available when over the rate limit or ConcurrencyDelay when over the concurrency limit.
+//Concurrency leases expire after the given duration, so requests of crashed workers do not hold them forever
+func (l *Limiter) Acquire(url string, leaseDuration time.Duration) (*LimitLease, time.Duration, error) {
+	rule := l.RuleFor(url)
+	if rule == nil {
+		return nil, 0, nil
+	}
+
+	lease := &LimitLease{
+		Rule:  rule,
+		Token: uuid.NewV4().String(),
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	res, err := limitScript.Run(
+		l.Client,
+		[]string{l.concurrencyKey(rule), l.bucketKey(rule)},
+		now, rule.MaxConcurrency, rule.Rate, rule.GetBurst(),
+		lease.Token, now+int64(leaseDuration/time.Millisecond),
+	).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	wait := res.(int64)
+	if wait == 0 {
+		return lease, 0, nil
+	}
+	if wait < 0 {
+		return nil, l.ConcurrencyDelay, nil
+	}
+	return nil, time.Duration(wait) * time.Millisecond, nil
+}
+
+//Release frees the concurrency lease taken by Acquire
+func (l *Limiter) Release(lease *LimitLease) error {
+	if lease == nil || lease.Rule.MaxConcurrency <= 0 {
+		return nil
+	}
+	_, err := l.Client.ZRem(l.concurrencyKey(lease.Rule), lease.Token).Result()
+	return err
+}
+
+//acquireLimit checks the limits of the hook destination, sending the hook back to the scheduled set
+//without counting an attempt if it must be deferred
+func (w *Worker) acquireLimit(msg map[string]interface{}, url string, timeout time.Duration, raw string) (*LimitLease, bool, error) {
+	if w.Limiter == nil {
+		return nil, false, nil
+	}
+	lease, wait, err := w.Limiter.Acquire(url, w.requestTimeout(timeout)+limitLeaseMargin)
+	if err != nil {
+		return nil, false, err
+	}
+	if wait == 0 {
+		return lease, false, nil
+	}
+
+	err = w.scheduleMessage(msg, w.Clock.Now()+int64(wait))
+	if err != nil {
+		return nil, false, err
+	}
+	w.ack(raw)
+
+	log.D(w.Logger, "Hook deferred due to destination limits.", func(cm log.CM) {
+		cm.Write(
+			zap.String("operation", "acquireLimit"),
+			zap.String("queue", w.Queue),
+			zap.String("url", url),
+			zap.String("limit", w.Limiter.RuleFor(url).Name()),
+			zap.Duration("deferredFor", wait),
+		)
+	})
+	return nil, true, nil
+}
+
+func (w *Worker) releaseLimit(lease *LimitLease) {
+	if w.Limiter == nil {
+		return
+	}
+	err := w.Limiter.Release(lease)
+	if err != nil {
+		w.Logger.Error(
+			"Failed to release destination concurrency lease.",
+			zap.String("operation", "releaseLimit"),
+			zap.String("queue", w.Queue),
+			zap.Error(err),
+		)
+	}
+}
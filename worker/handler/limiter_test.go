@@ -0,0 +1,114 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker_test
+
+import (
+	"time"
+
+	"gopkg.in/redis.v4"
+
+	"github.com/satori/go.uuid"
+	. "github.com/topfreegames/santiago/worker/handler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	var testClient *redis.Client
+
+	BeforeEach(func() {
+		client, err := getTestRedisConn()
+		Expect(err).NotTo(HaveOccurred())
+		testClient = client
+	})
+
+	It("should match rules by host or prefix", func() {
+		limiter := NewLimiter(testClient, uuid.NewV4().String(), []*LimitRule{
+			{Prefix: "http://partner.com/slow", MaxConcurrency: 1},
+			{Host: "partner.com", MaxConcurrency: 10},
+		})
+
+		Expect(limiter.RuleFor("http://partner.com/slow/hook").Name()).To(Equal("http://partner.com/slow"))
+		Expect(limiter.RuleFor("http://partner.com:8080/hook").Name()).To(Equal("partner.com"))
+		Expect(limiter.RuleFor("http://other.com/hook")).To(BeNil())
+	})
+
+	It("should allow requests without matching rule", func() {
+		limiter := NewLimiter(testClient, uuid.NewV4().String(), []*LimitRule{})
+
+		lease, wait, err := limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+		Expect(lease).To(BeNil())
+	})
+
+	It("should cap concurrent requests until a lease is released", func() {
+		limiter := NewLimiter(testClient, uuid.NewV4().String(), []*LimitRule{
+			{Host: "partner.com", MaxConcurrency: 2},
+		})
+
+		first, wait, err := limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+		Expect(first).NotTo(BeNil())
+
+		_, wait, err = limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+
+		_, wait, err = limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(Equal(limiter.ConcurrencyDelay))
+
+		err = limiter.Release(first)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, wait, err = limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+	})
+
+	It("should expire leases of requests never released", func() {
+		limiter := NewLimiter(testClient, uuid.NewV4().String(), []*LimitRule{
+			{Host: "partner.com", MaxConcurrency: 1},
+		})
+
+		_, wait, err := limiter.Acquire("http://partner.com/hook", 20*time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+
+		time.Sleep(30 * time.Millisecond)
+
+		_, wait, err = limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+	})
+
+	It("should rate limit requests with token bucket", func() {
+		limiter := NewLimiter(testClient, uuid.NewV4().String(), []*LimitRule{
+			{Host: "partner.com", Rate: 10, Burst: 2},
+		})
+
+		for i := 0; i < 2; i++ {
+			_, wait, err := limiter.Acquire("http://partner.com/hook", time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(wait).To(BeZero())
+		}
+
+		_, wait, err := limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeNumerically(">", 0))
+		Expect(wait).To(BeNumerically("<=", 100*time.Millisecond))
+
+		time.Sleep(wait)
+
+		_, wait, err = limiter.Acquire("http://partner.com/hook", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+	})
+})
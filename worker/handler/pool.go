@@ -0,0 +1,136 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/topfreegames/santiago/log"
+	"github.com/uber-go/zap"
+)
+
+//Pool bounds the number of hooks a worker dispatches at the same time
+type Pool struct {
+	Size           int
+	slots          chan struct{}
+	InFlight       metrics.Gauge
+	Saturations    metrics.Counter
+	SaturationWait metrics.Timer
+}
+
+//NewPool returns a pool that allows up to size concurrent requests, reporting its metrics to the default registry
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		Size:           size,
+		slots:          make(chan struct{}, size),
+		InFlight:       metrics.GetOrRegisterGauge("worker.pool.inFlight", metrics.DefaultRegistry),
+		Saturations:    metrics.GetOrRegisterCounter("worker.pool.saturations", metrics.DefaultRegistry),
+		SaturationWait: metrics.GetOrRegisterTimer("worker.pool.saturationWait", metrics.DefaultRegistry),
+	}
+}
+
+//Acquire takes a slot in the pool, blocking while it is full. It returns how long it waited for the slot
+func (p *Pool) Acquire() time.Duration {
+	select {
+	case p.slots <- struct{}{}:
+		p.InFlight.Update(int64(len(p.slots)))
+		return 0
+	default:
+	}
+
+	p.Saturations.Inc(1)
+	start := time.Now()
+	p.slots <- struct{}{}
+	waited := time.Now().Sub(start)
+	p.SaturationWait.Update(waited)
+	p.InFlight.Update(int64(len(p.slots)))
+	return waited
+}
+
+//Release frees a slot taken with Acquire
+func (p *Pool) Release() {
+	<-p.slots
+	p.InFlight.Update(int64(len(p.slots)))
+}
+
+//Len returns the number of requests in flight
+func (p *Pool) Len() int {
+	return len(p.slots)
+}
+
+//Full returns whether all slots of the pool are taken
+func (p *Pool) Full() bool {
+	return len(p.slots) >= p.Size
+}
+
+func (w *Worker) getPool() *Pool {
+	w.poolOnce.Do(func() {
+		w.pool = NewPool(w.PoolSize)
+	})
+	return w.pool
+}
+
+//acquireSlot takes a slot in the dispatcher pool, reporting when the pool is saturated
+func (w *Worker) acquireSlot() {
+	pool := w.getPool()
+	if pool.Full() {
+		w.Logger.Warn(
+			"Dispatcher pool is saturated, waiting for in-flight requests to finish.",
+			zap.String("operation", "acquireSlot"),
+			zap.String("queue", w.Queue),
+			zap.Int("poolSize", pool.Size),
+		)
+	}
+
+	waited := pool.Acquire()
+	if waited > 0 {
+		log.I(w.Logger, "Dispatcher pool slot acquired after saturation.", func(cm log.CM) {
+			cm.Write(
+				zap.String("operation", "acquireSlot"),
+				zap.String("queue", w.Queue),
+				zap.Duration("saturationWait", waited),
+			)
+		})
+	}
+}
+
+func (w *Worker) releaseSlot() {
+	w.getPool().Release()
+}
+
+//LogStatus logs the metrics of the dispatcher pool
+func (w *Worker) LogStatus() {
+	pool := w.getPool()
+	w.Logger.Info(
+		"Worker status.",
+		zap.String("operation", "status"),
+		zap.String("queue", w.Queue),
+		zap.Int("poolSize", pool.Size),
+		zap.Int64("poolInFlight", pool.InFlight.Value()),
+		zap.Int64("poolSaturations", pool.Saturations.Count()),
+		zap.Duration("poolSaturationWaitMean", time.Duration(pool.SaturationWait.Mean())),
+		zap.Duration("poolSaturationWaitP99", time.Duration(pool.SaturationWait.Percentile(0.99))),
+	)
+}
+
+//reportStatus logs the status of the worker every StatusInterval until it stops
+func (w *Worker) reportStatus() {
+	for !w.stopping() {
+		time.Sleep(w.StatusInterval)
+		w.LogStatus()
+	}
+}
+
+//waitForSlot blocks until the dispatcher pool has room for another request, so no hooks are popped while it is full
+func (w *Worker) waitForSlot() {
+	w.acquireSlot()
+	w.releaseSlot()
+}
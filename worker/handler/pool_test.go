@@ -0,0 +1,73 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker_test
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/testing"
+	. "github.com/topfreegames/santiago/worker/handler"
+	"github.com/uber-go/zap"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pool", func() {
+	It("should acquire slots without waiting while not full", func() {
+		pool := NewPool(2)
+
+		Expect(pool.Acquire()).To(BeZero())
+		Expect(pool.Acquire()).To(BeZero())
+		Expect(pool.Len()).To(Equal(2))
+		Expect(pool.Full()).To(BeTrue())
+	})
+
+	It("should block while full until a slot is released", func() {
+		pool := NewPool(1)
+		saturations := pool.Saturations.Count()
+		pool.Acquire()
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			pool.Release()
+		}()
+
+		waited := pool.Acquire()
+		Expect(waited).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(pool.Saturations.Count()).To(Equal(saturations + 1))
+		Expect(pool.Len()).To(Equal(1))
+	})
+
+	It("should log the pool metrics in the worker status", func() {
+		logger := testing.NewMockLogger()
+		queue := uuid.NewV4().String()
+		worker := New(
+			queue,
+			"127.0.0.1", 57575, "", 0,
+			10, logger, true, time.Millisecond,
+			"", 10, &RealClock{},
+		)
+		worker.PoolSize = 3
+
+		worker.LogStatus()
+
+		Expect(logger).To(testing.HaveLogMessage(
+			zap.InfoLevel, "Worker status.",
+			"queue", queue,
+			"poolSize", 3,
+		))
+		kv := testing.NewMockKV()
+		for _, field := range logger.Messages[len(logger.Messages)-1]["fields"].([]zap.Field) {
+			field.AddTo(kv)
+		}
+		Expect(kv.Values).To(HaveKey("poolInFlight"))
+		Expect(kv.Values).To(HaveKey("poolSaturations"))
+		Expect(kv.Values).To(HaveKey("poolSaturationWaitP99"))
+	})
+})
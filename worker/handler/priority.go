@@ -0,0 +1,58 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import "github.com/topfreegames/santiago/queue"
+
+//DefaultPriorityWeights returns how many turns each priority gets by default: high priority hooks are taken
+//four times as often as low priority ones while there are hooks of both
+func DefaultPriorityWeights() map[string]int {
+	return map[string]int{
+		queue.PriorityHigh:   4,
+		queue.PriorityNormal: 2,
+		queue.PriorityLow:    1,
+	}
+}
+
+//priorityWeight returns how many turns the priority gets for each turn of a priority with weight 1
+func (w *Worker) priorityWeight(priority string) int {
+	if weight := w.PriorityWeights[priority]; weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+//priorityOrder returns the priorities in the order their queues should be popped from. The first priority is picked
+//by smooth weighted round robin, so low priority hooks are never starved, and the others follow from highest to lowest
+func (w *Worker) priorityOrder() []string {
+	var picked []string
+	picked, w.priorityTurns = pickWeighted(queue.Priorities, w.priorityWeight, w.priorityTurns)
+
+	ordered := []string{picked[0]}
+	for _, priority := range queue.Priorities {
+		if priority != picked[0] {
+			ordered = append(ordered, priority)
+		}
+	}
+	return ordered
+}
+
+//queues returns the queues of every priority of Queue and of the tenants in the order they should be popped from:
+//priorities first and then tenants, each taking turns by their weights
+func (w *Worker) queues() []string {
+	w.queuesMu.Lock()
+	defer w.queuesMu.Unlock()
+
+	tenantQueues := w.tenantOrder()
+	queues := make([]string, 0, len(queue.Priorities)*len(tenantQueues))
+	for _, priority := range w.priorityOrder() {
+		for _, tenantQueue := range tenantQueues {
+			queues = append(queues, queue.PriorityQueue(tenantQueue, priority))
+		}
+	}
+	return queues
+}
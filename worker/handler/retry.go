@@ -0,0 +1,83 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+//RetryRule sets the retry policy of the destinations matching its host or URL prefix
+type RetryRule struct {
+	Host              string `mapstructure:"host"`
+	Prefix            string `mapstructure:"prefix"`
+	queue.RetryConfig `mapstructure:",squash"`
+	Policy            queue.RetryPolicy `mapstructure:"-"`
+}
+
+//Matches returns whether the rule applies to the given URL
+func (r *RetryRule) Matches(url string) bool {
+	if r.Host == "" && r.Prefix == "" {
+		return false
+	}
+	return queue.MatchURL(url, r.Host, r.Prefix)
+}
+
+//backoffInterval returns the base delay of retry policies that do not set their own
+func (w *Worker) backoffInterval() time.Duration {
+	return time.Duration(w.BackoffIntervalMs) * time.Millisecond
+}
+
+//retryPolicyFor returns the retry policy of the hook: the one it was enqueued with, the one of its destination
+//or the worker one, in this order. Workers without a retry policy back off exponentially without jitter
+func (w *Worker) retryPolicyFor(msg map[string]interface{}) queue.RetryPolicy {
+	if retry, ok := msg["retry"]; ok && retry != nil {
+		retryJSON, _ := json.Marshal(retry)
+		config := &queue.RetryConfig{}
+		err := json.Unmarshal(retryJSON, config)
+		if err == nil {
+			var policy queue.RetryPolicy
+			policy, err = queue.NewRetryPolicy(config, w.backoffInterval())
+			if err == nil {
+				return policy
+			}
+		}
+		w.Logger.Warn(
+			"Invalid hook retry policy, using the default one.",
+			zap.String("operation", "retryPolicyFor"),
+			zap.String("queue", w.Queue),
+			zap.Error(err),
+		)
+	}
+
+	if url, ok := msg["url"].(string); ok {
+		for _, rule := range w.RetryRules {
+			if rule.Matches(url) && rule.Policy != nil {
+				return rule.Policy
+			}
+		}
+	}
+
+	if w.RetryPolicy != nil {
+		return w.RetryPolicy
+	}
+	return &queue.ExponentialPolicy{Base: w.backoffInterval()}
+}
+
+//getRetryDelay returns the delay the hook waited before its last retry
+func getRetryDelay(msg map[string]interface{}) time.Duration {
+	if delay, ok := msg["retryDelayMs"].(float64); ok {
+		return time.Duration(delay) * time.Millisecond
+	}
+	if delay, ok := msg["retryDelayMs"].(int64); ok {
+		return time.Duration(delay) * time.Millisecond
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//SignatureHeader is the header holding the HMAC-SHA256 signatures of the hook
+const SignatureHeader = "X-Santiago-Signature"
+
+//TimestampHeader is the header holding the unix timestamp the hook was signed at
+const TimestampHeader = "X-Santiago-Timestamp"
+
+//Signer signs outgoing hooks with HMAC-SHA256 so receivers can verify they were sent by Santiago
+type Signer struct {
+	Secrets       []string
+	TenantSecrets map[string][]string
+}
+
+//NewSigner returns a signer with the given global and per-tenant secrets.
+//Every active secret signs the hook, so secrets can be rotated by adding the new one before removing the old one
+func NewSigner(secrets []string, tenantSecrets map[string][]string) *Signer {
+	if tenantSecrets == nil {
+		tenantSecrets = map[string][]string{}
+	}
+	return &Signer{
+		Secrets:       secrets,
+		TenantSecrets: tenantSecrets,
+	}
+}
+
+//SecretsFor returns the secrets used to sign hooks of the given tenant, falling back to the global ones
+func (s *Signer) SecretsFor(tenant string) []string {
+	if secrets, ok := s.TenantSecrets[tenant]; ok && tenant != "" && len(secrets) > 0 {
+		return secrets
+	}
+	return s.Secrets
+}
+
+//Sign returns the headers that authenticate the given body sent at the given timestamp,
+//or no headers if there are no secrets for the tenant
+func (s *Signer) Sign(tenant, body string, timestamp int64) map[string]string {
+	secrets := s.SecretsFor(tenant)
+	if len(secrets) == 0 {
+		return map[string]string{}
+	}
+
+	signatures := make([]string, len(secrets))
+	for i, secret := range secrets {
+		signatures[i] = fmt.Sprintf("sha256=%s", ComputeSignature(secret, timestamp, body))
+	}
+
+	return map[string]string{
+		TimestampHeader: strconv.FormatInt(timestamp, 10),
+		SignatureHeader: strings.Join(signatures, ","),
+	}
+}
+
+//ComputeSignature returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" with the given secret
+func ComputeSignature(secret string, timestamp int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.%s", timestamp, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	. "github.com/topfreegames/santiago/worker/handler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signer", func() {
+	expectedSignature := func(secret, content string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(content))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	It("should sign body and timestamp with global secret", func() {
+		signer := NewSigner([]string{"global-secret"}, nil)
+
+		headers := signer.Sign("", "{\"qwe\":123}", 1478401023)
+		Expect(headers).To(HaveKeyWithValue(TimestampHeader, "1478401023"))
+		Expect(headers).To(HaveKeyWithValue(
+			SignatureHeader,
+			"sha256="+expectedSignature("global-secret", "1478401023.{\"qwe\":123}"),
+		))
+	})
+
+	It("should sign with every active secret to allow rotation", func() {
+		signer := NewSigner([]string{"new-secret", "old-secret"}, nil)
+
+		headers := signer.Sign("", "payload", 1478401023)
+		Expect(headers[SignatureHeader]).To(Equal(
+			"sha256=" + expectedSignature("new-secret", "1478401023.payload") +
+				",sha256=" + expectedSignature("old-secret", "1478401023.payload"),
+		))
+	})
+
+	It("should prefer tenant secrets over global ones", func() {
+		signer := NewSigner([]string{"global-secret"}, map[string][]string{
+			"tenant-a": []string{"tenant-secret"},
+		})
+
+		Expect(signer.SecretsFor("tenant-a")).To(Equal([]string{"tenant-secret"}))
+		Expect(signer.SecretsFor("tenant-b")).To(Equal([]string{"global-secret"}))
+		Expect(signer.SecretsFor("")).To(Equal([]string{"global-secret"}))
+	})
+
+	It("should not sign if there are no secrets", func() {
+		signer := NewSigner([]string{}, map[string][]string{
+			"tenant-a": []string{"tenant-secret"},
+		})
+
+		Expect(signer.Sign("tenant-b", "payload", 1478401023)).To(BeEmpty())
+		Expect(signer.Sign("tenant-a", "payload", 1478401023)).To(HaveLen(2))
+	})
+})
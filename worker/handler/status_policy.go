@@ -0,0 +1,130 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Outcomes of a hook request according to the status code of the response
+const (
+	StatusDelivered = "delivered"
+	StatusRetryable = "retryable"
+	StatusPermanent = "permanent"
+)
+
+//DefaultMaxRetryAfter is the longest Retry-After honored by default
+const DefaultMaxRetryAfter = time.Hour
+
+//StatusPolicy decides whether hooks answered with an error status code are retried or failed at once.
+//Status codes are given either exactly (i.e. 429) or by class (i.e. 5xx), and exact codes take precedence over classes.
+//If Retryable is empty, all error status codes that are not permanent are retried
+type StatusPolicy struct {
+	Retryable     []string
+	Permanent     []string
+	RetryAfter    bool
+	MaxRetryAfter time.Duration
+}
+
+//NewStatusPolicy returns a status policy with the given retryable and permanent status codes that honors Retry-After
+func NewStatusPolicy(retryable, permanent []string) (*StatusPolicy, error) {
+	for _, code := range append(append([]string{}, retryable...), permanent...) {
+		if !isStatusPattern(code) {
+			return nil, fmt.Errorf("'%s' is not a status code (i.e. 429) or class (i.e. 5xx)", code)
+		}
+	}
+	return &StatusPolicy{
+		Retryable:     retryable,
+		Permanent:     permanent,
+		RetryAfter:    true,
+		MaxRetryAfter: DefaultMaxRetryAfter,
+	}, nil
+}
+
+func isStatusPattern(code string) bool {
+	if len(code) != 3 || code[0] < '1' || code[0] > '5' {
+		return false
+	}
+	if strings.ToLower(code[1:]) == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(code)
+	return err == nil
+}
+
+func matchesStatus(codes []string, status int, exact bool) bool {
+	statusCode := strconv.Itoa(status)
+	for _, code := range codes {
+		isClass := strings.ToLower(code[1:]) == "xx"
+		if exact && !isClass && code == statusCode {
+			return true
+		}
+		if !exact && isClass && code[0] == statusCode[0] {
+			return true
+		}
+	}
+	return false
+}
+
+//Classify returns whether a hook answered with the given status code was delivered, should be retried or failed permanently
+func (p *StatusPolicy) Classify(status int) string {
+	if status < 400 {
+		return StatusDelivered
+	}
+
+	for _, exact := range []bool{true, false} {
+		if matchesStatus(p.Permanent, status, exact) {
+			return StatusPermanent
+		}
+		if matchesStatus(p.Retryable, status, exact) {
+			return StatusRetryable
+		}
+	}
+
+	if len(p.Retryable) == 0 {
+		return StatusRetryable
+	}
+	return StatusPermanent
+}
+
+//RetryAfterDelay returns how long the endpoint asked the hook to wait before being retried, if it answered 429 or 503
+//with a Retry-After header in seconds or as an HTTP date. It returns zero if the retry policy should be used instead
+func (p *StatusPolicy) RetryAfterDelay(status int, retryAfter string, now time.Time) time.Duration {
+	if !p.RetryAfter || retryAfter == "" {
+		return 0
+	}
+	if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(retryAfter), 10, 64); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(retryAfter); err == nil {
+		delay = date.Sub(now)
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+	if p.MaxRetryAfter > 0 && delay > p.MaxRetryAfter {
+		return p.MaxRetryAfter
+	}
+	return delay
+}
+
+func (w *Worker) getStatusPolicy() *StatusPolicy {
+	if w.StatusPolicy == nil {
+		policy, _ := NewStatusPolicy(nil, nil)
+		return policy
+	}
+	return w.StatusPolicy
+}
@@ -0,0 +1,97 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/topfreegames/santiago/worker/handler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Status policy", func() {
+	Describe("Classify", func() {
+		It("should retry every error status by default", func() {
+			policy, err := NewStatusPolicy(nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Classify(200)).To(Equal(StatusDelivered))
+			Expect(policy.Classify(302)).To(Equal(StatusDelivered))
+			Expect(policy.Classify(404)).To(Equal(StatusRetryable))
+			Expect(policy.Classify(500)).To(Equal(StatusRetryable))
+		})
+
+		It("should fail permanent status codes", func() {
+			policy, err := NewStatusPolicy(nil, []string{"400", "410"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Classify(410)).To(Equal(StatusPermanent))
+			Expect(policy.Classify(400)).To(Equal(StatusPermanent))
+			Expect(policy.Classify(404)).To(Equal(StatusRetryable))
+		})
+
+		It("should prefer exact status codes over classes", func() {
+			policy, err := NewStatusPolicy([]string{"429", "5xx"}, []string{"4xx", "501"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Classify(429)).To(Equal(StatusRetryable))
+			Expect(policy.Classify(404)).To(Equal(StatusPermanent))
+			Expect(policy.Classify(503)).To(Equal(StatusRetryable))
+			Expect(policy.Classify(501)).To(Equal(StatusPermanent))
+		})
+
+		It("should fail status codes that are not retryable", func() {
+			policy, err := NewStatusPolicy([]string{"5XX", "408"}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Classify(500)).To(Equal(StatusRetryable))
+			Expect(policy.Classify(408)).To(Equal(StatusRetryable))
+			Expect(policy.Classify(404)).To(Equal(StatusPermanent))
+		})
+
+		It("should fail with invalid status codes", func() {
+			_, err := NewStatusPolicy([]string{"5x"}, nil)
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewStatusPolicy(nil, []string{"abc"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("RetryAfterDelay", func() {
+		now := time.Date(2016, 11, 1, 10, 0, 0, 0, time.UTC)
+
+		It("should honor Retry-After in seconds", func() {
+			policy, _ := NewStatusPolicy(nil, nil)
+			Expect(policy.RetryAfterDelay(429, "120", now)).To(Equal(2 * time.Minute))
+			Expect(policy.RetryAfterDelay(503, "30", now)).To(Equal(30 * time.Second))
+		})
+
+		It("should honor Retry-After as an HTTP date", func() {
+			policy, _ := NewStatusPolicy(nil, nil)
+			date := now.Add(45 * time.Second).Format(http.TimeFormat)
+			Expect(policy.RetryAfterDelay(503, date, now)).To(Equal(45 * time.Second))
+
+			date = now.Add(-45 * time.Second).Format(http.TimeFormat)
+			Expect(policy.RetryAfterDelay(503, date, now)).To(BeZero())
+		})
+
+		It("should ignore Retry-After of other status codes or if disabled", func() {
+			policy, _ := NewStatusPolicy(nil, nil)
+			Expect(policy.RetryAfterDelay(500, "120", now)).To(BeZero())
+			Expect(policy.RetryAfterDelay(429, "soon", now)).To(BeZero())
+
+			policy.RetryAfter = false
+			Expect(policy.RetryAfterDelay(429, "120", now)).To(BeZero())
+		})
+
+		It("should cap Retry-After", func() {
+			policy, _ := NewStatusPolicy(nil, nil)
+			policy.MaxRetryAfter = time.Minute
+			Expect(policy.RetryAfterDelay(429, "3600", now)).To(Equal(time.Minute))
+		})
+	})
+})
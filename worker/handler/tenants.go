@@ -0,0 +1,80 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"time"
+
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+)
+
+//refreshTenants reloads the queues of the tenants from Redis if they were loaded more than TenantRefreshInterval ago.
+//The previous queues are kept if they can not be loaded
+func (w *Worker) refreshTenants() {
+	now := time.Now()
+	if !w.tenantsRefreshedAt.IsZero() && now.Sub(w.tenantsRefreshedAt) < w.TenantRefreshInterval {
+		return
+	}
+	w.tenantsRefreshedAt = now
+
+	tenants, err := queue.NewTenants(w.Client, w.Queue).List()
+	if err != nil {
+		w.Logger.Error("Could not load tenants.", zap.String("operation", "refreshTenants"), zap.Error(err))
+		return
+	}
+	queues := make([]string, len(tenants))
+	for i, tenant := range tenants {
+		queues[i] = queue.TenantQueue(w.Queue, tenant)
+	}
+	w.tenantQueues = queues
+}
+
+//tenantWeight returns how many turns the queue gets for each turn of a queue with weight 1
+func (w *Worker) tenantWeight(q string) int {
+	for tenant, weight := range w.TenantWeights {
+		if q == queue.TenantQueue(w.Queue, tenant) && weight > 0 {
+			return weight
+		}
+	}
+	return 1
+}
+
+//tenantOrder returns Queue and the queues of the tenants in the order they should be popped from.
+//The first queue is picked by smooth weighted round robin, so a busy tenant can not starve the others,
+//and the other queues follow so workers never idle while there are hooks in any queue
+func (w *Worker) tenantOrder() []string {
+	w.refreshTenants()
+	if len(w.tenantQueues) == 0 {
+		return []string{w.Queue}
+	}
+
+	all := append([]string{w.Queue}, w.tenantQueues...)
+	var ordered []string
+	ordered, w.tenantTurns = pickWeighted(all, w.tenantWeight, w.tenantTurns)
+	return ordered
+}
+
+//pickWeighted picks one of the names by smooth weighted round robin given their current weights.
+//It returns all names in rotation starting at the picked one and the new current weights
+func pickWeighted(names []string, weight func(string) int, current map[string]int) ([]string, map[string]int) {
+	weights := map[string]int{}
+	total := 0
+	picked := 0
+	for i, name := range names {
+		weights[name] = current[name] + weight(name)
+		total += weight(name)
+		if weights[name] > weights[names[picked]] {
+			picked = i
+		}
+	}
+	weights[names[picked]] -= total
+
+	ordered := make([]string, 0, len(names))
+	ordered = append(ordered, names[picked:]...)
+	return append(ordered, names[:picked]...), weights
+}
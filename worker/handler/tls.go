@@ -0,0 +1,302 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/topfreegames/santiago/queue"
+	"github.com/uber-go/zap"
+	"github.com/valyala/fasthttp"
+)
+
+//TLSRule sets the CA bundle trusted and the client certificate presented in requests to a destination host.
+//Host may include the port, in which case it only applies to that port
+type TLSRule struct {
+	Host     string `mapstructure:"host"`
+	CAFile   string `mapstructure:"caFile"`
+	CertFile string `mapstructure:"certFile"`
+	KeyFile  string `mapstructure:"keyFile"`
+}
+
+func (r *TLSRule) files() []string {
+	files := []string{}
+	for _, file := range []string{r.CAFile, r.CertFile, r.KeyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+//Load reads the files of the rule, returning its TLS configuration
+func (r *TLSRule) Load() (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if r.CAFile != "" {
+		bundle, err := ioutil.ReadFile(r.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", r.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if r.CertFile != "" || r.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+//TLSConfigs holds the TLS configuration of the destination hosts with TLS rules, reloading them when their files change
+type TLSConfigs struct {
+	Rules          []*TLSRule
+	ReloadInterval time.Duration
+	configs        map[string]*tls.Config
+	modTimes       map[string]time.Time
+	clients        map[string]*tlsClient
+	lock           sync.RWMutex
+}
+
+//tlsClient is the HTTP client of a host with a TLS rule. Once replaced by a reload it is retired, closing
+//its connections as soon as the requests it was sending finish, since fasthttp keeps idle connections open
+type tlsClient struct {
+	config   *tls.Config
+	client   *fasthttp.Client
+	lock     sync.Mutex
+	conns    map[net.Conn]struct{}
+	inFlight int
+	retired  bool
+}
+
+//trackedConn removes itself from the connections of its client when closed
+type trackedConn struct {
+	net.Conn
+	owner *tlsClient
+}
+
+func (c *trackedConn) Close() error {
+	c.owner.lock.Lock()
+	delete(c.owner.conns, c)
+	c.owner.lock.Unlock()
+	return c.Conn.Close()
+}
+
+func newTLSClient(config *tls.Config, options *ClientOptions) *tlsClient {
+	c := &tlsClient{
+		config: config,
+		client: NewHTTPClient(options),
+		conns:  map[net.Conn]struct{}{},
+	}
+	c.client.TLSConfig = config
+
+	dial := c.client.Dial
+	if dial == nil {
+		dial = fasthttp.Dial
+	}
+	c.client.Dial = func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		tracked := &trackedConn{Conn: conn, owner: c}
+		c.lock.Lock()
+		c.conns[tracked] = struct{}{}
+		c.lock.Unlock()
+		return tracked, nil
+	}
+	return c
+}
+
+//acquire counts a request sent with the client, returning the function that must be called once it finishes
+func (c *tlsClient) acquire() func() {
+	c.lock.Lock()
+	c.inFlight++
+	c.lock.Unlock()
+	return func() {
+		c.lock.Lock()
+		c.inFlight--
+		c.lock.Unlock()
+		c.closeIfIdle()
+	}
+}
+
+//retire stops the client from being used, closing its connections once no requests are in flight
+func (c *tlsClient) retire() {
+	c.lock.Lock()
+	c.retired = true
+	c.lock.Unlock()
+	c.closeIfIdle()
+}
+
+func (c *tlsClient) closeIfIdle() {
+	c.lock.Lock()
+	if !c.retired || c.inFlight > 0 {
+		c.lock.Unlock()
+		return
+	}
+	conns := []net.Conn{}
+	for conn := range c.conns {
+		conns = append(conns, conn)
+	}
+	c.lock.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+//NewTLSConfigs loads the given TLS rules, failing if any of their files can not be loaded
+func NewTLSConfigs(rules []*TLSRule) (*TLSConfigs, error) {
+	t := &TLSConfigs{
+		Rules:          rules,
+		ReloadInterval: 30 * time.Second,
+		configs:        map[string]*tls.Config{},
+		modTimes:       map[string]time.Time{},
+		clients:        map[string]*tlsClient{},
+	}
+
+	for _, rule := range rules {
+		if rule.Host == "" {
+			return nil, fmt.Errorf("every TLS rule must have a host")
+		}
+		config, err := rule.Load()
+		if err != nil {
+			return nil, fmt.Errorf("TLS rule of %s: %s", rule.Host, err)
+		}
+		t.configs[rule.Host] = config
+		for _, file := range rule.files() {
+			t.modTimes[file] = modTime(file)
+		}
+	}
+
+	return t, nil
+}
+
+func modTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+//ConfigFor returns the TLS configuration of the given host, with or without port, or nil if it has no TLS rule
+func (t *TLSConfigs) ConfigFor(host string) *tls.Config {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if config, ok := t.configs[host]; ok {
+		return config
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return t.configs[hostname]
+	}
+	return nil
+}
+
+//Reload reloads the TLS rules whose files changed, returning the hosts reloaded.
+//Rules that fail to load keep their previous configuration
+func (t *TLSConfigs) Reload() ([]string, error) {
+	reloaded := []string{}
+	var firstErr error
+
+	for _, rule := range t.Rules {
+		changed := false
+		for _, file := range rule.files() {
+			t.lock.RLock()
+			previous := t.modTimes[file]
+			t.lock.RUnlock()
+			if !modTime(file).Equal(previous) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		config, err := rule.Load()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("TLS rule of %s: %s", rule.Host, err)
+			}
+			continue
+		}
+
+		t.lock.Lock()
+		t.configs[rule.Host] = config
+		for _, file := range rule.files() {
+			t.modTimes[file] = modTime(file)
+		}
+		t.lock.Unlock()
+		reloaded = append(reloaded, rule.Host)
+	}
+
+	return reloaded, firstErr
+}
+
+//clientFor returns a HTTP client with the given TLS configuration for the host and the function to call once its
+//request finishes. The client is replaced once the configuration is reloaded, closing the connections of the previous one
+func (t *TLSConfigs) clientFor(host string, config *tls.Config, options *ClientOptions) (*fasthttp.Client, func()) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	c, ok := t.clients[host]
+	if !ok || c.config != config {
+		if ok {
+			c.retire()
+		}
+		c = newTLSClient(config, options)
+		t.clients[host] = c
+	}
+	return c.client, c.acquire()
+}
+
+//httpClientFor returns the HTTP client used to send requests to the given URL and the function to call once the request finishes
+func (w *Worker) httpClientFor(url string) (*fasthttp.Client, func()) {
+	if w.TLS != nil {
+		host := queue.HostFor(url)
+		if config := w.TLS.ConfigFor(host); config != nil {
+			return w.TLS.clientFor(host, config, w.ClientOptions)
+		}
+	}
+	return w.getHTTPClient(), func() {}
+}
+
+func (w *Worker) reloadTLS() {
+	l := w.Logger.With(
+		zap.String("operation", "reloadTLS"),
+		zap.String("queue", w.Queue),
+	)
+
+	for !w.stopping() {
+		time.Sleep(w.TLS.ReloadInterval)
+
+		hosts, err := w.TLS.Reload()
+		if err != nil {
+			l.Error("Failed to reload TLS configuration. Previous configuration is kept.", zap.Error(err))
+		}
+		for _, host := range hosts {
+			l.Info("TLS configuration reloaded.", zap.String("host", host))
+		}
+	}
+}
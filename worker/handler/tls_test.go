@@ -0,0 +1,294 @@
+// santiago - webhook dispatching service
+// https://github.com/topfreegames/santiago
+// Licensed under the MIT license:
+// http://www.opensource.org/licenses/mit-license
+// Copyright © 2016 Top Free Games <backend@tfgco.com>
+
+package worker_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/topfreegames/santiago/testing"
+	. "github.com/topfreegames/santiago/worker/handler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA() *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Santiago Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+//issue returns the PEM encoded certificate and key of a new server or client certificate signed by the CA
+func (ca *testCA) issue(usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func newTLSReceiver(ca *testCA, clientCA *testCA) *httptest.Server {
+	certPEM, keyPEM := ca.issue(x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).NotTo(HaveOccurred())
+
+	receiver := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	receiver.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA.cert)
+		receiver.TLS.ClientCAs = pool
+		receiver.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	receiver.StartTLS()
+	return receiver
+}
+
+func writeFile(dir, name string, contents []byte) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, contents, 0600)
+	Expect(err).NotTo(HaveOccurred())
+	return path
+}
+
+var _ = Describe("TLS", func() {
+	var logger *testing.MockLogger
+	var worker *Worker
+	var dir string
+	var ca *testCA
+
+	BeforeEach(func() {
+		logger = testing.NewMockLogger()
+		worker = New(
+			uuid.NewV4().String(),
+			"127.0.0.1", 57575, "", 0,
+			10, logger, true, time.Millisecond, "", 10, &RealClock{},
+		)
+
+		var err error
+		dir, err = ioutil.TempDir("", "santiago-tls")
+		Expect(err).NotTo(HaveOccurred())
+		ca = newTestCA()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should fail to load rules with invalid files", func() {
+		_, err := NewTLSConfigs([]*TLSRule{{Host: "127.0.0.1", CAFile: filepath.Join(dir, "missing.pem")}})
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewTLSConfigs([]*TLSRule{{Host: "127.0.0.1", CAFile: writeFile(dir, "ca.pem", []byte("qwe"))}})
+		Expect(err).To(MatchError(ContainSubstring("no certificates found")))
+
+		_, err = NewTLSConfigs([]*TLSRule{{CAFile: writeFile(dir, "ca.pem", ca.pem)}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should match hosts with or without port", func() {
+		configs, err := NewTLSConfigs([]*TLSRule{
+			{Host: "127.0.0.1", CAFile: writeFile(dir, "ca.pem", ca.pem)},
+			{Host: "test.com:8443", CAFile: writeFile(dir, "ca.pem", ca.pem)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configs.ConfigFor("127.0.0.1")).NotTo(BeNil())
+		Expect(configs.ConfigFor("127.0.0.1:8443")).NotTo(BeNil())
+		Expect(configs.ConfigFor("test.com:8443")).NotTo(BeNil())
+		Expect(configs.ConfigFor("test.com")).To(BeNil())
+		Expect(configs.ConfigFor("other.com")).To(BeNil())
+	})
+
+	It("should not trust private CAs by default", func() {
+		receiver := newTLSReceiver(ca, nil)
+		defer receiver.Close()
+
+		_, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should trust CA bundle of destination host", func() {
+		receiver := newTLSReceiver(ca, nil)
+		defer receiver.Close()
+
+		configs, err := NewTLSConfigs([]*TLSRule{{Host: "127.0.0.1", CAFile: writeFile(dir, "ca.pem", ca.pem)}})
+		Expect(err).NotTo(HaveOccurred())
+		worker.TLS = configs
+
+		resp, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should present client certificate to destination host", func() {
+		clientCA := newTestCA()
+		receiver := newTLSReceiver(ca, clientCA)
+		defer receiver.Close()
+
+		configs, err := NewTLSConfigs([]*TLSRule{{Host: "127.0.0.1", CAFile: writeFile(dir, "ca.pem", ca.pem)}})
+		Expect(err).NotTo(HaveOccurred())
+		worker.TLS = configs
+
+		_, err = worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).To(HaveOccurred())
+
+		certPEM, keyPEM := clientCA.issue(x509.ExtKeyUsageClientAuth)
+		configs, err = NewTLSConfigs([]*TLSRule{{
+			Host:     "127.0.0.1",
+			CAFile:   writeFile(dir, "ca.pem", ca.pem),
+			CertFile: writeFile(dir, "client.pem", certPEM),
+			KeyFile:  writeFile(dir, "client-key.pem", keyPEM),
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		worker.TLS = configs
+
+		resp, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should reload CA bundle when it changes", func() {
+		receiver := newTLSReceiver(ca, nil)
+		defer receiver.Close()
+
+		caFile := writeFile(dir, "ca.pem", newTestCA().pem)
+		configs, err := NewTLSConfigs([]*TLSRule{{Host: "127.0.0.1", CAFile: caFile}})
+		Expect(err).NotTo(HaveOccurred())
+		worker.TLS = configs
+
+		_, err = worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).To(HaveOccurred())
+
+		reloaded, err := configs.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeEmpty())
+
+		writeFile(dir, "ca.pem", ca.pem)
+		later := time.Now().Add(time.Minute)
+		err = os.Chtimes(caFile, later, later)
+		Expect(err).NotTo(HaveOccurred())
+
+		reloaded, err = configs.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(Equal([]string{"127.0.0.1"}))
+
+		resp, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should close connections of the client replaced by a reload", func() {
+		certPEM, keyPEM := ca.issue(x509.ExtKeyUsageServerAuth)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		Expect(err).NotTo(HaveOccurred())
+
+		var closed int32
+		receiver := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		receiver.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		receiver.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateClosed {
+				atomic.AddInt32(&closed, 1)
+			}
+		}
+		receiver.StartTLS()
+		defer receiver.Close()
+
+		caFile := writeFile(dir, "ca.pem", ca.pem)
+		configs, err := NewTLSConfigs([]*TLSRule{{Host: "127.0.0.1", CAFile: caFile}})
+		Expect(err).NotTo(HaveOccurred())
+		worker.TLS = configs
+
+		_, err = worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(atomic.LoadInt32(&closed)).To(BeEquivalentTo(0))
+
+		later := time.Now().Add(time.Minute)
+		err = os.Chtimes(caFile, later, later)
+		Expect(err).NotTo(HaveOccurred())
+		reloaded, err := configs.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(Equal([]string{"127.0.0.1"}))
+
+		resp, err := worker.DoRequest("POST", receiver.URL, "{}", map[string]string{}, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Eventually(func() int32 {
+			return atomic.LoadInt32(&closed)
+		}).Should(BeEquivalentTo(1))
+	})
+
+	It("should keep previous configuration if reload fails", func() {
+		caFile := writeFile(dir, "ca.pem", ca.pem)
+		configs, err := NewTLSConfigs([]*TLSRule{{Host: "127.0.0.1", CAFile: caFile}})
+		Expect(err).NotTo(HaveOccurred())
+		previous := configs.ConfigFor("127.0.0.1")
+
+		writeFile(dir, "ca.pem", []byte("qwe"))
+		later := time.Now().Add(time.Minute)
+		err = os.Chtimes(caFile, later, later)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = configs.Reload()
+		Expect(err).To(HaveOccurred())
+		Expect(configs.ConfigFor("127.0.0.1") == previous).To(BeTrue())
+	})
+})